@@ -101,6 +101,7 @@ type UserInfo struct {
 	Enabled     bool   `json:"enabled"`
 	Online      bool   `json:"online"`
 	IP          string `json:"ip"`
+	StaticIP    string `json:"staticIp"` // 固定分配的隧道地址
 	ConnectedAt string `json:"connectedAt"`
 	CreatedAt   string `json:"createdAt"`
 	RxBytes     int64  `json:"rxBytes"`
@@ -122,6 +123,7 @@ type UserCreateReq struct {
 	g.Meta   `path:"/users" method:"post" tags:"OpenVPN" summary:"创建用户"`
 	Username string `json:"username" v:"required#用户名必填"`
 	Password string `json:"password" v:"required|length:6,32#密码必填|密码长度6-32位"`
+	StaticIP string `json:"staticIp" v:"ip#IP 地址格式错误"` // 为空时自动分配
 }
 
 // UserCreateRes 创建用户响应
@@ -134,6 +136,7 @@ type UserUpdateReq struct {
 	g.Meta   `path:"/users/{id}" method:"put" tags:"OpenVPN" summary:"更新用户"`
 	Id       int    `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
 	Password string `json:"password"`
+	StaticIP string `json:"staticIp" v:"ip#IP 地址格式错误"` // 为空表示不修改
 	Enabled  *bool  `json:"enabled"`
 }
 
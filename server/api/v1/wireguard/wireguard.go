@@ -8,25 +8,95 @@ import (
 	"github.com/gogf/gf/v2/frame/g"
 )
 
+// ===================== 接口管理 =====================
+
+// InterfaceScope 请求所属的接口：经 /wireguard/interfaces/{interfaceId}/... 访问时由路径指定，
+// 经 /wireguard/... 访问时为默认接口
+type InterfaceScope struct {
+	InterfaceId int `json:"interfaceId" in:"path" d:"1" v:"min:1#接口ID无效"`
+}
+
+// InterfaceInfo 接口信息
+type InterfaceInfo struct {
+	Id         int    `json:"id"`
+	Name       string `json:"name"`
+	ListenPort int    `json:"listenPort"`
+	PublicKey  string `json:"publicKey"`
+	Address    string `json:"address"`
+	Mode       string `json:"mode"`
+	AutoStart  bool   `json:"autoStart"`
+	Running    bool   `json:"running"`
+	PeerCount  int    `json:"peerCount"`
+}
+
+// InterfaceListReq 获取接口列表请求
+type InterfaceListReq struct {
+	g.Meta `path:"/interfaces" method:"get" tags:"WireGuard" summary:"获取WireGuard接口列表"`
+}
+
+// InterfaceListRes 获取接口列表响应
+type InterfaceListRes struct {
+	Interfaces []*InterfaceInfo `json:"interfaces"`
+}
+
+// InterfaceCreateReq 新建接口请求
+type InterfaceCreateReq struct {
+	g.Meta          `path:"/interfaces" method:"post" tags:"WireGuard" summary:"新建WireGuard接口"`
+	Name            string `json:"name" v:"required#接口名称必填"`
+	ListenPort      int    `json:"listenPort" v:"required|min:1|max:65535#监听端口必填|端口范围错误|端口范围错误"`
+	Address         string `json:"address" v:"required#地址必填"` // 不得与其他接口或 OpenVPN 网段重叠
+	DNS             string `json:"dns"`
+	EndpointAddress string `json:"endpointAddress"`
+	Mode            string `json:"mode" v:"in:tun,netstack#运行模式只能是 tun 或 netstack"`
+}
+
+// InterfaceCreateRes 新建接口响应
+type InterfaceCreateRes struct {
+	Id int `json:"id"`
+}
+
+// InterfaceDeleteReq 删除接口请求
+type InterfaceDeleteReq struct {
+	g.Meta `path:"/interfaces/{id}" method:"delete" tags:"WireGuard" summary:"删除WireGuard接口"`
+	Id     int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+}
+
+// InterfaceDeleteRes 删除接口响应
+type InterfaceDeleteRes struct {
+	Success bool `json:"success"`
+}
+
 // ===================== 服务状态 =====================
 
 // StatusReq WireGuard 状态请求
 type StatusReq struct {
 	g.Meta `path:"/status" method:"get" tags:"WireGuard" summary:"获取WireGuard服务状态"`
+	InterfaceScope
 }
 
 // StatusRes WireGuard 状态响应
 type StatusRes struct {
-	Running    bool   `json:"running"`
-	Interface  string `json:"interface"`
-	ListenPort int    `json:"listenPort"`
-	PublicKey  string `json:"publicKey"`
-	PeerCount  int    `json:"peerCount"`
+	InterfaceId int      `json:"interfaceId"`
+	Running     bool     `json:"running"`
+	Interface   string   `json:"interface"`
+	ListenPort  int      `json:"listenPort"`
+	PublicKey   string   `json:"publicKey"`
+	PeerCount   int      `json:"peerCount"`
+	Mode        string   `json:"mode"` // tun | netstack
+	Nat         *NatInfo `json:"nat"`  // 已安装的 NAT 规则，未安装时为 null
+}
+
+// NatInfo TUN 模式下自动配置的 NAT 规则
+type NatInfo struct {
+	Backend      string   `json:"backend"` // iptables | nftables
+	OutInterface string   `json:"outInterface"`
+	Subnets      []string `json:"subnets"`
 }
 
 // StartReq 启动服务请求
 type StartReq struct {
 	g.Meta `path:"/start" method:"post" tags:"WireGuard" summary:"启动WireGuard服务"`
+	InterfaceScope
 }
 
 // StartRes 启动服务响应
@@ -37,6 +107,7 @@ type StartRes struct {
 // StopReq 停止服务请求
 type StopReq struct {
 	g.Meta `path:"/stop" method:"post" tags:"WireGuard" summary:"停止WireGuard服务"`
+	InterfaceScope
 }
 
 // StopRes 停止服务响应
@@ -47,6 +118,7 @@ type StopRes struct {
 // RestartReq 重启服务请求
 type RestartReq struct {
 	g.Meta `path:"/restart" method:"post" tags:"WireGuard" summary:"重启WireGuard服务"`
+	InterfaceScope
 }
 
 // RestartRes 重启服务响应
@@ -59,10 +131,12 @@ type RestartRes struct {
 // ConfigReq 获取配置请求
 type ConfigReq struct {
 	g.Meta `path:"/config" method:"get" tags:"WireGuard" summary:"获取WireGuard配置"`
+	InterfaceScope
 }
 
 // ConfigRes 获取配置响应
 type ConfigRes struct {
+	InterfaceId         int    `json:"interfaceId"`
 	Interface           string `json:"interface"`
 	ListenPort          int    `json:"listenPort"`
 	PrivateKey          string `json:"privateKey"`
@@ -73,60 +147,118 @@ type ConfigRes struct {
 	EndpointAddress     string `json:"endpointAddress"`
 	PostUp              string `json:"postUp"`
 	PostDown            string `json:"postDown"`
+	HookTimeout         int    `json:"hookTimeout"`    // 钩子单条命令超时 (秒)
+	PostUpRollback      bool   `json:"postUpRollback"` // PostUp 失败时回滚启动
 	EthDevice           string `json:"ethDevice"`
 	PersistentKeepalive int    `json:"persistentKeepalive"`
 	ClientAllowedIPs    string `json:"clientAllowedIPs"`
 	ProxyAddress        string `json:"proxyAddress"`
 	LogLevel            string `json:"logLevel"`
 	AutoStart           bool   `json:"autoStart"`
+	Mode                string `json:"mode"`                 // tun=内核网卡, netstack=用户态网络栈 (无需 root)
+	UAPI                bool   `json:"uapi"`                 // 是否开放 UAPI 套接字，供 wg show / wg set 使用
+	BuiltinDNS          bool   `json:"builtinDns"`           // 在隧道地址上提供内置 DNS，客户端配置的 DNS 指向服务端
+	HandshakeDiag       bool   `json:"handshakeDiagnostics"` // 记录被拒绝的握手，开启后 Linux 上不再使用粘性套接字
 }
 
 // UpdateConfigReq 更新配置请求
 type UpdateConfigReq struct {
-	g.Meta              `path:"/config" method:"put" tags:"WireGuard" summary:"更新WireGuard配置"`
+	g.Meta `path:"/config" method:"put" tags:"WireGuard" summary:"更新WireGuard配置"`
+	InterfaceScope
 	ListenPort          int    `json:"listenPort" v:"required|min:1|max:65535#监听端口必填|端口范围错误|端口范围错误"`
 	EndpointAddress     string `json:"endpointAddress"`
-	Address             string `json:"address" v:"required#地址必填"`
+	Address             string `json:"address" v:"required#地址必填"` // 支持双栈，如 "10.66.66.1/24, fd42:42:42::1/64"
 	DNS                 string `json:"dns"`
 	MTU                 int    `json:"mtu" v:"min:1280|max:1500#MTU最小1280|MTU最大1500"`
 	EthDevice           string `json:"ethDevice"`
 	PersistentKeepalive int    `json:"persistentKeepalive"`
 	ClientAllowedIPs    string `json:"clientAllowedIPs"`
 	ProxyAddress        string `json:"proxyAddress"`
-	LogLevel            string `json:"logLevel"`
+	LogLevel            string `json:"logLevel" v:"in:error,warning,info,debug#日志等级只能是 error、warning、info 或 debug"`
 	AutoStart           bool   `json:"autoStart"`
+	Mode                string `json:"mode" v:"in:tun,netstack#运行模式只能是 tun 或 netstack"`
+	UAPI                bool   `json:"uapi"`
+	PostUp              string `json:"postUp"`                                            // 每行一条命令，%i 替换为网卡名
+	PostDown            string `json:"postDown"`                                          // 每行一条命令，%i 替换为网卡名
+	HookTimeout         int    `json:"hookTimeout" v:"min:0|max:600#钩子超时不能为负|钩子超时最大600秒"` // 0 表示默认 30 秒
+	PostUpRollback      bool   `json:"postUpRollback"`
+	BuiltinDNS          bool   `json:"builtinDns"`
+	HandshakeDiag       bool   `json:"handshakeDiagnostics"`
 }
 
 // UpdateConfigRes 更新配置响应
 type UpdateConfigRes struct {
-	Success bool `json:"success"`
+	Success bool     `json:"success"`
+	Applied string   `json:"applied"` // none: 未运行或无变化 | live: 在线生效 | restart: 已重建网卡
+	Changes []string `json:"changes"` // 发生变化的配置项
+}
+
+// HookResultsReq 获取 PostUp / PostDown 执行结果请求
+type HookResultsReq struct {
+	g.Meta `path:"/hooks" method:"get" tags:"WireGuard" summary:"获取PostUp/PostDown执行结果"`
+	InterfaceScope
+}
+
+// HookResult 钩子命令执行结果
+type HookResult struct {
+	Hook       string `json:"hook"` // PostUp | PostDown
+	Command    string `json:"command"`
+	Output     string `json:"output"`
+	ExitCode   int    `json:"exitCode"` // 超时或无法执行时为 -1
+	Error      string `json:"error"`
+	DurationMs int64  `json:"durationMs"`
+	RanAt      string `json:"ranAt"`
+}
+
+// HookResultsRes 获取 PostUp / PostDown 执行结果响应 (按时间倒序)
+type HookResultsRes struct {
+	Results []*HookResult `json:"results"`
 }
 
 // ===================== 客户端管理 =====================
 
 // PeerInfo 客户端信息
 type PeerInfo struct {
-	Id              int    `json:"id"`
-	Name            string `json:"name"`
-	PublicKey       string `json:"publicKey"`
-	AllowedIPs      string `json:"allowedIPs"`
-	Endpoint        string `json:"endpoint"`
-	LatestHandshake string `json:"latestHandshake"`
-	TransferRx      int64  `json:"transferRx"`
-	TransferTx      int64  `json:"transferTx"`
-	UploadLimit     int64  `json:"uploadLimit"`   // bytes/s, 0=无限制
-	DownloadLimit   int64  `json:"downloadLimit"` // bytes/s, 0=无限制
-	TotalUpload     int64  `json:"totalUpload"`   // 历史总上传流量
-	TotalDownload   int64  `json:"totalDownload"` // 历史总下载流量
-	Enabled         bool   `json:"enabled"`
-	Online          bool   `json:"online"`
-	CreatedAt       string `json:"createdAt"`
-	UpdatedAt       string `json:"updatedAt"`
+	Id                  int    `json:"id"`
+	Name                string `json:"name"`
+	PublicKey           string `json:"publicKey"`
+	AllowedIPs          string `json:"allowedIPs"`
+	RoutedNetworks      string `json:"routedNetworks"`      // Peer 后方的局域网网段 (站点互联)
+	PresharedKey        bool   `json:"presharedKey"`        // 是否已启用预共享密钥
+	Endpoint            string `json:"endpoint"`            // 运行时 Endpoint
+	StaticEndpoint      string `json:"staticEndpoint"`      // 配置的对端地址 (站点互联)
+	PersistentKeepalive int    `json:"persistentKeepalive"` // 秒，<0 继承全局配置，0 关闭
+	LatestHandshake     string `json:"latestHandshake"`
+	TransferRx          int64  `json:"transferRx"`
+	TransferTx          int64  `json:"transferTx"`
+	UploadLimit         int64  `json:"uploadLimit"`       // bytes/s, 0=使用分组限速 (未分组时无限制)
+	DownloadLimit       int64  `json:"downloadLimit"`     // bytes/s, 0=使用分组限速 (未分组时无限制)
+	TotalUpload         int64  `json:"totalUpload"`       // 历史总上传流量
+	TotalDownload       int64  `json:"totalDownload"`     // 历史总下载流量
+	ExpiresAt           string `json:"expiresAt"`         // 到期时间，为空表示永不过期
+	RemainingSeconds    int64  `json:"remainingSeconds"`  // 剩余有效期 (秒)，-1 表示永不过期，0 表示已到期
+	QuotaBytes          int64  `json:"quotaBytes"`        // 每月流量配额 (bytes)，0=不限
+	QuotaResetDay       int    `json:"quotaResetDay"`     // 每月重置日
+	QuotaAction         string `json:"quotaAction"`       // 超额处理: disable | throttle
+	QuotaThrottleRate   int64  `json:"quotaThrottleRate"` // 超额后限速 (bytes/s)
+	QuotaUsed           int64  `json:"quotaUsed"`         // 本周期已用流量
+	QuotaExceeded       bool   `json:"quotaExceeded"`     // 本周期是否已超额
+	GroupId             int    `json:"groupId"`           // 所属分组，0=未分组
+	GroupName           string `json:"groupName"`
+	Tags                string `json:"tags"`     // 标签，逗号分隔
+	External            bool   `json:"external"` // 服务端不保存私钥，只能下载配置模板，不提供二维码
+	Enabled             bool   `json:"enabled"`
+	Online              bool   `json:"online"`
+	CreatedAt           string `json:"createdAt"`
+	UpdatedAt           string `json:"updatedAt"`
 }
 
 // PeerListReq 获取客户端列表请求
 type PeerListReq struct {
 	g.Meta `path:"/peers" method:"get" tags:"WireGuard" summary:"获取客户端列表"`
+	InterfaceScope
+	GroupId int    `json:"groupId" in:"query" d:"-1"` // 按分组筛选，-1=全部，0=未分组
+	Tag     string `json:"tag" in:"query"`            // 按标签筛选
 }
 
 // PeerListRes 获取客户端列表响应
@@ -136,11 +268,23 @@ type PeerListRes struct {
 
 // PeerCreateReq 创建客户端请求
 type PeerCreateReq struct {
-	g.Meta        `path:"/peers" method:"post" tags:"WireGuard" summary:"创建客户端"`
-	Name          string `json:"name" v:"required#客户端名称必填"`
-	AllowedIPs    string `json:"allowedIPs"`
-	UploadLimit   int64  `json:"uploadLimit" d:"0"`   // bytes/s, 0=无限制
-	DownloadLimit int64  `json:"downloadLimit" d:"0"` // bytes/s, 0=无限制
+	g.Meta `path:"/peers" method:"post" tags:"WireGuard" summary:"创建客户端"`
+	InterfaceScope
+	Name                string  `json:"name" v:"required#客户端名称必填"`
+	AllowedIPs          string  `json:"allowedIPs"`
+	UploadLimit         int64   `json:"uploadLimit" d:"0"`                                               // bytes/s, 0=使用分组限速 (未分组时无限制)
+	DownloadLimit       int64   `json:"downloadLimit" d:"0"`                                             // bytes/s, 0=使用分组限速 (未分组时无限制)
+	StaticEndpoint      *string `json:"staticEndpoint"`                                                  // 对端地址 host:port，用于站点互联
+	PersistentKeepalive *int    `json:"persistentKeepalive"`                                             // 秒，不传继承全局配置，0 关闭
+	RoutedNetworks      *string `json:"routedNetworks"`                                                  // Peer 后方的局域网网段，逗号分隔，如 "192.168.10.0/24"
+	ExpiresAt           *string `json:"expiresAt" v:"datetime#到期时间格式应为 YYYY-MM-DD HH:mm:ss"`             // 临时访问到期时间，不传永不过期
+	QuotaBytes          *int64  `json:"quotaBytes"`                                                      // 每月流量配额 (bytes)，不传或 0 不限
+	QuotaResetDay       *int    `json:"quotaResetDay" v:"between:1,28#配额重置日应在 1-28 之间"`                  // 每月重置日，默认 1
+	QuotaAction         *string `json:"quotaAction" v:"in:disable,throttle#超额处理方式应为 disable 或 throttle"` // 默认 disable
+	QuotaThrottleRate   *int64  `json:"quotaThrottleRate"`                                               // 超额后限速 (bytes/s)，0 使用默认 128KB/s
+	GroupId             int     `json:"groupId"`                                                         // 所属分组，未单独设置限速时使用分组限速
+	Tags                string  `json:"tags"`                                                            // 标签，逗号分隔
+	PublicKey           string  `json:"publicKey"`                                                       // 客户端自行生成密钥时提交公钥，服务端不保存私钥
 }
 
 // PeerCreateRes 创建客户端响应
@@ -150,13 +294,25 @@ type PeerCreateRes struct {
 
 // PeerUpdateReq 更新客户端请求
 type PeerUpdateReq struct {
-	g.Meta        `path:"/peers/{id}" method:"put" tags:"WireGuard" summary:"更新客户端"`
-	Id            int    `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
-	Name          string `json:"name"`
-	AllowedIPs    string `json:"allowedIPs"`
-	UploadLimit   int64  `json:"uploadLimit"`   // bytes/s, 0=无限制
-	DownloadLimit int64  `json:"downloadLimit"` // bytes/s, 0=无限制
-	Enabled       bool   `json:"enabled"`
+	g.Meta `path:"/peers/{id}" method:"put" tags:"WireGuard" summary:"更新客户端"`
+	InterfaceScope
+	Id                  int     `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+	Name                string  `json:"name"`
+	AllowedIPs          string  `json:"allowedIPs"`
+	UploadLimit         int64   `json:"uploadLimit" d:"-1"`   // bytes/s, 0=使用分组限速 (未分组时无限制), 不传则保持不变
+	DownloadLimit       int64   `json:"downloadLimit" d:"-1"` // bytes/s, 0=使用分组限速 (未分组时无限制), 不传则保持不变
+	Enabled             bool    `json:"enabled"`
+	StaticEndpoint      *string `json:"staticEndpoint"`                                      // 不传保持不变，空字符串清除
+	PersistentKeepalive *int    `json:"persistentKeepalive"`                                 // 不传保持不变，<0 继承全局配置，0 关闭
+	RoutedNetworks      *string `json:"routedNetworks"`                                      // 不传保持不变，空字符串清除
+	ExpiresAt           *string `json:"expiresAt" v:"datetime#到期时间格式应为 YYYY-MM-DD HH:mm:ss"` // 延长 / 修改到期时间，不传保持不变，空字符串表示永不过期
+	QuotaBytes          *int64  `json:"quotaBytes"`                                          // 以下配额字段不传保持不变
+	QuotaResetDay       *int    `json:"quotaResetDay" v:"between:1,28#配额重置日应在 1-28 之间"`
+	QuotaAction         *string `json:"quotaAction" v:"in:disable,throttle#超额处理方式应为 disable 或 throttle"`
+	QuotaThrottleRate   *int64  `json:"quotaThrottleRate"`
+	GroupId             *int    `json:"groupId"`   // 不传保持不变，0 移出分组
+	Tags                *string `json:"tags"`      // 不传保持不变，空字符串清除
+	PublicKey           *string `json:"publicKey"` // 客户端更换密钥时提交新公钥，不传保持不变
 }
 
 // PeerUpdateRes 更新客户端响应
@@ -167,7 +323,8 @@ type PeerUpdateRes struct {
 // PeerDeleteReq 删除客户端请求
 type PeerDeleteReq struct {
 	g.Meta `path:"/peers/{id}" method:"delete" tags:"WireGuard" summary:"删除客户端"`
-	Id     int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+	InterfaceScope
+	Id int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
 }
 
 // PeerDeleteRes 删除客户端响应
@@ -175,10 +332,45 @@ type PeerDeleteRes struct {
 	Success bool `json:"success"`
 }
 
+// PeerBatchItem 批量创建的单个客户端
+type PeerBatchItem struct {
+	Name       string `json:"name"`
+	AllowedIPs string `json:"allowedIPs"` // 为空自动分配
+}
+
+// PeerBatchCreateReq 批量创建客户端请求，peers 与 csv 二选一
+// 成功时直接返回 ZIP 文件，包含每个客户端的 .conf 与二维码 .png
+type PeerBatchCreateReq struct {
+	g.Meta `path:"/peers/batch" method:"post" tags:"WireGuard" summary:"批量创建客户端"`
+	InterfaceScope
+	Peers         []*PeerBatchItem `json:"peers"`
+	Csv           string           `json:"csv"`                 // 每行 "名称[,地址]"，可包含 name 表头
+	UploadLimit   int64            `json:"uploadLimit" d:"0"`   // 以下字段应用于本批全部客户端
+	DownloadLimit int64            `json:"downloadLimit" d:"0"` // bytes/s, 0=使用分组限速 (未分组时无限制)
+	ExpiresAt     *string          `json:"expiresAt" v:"datetime#到期时间格式应为 YYYY-MM-DD HH:mm:ss"`
+	GroupId       int              `json:"groupId"`
+	Tags          string           `json:"tags"`
+}
+
+// PeerBatchCreateRes 批量创建客户端响应 (ZIP 文件)
+type PeerBatchCreateRes struct{}
+
+// PeerExportReq 导出客户端清单请求
+type PeerExportReq struct {
+	g.Meta `path:"/peers/export" method:"get" tags:"WireGuard" summary:"导出客户端清单"`
+	InterfaceScope
+	Format string `json:"format" in:"query" d:"csv" v:"in:csv,json#导出格式应为 csv 或 json"`
+}
+
+// PeerExportRes 导出客户端清单响应 (CSV / JSON 文件)
+type PeerExportRes struct{}
+
 // PeerConfigReq 获取客户端配置请求
 type PeerConfigReq struct {
 	g.Meta `path:"/peers/{id}/config" method:"get" tags:"WireGuard" summary:"获取客户端配置文件"`
-	Id     int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+	InterfaceScope
+	Id   int  `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+	Next bool `json:"next"` // 获取服务端密钥轮换后的配置
 }
 
 // PeerConfigRes 获取客户端配置响应
@@ -189,7 +381,9 @@ type PeerConfigRes struct {
 // PeerQRCodeReq 获取客户端二维码请求
 type PeerQRCodeReq struct {
 	g.Meta `path:"/peers/{id}/qrcode" method:"get" tags:"WireGuard" summary:"获取客户端配置二维码"`
-	Id     int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+	InterfaceScope
+	Id   int  `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+	Next bool `json:"next"` // 获取服务端密钥轮换后的配置
 }
 
 // PeerQRCodeRes 获取客户端二维码响应
@@ -197,11 +391,196 @@ type PeerQRCodeRes struct {
 	QRCode string `json:"qrcode"` // Base64 编码的 PNG 图片
 }
 
+// PeerPresharedKeyReq 生成或轮换客户端预共享密钥请求
+type PeerPresharedKeyReq struct {
+	g.Meta `path:"/peers/{id}/psk" method:"post" tags:"WireGuard" summary:"生成/轮换客户端预共享密钥"`
+	InterfaceScope
+	Id int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+}
+
+// PeerPresharedKeyRes 生成或轮换客户端预共享密钥响应
+type PeerPresharedKeyRes struct {
+	Success bool `json:"success"`
+}
+
+// PeerPresharedKeyDeleteReq 移除客户端预共享密钥请求
+type PeerPresharedKeyDeleteReq struct {
+	g.Meta `path:"/peers/{id}/psk" method:"delete" tags:"WireGuard" summary:"移除客户端预共享密钥"`
+	InterfaceScope
+	Id int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+}
+
+// PeerPresharedKeyDeleteRes 移除客户端预共享密钥响应
+type PeerPresharedKeyDeleteRes struct {
+	Success bool `json:"success"`
+}
+
+// PeerEndpointsReq 获取客户端 Endpoint 历史请求
+type PeerEndpointsReq struct {
+	g.Meta `path:"/peers/{id}/endpoints" method:"get" tags:"WireGuard" summary:"获取客户端Endpoint历史"`
+	InterfaceScope
+	Id int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+}
+
+// EndpointInfo Endpoint 历史记录
+type EndpointInfo struct {
+	Endpoint  string `json:"endpoint"`
+	FirstSeen string `json:"firstSeen"`
+	LastSeen  string `json:"lastSeen"`
+	Events    int    `json:"events"` // 该 Endpoint 下记录的连接事件数
+}
+
+// PeerEndpointsRes 获取客户端 Endpoint 历史响应
+type PeerEndpointsRes struct {
+	Current string          `json:"current"` // 当前 Endpoint，未连接时为空
+	History []*EndpointInfo `json:"history"`
+}
+
+// ===================== UAPI 配置漂移 =====================
+
+// DriftInfo 设备与 OmniWire 配置之间的差异 (通过 wg set 等工具直接修改设备产生)
+type DriftInfo struct {
+	Kind            string `json:"kind"` // unknown=设备上多出的客户端, missing=设备上缺失的客户端, allowed_ips / preshared_key=配置不一致
+	PublicKey       string `json:"publicKey"`
+	Name            string `json:"name"`            // OmniWire 中的名称，不存在时为空
+	AllowedIPs      string `json:"allowedIPs"`      // 设备上的 AllowedIPs
+	HasPresharedKey bool   `json:"hasPresharedKey"` // 设备上是否设置了预共享密钥
+}
+
+// DriftReq 获取配置漂移请求
+type DriftReq struct {
+	g.Meta `path:"/drift" method:"get" tags:"WireGuard" summary:"获取UAPI配置漂移"`
+	InterfaceScope
+}
+
+// DriftRes 获取配置漂移响应
+type DriftRes struct {
+	UAPI   bool         `json:"uapi"` // UAPI 套接字是否已开放
+	Drifts []*DriftInfo `json:"drifts"`
+}
+
+// DriftReconcileReq 将设备上的修改写回数据库请求
+type DriftReconcileReq struct {
+	g.Meta `path:"/drift/reconcile" method:"post" tags:"WireGuard" summary:"将UAPI修改同步到数据库"`
+	InterfaceScope
+}
+
+// DriftReconcileRes 将设备上的修改写回数据库响应
+type DriftReconcileRes struct {
+	Reconciled int `json:"reconciled"`
+}
+
+// ===================== 配置导入 =====================
+
+// ImportReq 导入 wg-quick 配置请求
+type ImportReq struct {
+	g.Meta `path:"/import" method:"post" tags:"WireGuard" summary:"导入 wg-quick 配置"`
+	InterfaceScope
+	Config  string   `json:"config" v:"required#配置内容必填"` // 服务端配置，如 /etc/wireguard/wg0.conf 的内容
+	Clients []string `json:"clients"`                    // 可选：客户端配置内容，提供后对应客户端可在 OmniWire 中下载配置
+}
+
+// ImportRes 导入 wg-quick 配置响应
+type ImportRes struct {
+	Imported int      `json:"imported"` // 导入的客户端数量
+	External int      `json:"external"` // 其中无私钥的外部客户端数量
+	Skipped  int      `json:"skipped"`  // 公钥已存在而跳过的数量
+	Warnings []string `json:"warnings"`
+}
+
+// ===================== 客户端分组 =====================
+
+// PeerGroupInfo 客户端分组信息
+type PeerGroupInfo struct {
+	Id               int    `json:"id"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	ClientAllowedIPs string `json:"clientAllowedIPs"` // 组内客户端的 AllowedIPs，为空使用全局配置
+	DNS              string `json:"dns"`              // 组内客户端的 DNS，为空使用全局配置
+	UploadLimit      int64  `json:"uploadLimit"`      // 组内未单独设置限速的客户端的上传限速 (bytes/s)
+	DownloadLimit    int64  `json:"downloadLimit"`    // 组内未单独设置限速的客户端的下载限速 (bytes/s)
+	PeerCount        int    `json:"peerCount"`        // 当前接口下的组内客户端数量
+	CreatedAt        string `json:"createdAt"`
+	UpdatedAt        string `json:"updatedAt"`
+}
+
+// PeerGroupListReq 获取分组列表请求 (分组在所有接口间共享)
+type PeerGroupListReq struct {
+	g.Meta `path:"/peer-groups" method:"get" tags:"WireGuard" summary:"获取客户端分组列表"`
+	InterfaceScope
+}
+
+// PeerGroupListRes 获取分组列表响应
+type PeerGroupListRes struct {
+	Groups []*PeerGroupInfo `json:"groups"`
+}
+
+// PeerGroupCreateReq 创建分组请求
+type PeerGroupCreateReq struct {
+	g.Meta `path:"/peer-groups" method:"post" tags:"WireGuard" summary:"创建客户端分组"`
+	InterfaceScope
+	Name             string `json:"name" v:"required#分组名称必填"`
+	Description      string `json:"description"`
+	ClientAllowedIPs string `json:"clientAllowedIPs"`
+	DNS              string `json:"dns"`
+	UploadLimit      int64  `json:"uploadLimit" d:"0"`
+	DownloadLimit    int64  `json:"downloadLimit" d:"0"`
+}
+
+// PeerGroupCreateRes 创建分组响应
+type PeerGroupCreateRes struct {
+	Group *PeerGroupInfo `json:"group"`
+}
+
+// PeerGroupUpdateReq 更新分组请求
+type PeerGroupUpdateReq struct {
+	g.Meta `path:"/peer-groups/{id}" method:"put" tags:"WireGuard" summary:"更新客户端分组"`
+	InterfaceScope
+	Id               int    `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+	Name             string `json:"name" v:"required#分组名称必填"`
+	Description      string `json:"description"`
+	ClientAllowedIPs string `json:"clientAllowedIPs"`
+	DNS              string `json:"dns"`
+	UploadLimit      int64  `json:"uploadLimit" d:"0"`
+	DownloadLimit    int64  `json:"downloadLimit" d:"0"`
+}
+
+// PeerGroupUpdateRes 更新分组响应
+type PeerGroupUpdateRes struct {
+	Success bool `json:"success"`
+}
+
+// PeerGroupDeleteReq 删除分组请求 (组内客户端移至未分组)
+type PeerGroupDeleteReq struct {
+	g.Meta `path:"/peer-groups/{id}" method:"delete" tags:"WireGuard" summary:"删除客户端分组"`
+	InterfaceScope
+	Id int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+}
+
+// PeerGroupDeleteRes 删除分组响应
+type PeerGroupDeleteRes struct {
+	Success bool `json:"success"`
+}
+
+// PeerGroupBatchReq 按分组批量操作客户端请求
+type PeerGroupBatchReq struct {
+	g.Meta `path:"/peer-groups/{id}/batch" method:"post" tags:"WireGuard" summary:"按分组批量启用/禁用/删除客户端"`
+	InterfaceScope
+	Id     int    `json:"id" in:"path" v:"required|min:0#ID无效"` // 0 表示未分组的客户端
+	Action string `json:"action" v:"required|in:enable,disable,delete#操作必填|操作应为 enable、disable 或 delete"`
+}
+
+// PeerGroupBatchRes 按分组批量操作客户端响应
+type PeerGroupBatchRes struct {
+	Affected int `json:"affected"`
+}
+
 // ===================== 连接日志 =====================
 
 // ConnectionLogsReq 获取连接日志请求
 type ConnectionLogsReq struct {
-	g.Meta   `path:"/connection-logs" method:"get" tags:"WireGuard" summary:"获取客户端连接日志"`
+	g.Meta `path:"/connection-logs" method:"get" tags:"WireGuard" summary:"获取客户端连接日志"`
+	InterfaceScope
 	PeerId   int `json:"peerId" in:"query"`
 	Page     int `json:"page" in:"query" d:"1"`
 	PageSize int `json:"pageSize" in:"query" d:"20"`
@@ -224,3 +603,260 @@ type ConnectionLogsRes struct {
 	Total int                  `json:"total"`
 	Page  int                  `json:"page"`
 }
+
+// ===================== 服务端密钥轮换 =====================
+
+// KeyRotationInfo 密钥轮换记录
+type KeyRotationInfo struct {
+	Id           int    `json:"id"`
+	OldPublicKey string `json:"oldPublicKey"`
+	NewPublicKey string `json:"newPublicKey"`
+	Status       string `json:"status"`      // pending: 分发中 | completed: 已切换 | cancelled: 已取消
+	ScheduledAt  string `json:"scheduledAt"` // 计划切换时间
+	CompletedAt  string `json:"completedAt"` // 实际切换 / 取消时间
+	Operator     string `json:"operator"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+// KeyRotationListReq 获取密钥轮换记录请求
+type KeyRotationListReq struct {
+	g.Meta `path:"/key-rotations" method:"get" tags:"WireGuard" summary:"获取服务端密钥轮换记录"`
+	InterfaceScope
+}
+
+// KeyRotationListRes 获取密钥轮换记录响应
+type KeyRotationListRes struct {
+	List []*KeyRotationInfo `json:"list"`
+}
+
+// KeyRotationCreateReq 发起密钥轮换请求
+// 生成新密钥后，分发期内可通过 /peers/{id}/config?next=true 下载新配置，到达 switchAt 时自动切换
+type KeyRotationCreateReq struct {
+	g.Meta `path:"/key-rotations" method:"post" tags:"WireGuard" summary:"发起服务端密钥轮换"`
+	InterfaceScope
+	SwitchAt string `json:"switchAt" v:"required|datetime#切换时间必填|切换时间格式应为 YYYY-MM-DD HH:mm:ss"` // 须晚于当前时间至少 10 分钟
+}
+
+// KeyRotationCreateRes 发起密钥轮换响应
+type KeyRotationCreateRes struct {
+	Rotation *KeyRotationInfo `json:"rotation"`
+}
+
+// KeyRotationApplyReq 立即切换密钥请求
+type KeyRotationApplyReq struct {
+	g.Meta `path:"/key-rotations/{id}/apply" method:"post" tags:"WireGuard" summary:"立即切换服务端密钥"`
+	InterfaceScope
+	Id int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+}
+
+// KeyRotationApplyRes 立即切换密钥响应
+type KeyRotationApplyRes struct {
+	Success bool `json:"success"`
+}
+
+// KeyRotationCancelReq 取消密钥轮换请求
+type KeyRotationCancelReq struct {
+	g.Meta `path:"/key-rotations/{id}" method:"delete" tags:"WireGuard" summary:"取消服务端密钥轮换"`
+	InterfaceScope
+	Id int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+}
+
+// KeyRotationCancelRes 取消密钥轮换响应
+type KeyRotationCancelRes struct {
+	Success bool `json:"success"`
+}
+
+// ===================== 访问控制 =====================
+
+// ACLRuleInfo 访问控制规则信息
+type ACLRuleInfo struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name"`
+	Priority      int    `json:"priority"`      // 越小越先匹配，相同时按创建顺序
+	Action        string `json:"action"`        // allow | deny
+	SourcePeerId  int    `json:"sourcePeerId"`  // 来源客户端，0=不限
+	SourceGroupId int    `json:"sourceGroupId"` // 来源分组，0=不限
+	Destination   string `json:"destination"`   // 逗号分隔的目的网段，为空表示任意
+	Protocol      string `json:"protocol"`      // tcp | udp | icmp，为空表示任意
+	Port          string `json:"port"`          // 目的端口或范围，如 443、8000-8100
+	Enabled       bool   `json:"enabled"`
+	Hits          uint64 `json:"hits"` // 自服务启动起的命中次数
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+// ACLReq 获取访问控制策略请求
+type ACLReq struct {
+	g.Meta `path:"/acl" method:"get" tags:"WireGuard" summary:"获取隧道内访问控制策略与规则"`
+	InterfaceScope
+}
+
+// ACLRes 获取访问控制策略响应
+type ACLRes struct {
+	Policy      string         `json:"policy"`      // allow: 未命中规则时放行 | isolate: 未命中规则时禁止客户端互访
+	DefaultHits uint64         `json:"defaultHits"` // 默认策略丢弃的数据包数
+	Rules       []*ACLRuleInfo `json:"rules"`
+}
+
+// ACLPolicyReq 设置默认策略请求
+type ACLPolicyReq struct {
+	g.Meta `path:"/acl/policy" method:"put" tags:"WireGuard" summary:"设置隧道内访问控制默认策略"`
+	InterfaceScope
+	Policy string `json:"policy" v:"required|in:allow,isolate#默认策略必填|默认策略只能为 allow 或 isolate"`
+}
+
+// ACLPolicyRes 设置默认策略响应
+type ACLPolicyRes struct {
+	Success bool `json:"success"`
+}
+
+// ACLRuleCreateReq 创建访问控制规则请求
+type ACLRuleCreateReq struct {
+	g.Meta `path:"/acl/rules" method:"post" tags:"WireGuard" summary:"创建访问控制规则"`
+	InterfaceScope
+	Name          string `json:"name"`
+	Priority      int    `json:"priority" d:"100"`
+	Action        string `json:"action" v:"required|in:allow,deny#规则动作必填|规则动作只能为 allow 或 deny"`
+	SourcePeerId  int    `json:"sourcePeerId" d:"0"`
+	SourceGroupId int    `json:"sourceGroupId" d:"0"`
+	Destination   string `json:"destination"`
+	Protocol      string `json:"protocol"`
+	Port          string `json:"port"`
+	Enabled       bool   `json:"enabled" d:"true"`
+}
+
+// ACLRuleCreateRes 创建访问控制规则响应
+type ACLRuleCreateRes struct {
+	Id int `json:"id"`
+}
+
+// ACLRuleUpdateReq 更新访问控制规则请求
+type ACLRuleUpdateReq struct {
+	g.Meta `path:"/acl/rules/{id}" method:"put" tags:"WireGuard" summary:"更新访问控制规则"`
+	InterfaceScope
+	Id            int    `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+	Name          string `json:"name"`
+	Priority      int    `json:"priority" d:"100"`
+	Action        string `json:"action" v:"required|in:allow,deny#规则动作必填|规则动作只能为 allow 或 deny"`
+	SourcePeerId  int    `json:"sourcePeerId" d:"0"`
+	SourceGroupId int    `json:"sourceGroupId" d:"0"`
+	Destination   string `json:"destination"`
+	Protocol      string `json:"protocol"`
+	Port          string `json:"port"`
+	Enabled       bool   `json:"enabled" d:"true"`
+}
+
+// ACLRuleUpdateRes 更新访问控制规则响应
+type ACLRuleUpdateRes struct {
+	Success bool `json:"success"`
+}
+
+// ACLRuleDeleteReq 删除访问控制规则请求
+type ACLRuleDeleteReq struct {
+	g.Meta `path:"/acl/rules/{id}" method:"delete" tags:"WireGuard" summary:"删除访问控制规则"`
+	InterfaceScope
+	Id int `json:"id" in:"path" v:"required|min:1#ID必填|ID无效"`
+}
+
+// ACLRuleDeleteRes 删除访问控制规则响应
+type ACLRuleDeleteRes struct {
+	Success bool `json:"success"`
+}
+
+// ===================== 内置 DNS =====================
+
+// DNSRecord 内置 DNS 解析记录
+type DNSRecord struct {
+	Name   string   `json:"name"`   // 完整域名，如 laptop.vpn
+	Addrs  []string `json:"addrs"`  // 隧道地址
+	Source string   `json:"source"` // wireguard | openvpn
+}
+
+// DNSStats 内置 DNS 请求计数 (所有接口合计，自服务启动起)
+type DNSStats struct {
+	Queries   uint64 `json:"queries"`
+	Local     uint64 `json:"local"`     // 客户端名称应答
+	Blocked   uint64 `json:"blocked"`   // 命中拦截列表
+	Forwarded uint64 `json:"forwarded"` // 转发上游成功
+	Failed    uint64 `json:"failed"`    // 上游无响应
+}
+
+// DNSReq 获取内置 DNS 状态请求
+type DNSReq struct {
+	g.Meta `path:"/dns" method:"get" tags:"WireGuard" summary:"获取内置DNS状态与解析记录"`
+	InterfaceScope
+}
+
+// DNSRes 获取内置 DNS 状态响应
+type DNSRes struct {
+	Enabled  bool         `json:"enabled"`  // 接口是否开启内置 DNS
+	Listen   []string     `json:"listen"`   // 正在监听的地址，服务未运行时为空
+	Domain   string       `json:"domain"`   // 客户端名称所在的域
+	Upstream []string     `json:"upstream"` // 默认上游
+	Stats    DNSStats     `json:"stats"`
+	Records  []*DNSRecord `json:"records"`
+}
+
+// ===================== 设备日志 =====================
+
+// DeviceLogReq 获取 wireguard-go 设备日志请求
+type DeviceLogReq struct {
+	g.Meta `path:"/logs" method:"get" tags:"WireGuard" summary:"获取WireGuard设备日志"`
+	InterfaceScope
+	After uint64 `json:"after" in:"query" d:"0"`                // 只返回序号大于该值的日志，用于增量获取
+	Limit int    `json:"limit" in:"query" d:"200" v:"max:1000"` // 最多返回最新的条数
+}
+
+// DeviceLogEntry 设备日志
+type DeviceLogEntry struct {
+	Seq     uint64 `json:"seq"`
+	Time    string `json:"time"`
+	Level   string `json:"level"` // error | verbose
+	Message string `json:"message"`
+}
+
+// DeviceLogRes 获取设备日志响应
+type DeviceLogRes struct {
+	LogLevel string            `json:"logLevel"` // 当前生效的日志等级
+	LastSeq  uint64            `json:"lastSeq"`  // 下次增量获取时作为 after 传入
+	Logs     []*DeviceLogEntry `json:"logs"`
+}
+
+// ===================== 握手诊断 =====================
+
+// RejectedHandshakeInfo 被拒绝的握手 (同一来源 IP、客户端公钥与原因合并为一条)
+type RejectedHandshakeInfo struct {
+	Endpoint   string `json:"endpoint"`  // 最近一次的来源地址
+	PublicKey  string `json:"publicKey"` // 客户端公钥，服务端公钥不符或无法解密时为空
+	PeerId     int    `json:"peerId"`    // 对应的客户端，未知客户端为 0
+	PeerName   string `json:"peerName"`
+	Reason     string `json:"reason"` // wrong_server_key | invalid | unknown_peer | disabled_peer | stale_timestamp
+	Hint       string `json:"hint"`   // 原因说明与排查建议
+	Count      uint64 `json:"count"`
+	FirstSeen  string `json:"firstSeen"`
+	LastSeen   string `json:"lastSeen"`
+	ClientTime string `json:"clientTime"` // 握手包中的客户端时间，仅 stale_timestamp 时有值
+}
+
+// RejectedHandshakesReq 获取被拒绝的握手请求
+type RejectedHandshakesReq struct {
+	g.Meta `path:"/handshakes/rejected" method:"get" tags:"WireGuard" summary:"获取被拒绝的握手"`
+	InterfaceScope
+}
+
+// RejectedHandshakesRes 获取被拒绝的握手响应
+type RejectedHandshakesRes struct {
+	List    []*RejectedHandshakeInfo `json:"list"`
+	Enabled bool                     `json:"enabled"` // 接口运行中且开启了 handshakeDiagnostics
+}
+
+// RejectedHandshakesClearReq 清空被拒绝的握手记录请求
+type RejectedHandshakesClearReq struct {
+	g.Meta `path:"/handshakes/rejected" method:"delete" tags:"WireGuard" summary:"清空被拒绝的握手记录"`
+	InterfaceScope
+}
+
+// RejectedHandshakesClearRes 清空被拒绝的握手记录响应
+type RejectedHandshakesClearRes struct {
+	Success bool `json:"success"`
+}
@@ -23,6 +23,7 @@ import (
 	"omniwire/internal/controller/system"
 	"omniwire/internal/controller/wireguard"
 	"omniwire/internal/packed"
+	"omniwire/internal/service/dnsserver"
 	forwardService "omniwire/internal/service/forward"
 	openvpnService "omniwire/internal/service/openvpn"
 	wireguardService "omniwire/internal/service/wireguard"
@@ -70,6 +71,9 @@ var (
 			// 初始化端口转发规则（自动启动已启用的规则）
 			forwardService.InitForwardRules(ctx)
 
+			// 初始化内置 DNS（开启内置 DNS 的接口启动时在隧道地址上监听）
+			dnsserver.Init(ctx)
+
 			// 初始化 WireGuard 服务（根据配置自动启动）
 			wireguardService.InitWireGuard(ctx)
 
@@ -130,7 +134,11 @@ var (
 				})
 
 				// WireGuard 管理接口
+				// 未指定接口的旧路由作用于默认接口
 				group.Group("/wireguard", func(group *ghttp.RouterGroup) {
+					group.Bind(wireguard.NewV1(), wireguard.NewInterfaceV1())
+				})
+				group.Group("/wireguard/interfaces/{interfaceId}", func(group *ghttp.RouterGroup) {
 					group.Bind(wireguard.NewV1())
 				})
 
@@ -283,6 +291,9 @@ func printRoutes() {
 	fmt.Println("    PUT  /api/v1/wireguard/config  - 更新配置")
 	fmt.Println("    GET  /api/v1/wireguard/peers   - 获取客户端列表")
 	fmt.Println("    POST /api/v1/wireguard/peers   - 创建客户端")
+	fmt.Println("    GET  /api/v1/wireguard/interfaces - 获取接口列表")
+	fmt.Println("    POST /api/v1/wireguard/interfaces - 新建接口")
+	fmt.Println("    *    /api/v1/wireguard/interfaces/:interfaceId/... - 指定接口的上述操作")
 	fmt.Println("")
 	fmt.Println("  端口转发:")
 	fmt.Println("    GET  /api/v1/forward           - 获取转发规则列表")
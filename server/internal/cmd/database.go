@@ -49,13 +49,46 @@ func InitDatabase(ctx context.Context) error {
 			private_key VARCHAR(255) NOT NULL,
 			preshared_key VARCHAR(255),
 			allowed_ips VARCHAR(255) NOT NULL,
+			routed_networks TEXT DEFAULT '',
 			endpoint VARCHAR(255),
-			persistent_keepalive INTEGER DEFAULT 25,
+			persistent_keepalive INTEGER DEFAULT -1,
 			enabled INTEGER DEFAULT 1,
 			upload_limit INTEGER DEFAULT 0,
 			download_limit INTEGER DEFAULT 0,
 			total_upload INTEGER DEFAULT 0,
 			total_download INTEGER DEFAULT 0,
+			expires_at DATETIME,
+			quota_bytes INTEGER DEFAULT 0,
+			quota_reset_day INTEGER DEFAULT 1,
+			quota_action VARCHAR(20) DEFAULT 'disable',
+			quota_throttle_rate INTEGER DEFAULT 0,
+			quota_base INTEGER DEFAULT 0,
+			quota_period_start DATETIME,
+			quota_warned INTEGER DEFAULT 0,
+			quota_exceeded INTEGER DEFAULT 0,
+			throttle_rate INTEGER DEFAULT 0,
+			group_id INTEGER DEFAULT 0,
+			tags TEXT DEFAULT '',
+			external INTEGER DEFAULT 0,
+			interface_id INTEGER DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 创建 WireGuard 客户端分组表
+	_, err = g.DB().Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS wireguard_peer_group (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name VARCHAR(100) NOT NULL UNIQUE,
+			description TEXT DEFAULT '',
+			client_allowed_ips TEXT DEFAULT '',
+			dns VARCHAR(255) DEFAULT '',
+			upload_limit INTEGER DEFAULT 0,
+			download_limit INTEGER DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)
@@ -131,10 +164,33 @@ func InitDatabase(ctx context.Context) error {
 		return err
 	}
 
+	// 创建 WireGuard 隧道内访问控制规则表 (按 priority、id 顺序匹配)
+	_, err = g.DB().Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS wireguard_acl_rule (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			interface_id INTEGER DEFAULT 1,
+			name VARCHAR(100) DEFAULT '',
+			priority INTEGER DEFAULT 100,
+			action VARCHAR(10) DEFAULT 'allow',
+			source_peer_id INTEGER DEFAULT 0,
+			source_group_id INTEGER DEFAULT 0,
+			destination TEXT DEFAULT '',
+			protocol VARCHAR(10) DEFAULT '',
+			port VARCHAR(20) DEFAULT '',
+			enabled INTEGER DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
 	// 创建 WireGuard 连接日志表
 	_, err = g.DB().Exec(ctx, `
 		CREATE TABLE IF NOT EXISTS wireguard_connection_log (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			interface_id INTEGER DEFAULT 1,
 			peer_id INTEGER,
 			peer_name VARCHAR(100),
 			public_key VARCHAR(255),
@@ -149,12 +205,124 @@ func InitDatabase(ctx context.Context) error {
 		return err
 	}
 
+	// 创建 WireGuard 服务端密钥轮换记录表
+	_, err = g.DB().Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS wireguard_key_rotation (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			interface_id INTEGER DEFAULT 1,
+			old_public_key VARCHAR(255),
+			new_private_key VARCHAR(255) NOT NULL,
+			new_public_key VARCHAR(255) NOT NULL,
+			status VARCHAR(20) DEFAULT 'pending',
+			scheduled_at DATETIME,
+			completed_at DATETIME,
+			operator VARCHAR(100),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
 	// 为已存在的 wireguard_config 表添加 auto_start 字段（兼容旧数据库）
 	hasAutoStart, _ := g.DB().GetValue(ctx, `SELECT COUNT(*) FROM pragma_table_info('wireguard_config') WHERE name='auto_start'`)
 	if hasAutoStart.Int() == 0 {
 		_, _ = g.DB().Exec(ctx, `ALTER TABLE wireguard_config ADD COLUMN auto_start INTEGER DEFAULT 0`)
 	}
 
+	// 为已存在的 wireguard_config 表添加 mode 字段（tun / netstack）
+	hasMode, _ := g.DB().GetValue(ctx, `SELECT COUNT(*) FROM pragma_table_info('wireguard_config') WHERE name='mode'`)
+	if hasMode.Int() == 0 {
+		_, _ = g.DB().Exec(ctx, `ALTER TABLE wireguard_config ADD COLUMN mode VARCHAR(20) DEFAULT 'tun'`)
+	}
+
+	// 为已存在的 wireguard_config 表添加 uapi 字段（是否开放 wg 工具使用的 UAPI 套接字）
+	hasUAPI, _ := g.DB().GetValue(ctx, `SELECT COUNT(*) FROM pragma_table_info('wireguard_config') WHERE name='uapi'`)
+	if hasUAPI.Int() == 0 {
+		_, _ = g.DB().Exec(ctx, `ALTER TABLE wireguard_config ADD COLUMN uapi INTEGER DEFAULT 0`)
+	}
+
+	// 为已存在的 wireguard_config 表添加 PostUp / PostDown 钩子字段
+	configColumns := []struct{ name, def string }{
+		{"post_up", "TEXT DEFAULT ''"},
+		{"post_down", "TEXT DEFAULT ''"},
+		{"hook_timeout", "INTEGER DEFAULT 30"},
+		{"post_up_rollback", "INTEGER DEFAULT 0"},
+		{"acl_policy", "VARCHAR(20) DEFAULT 'allow'"},
+		{"builtin_dns", "INTEGER DEFAULT 0"},
+		{"handshake_diagnostics", "INTEGER DEFAULT 0"},
+	}
+	for _, col := range configColumns {
+		has, _ := g.DB().GetValue(ctx, `SELECT COUNT(*) FROM pragma_table_info('wireguard_config') WHERE name=?`, col.name)
+		if has.Int() == 0 {
+			_, _ = g.DB().Exec(ctx, `ALTER TABLE wireguard_config ADD COLUMN `+col.name+` `+col.def)
+		}
+	}
+
+	// 多接口：连接日志与密钥轮换记录归属于接口，旧数据属于默认接口
+	for _, table := range []string{"wireguard_connection_log", "wireguard_key_rotation"} {
+		has, _ := g.DB().GetValue(ctx, `SELECT COUNT(*) FROM pragma_table_info('`+table+`') WHERE name='interface_id'`)
+		if has.Int() == 0 {
+			_, _ = g.DB().Exec(ctx, `ALTER TABLE `+table+` ADD COLUMN interface_id INTEGER DEFAULT 1`)
+		}
+	}
+
+	// 为已存在的 wireguard_peer 表添加 routed_networks 字段（站点互联路由网段）
+	hasRoutedNetworks, _ := g.DB().GetValue(ctx, `SELECT COUNT(*) FROM pragma_table_info('wireguard_peer') WHERE name='routed_networks'`)
+	if hasRoutedNetworks.Int() == 0 {
+		_, _ = g.DB().Exec(ctx, `ALTER TABLE wireguard_peer ADD COLUMN routed_networks TEXT DEFAULT ''`)
+	}
+
+	// 为已存在的 wireguard_peer 表添加 expires_at 字段（临时访问到期时间）
+	hasExpiresAt, _ := g.DB().GetValue(ctx, `SELECT COUNT(*) FROM pragma_table_info('wireguard_peer') WHERE name='expires_at'`)
+	if hasExpiresAt.Int() == 0 {
+		_, _ = g.DB().Exec(ctx, `ALTER TABLE wireguard_peer ADD COLUMN expires_at DATETIME`)
+	}
+
+	// 迁移：为 wireguard_peer 添加流量配额、分组与标签相关列
+	peerColumns := []struct{ name, def string }{
+		{"quota_bytes", "INTEGER DEFAULT 0"},
+		{"quota_reset_day", "INTEGER DEFAULT 1"},
+		{"quota_action", "VARCHAR(20) DEFAULT 'disable'"},
+		{"quota_throttle_rate", "INTEGER DEFAULT 0"},
+		{"quota_base", "INTEGER DEFAULT 0"},
+		{"quota_period_start", "DATETIME"},
+		{"quota_warned", "INTEGER DEFAULT 0"},
+		{"quota_exceeded", "INTEGER DEFAULT 0"},
+		{"throttle_rate", "INTEGER DEFAULT 0"},
+		{"group_id", "INTEGER DEFAULT 0"},
+		{"tags", "TEXT DEFAULT ''"},
+		{"external", "INTEGER DEFAULT 0"},
+		{"interface_id", "INTEGER DEFAULT 1"},
+	}
+	for _, col := range peerColumns {
+		has, _ := g.DB().GetValue(ctx, `SELECT COUNT(*) FROM pragma_table_info('wireguard_peer') WHERE name=?`, col.name)
+		if has.Int() == 0 {
+			_, _ = g.DB().Exec(ctx, `ALTER TABLE wireguard_peer ADD COLUMN `+col.name+` `+col.def)
+		}
+	}
+
+	// 迁移：旧版本不使用客户端的 persistent_keepalive (建表默认值 25)，
+	// 改为 -1 以继承全局配置；旧表无法修改列默认值，新增客户端均显式写入该列。通过 user_version 保证只执行一次
+	schemaVersion, _ := g.DB().GetValue(ctx, `PRAGMA user_version`)
+	if schemaVersion.Int() < 1 {
+		if _, err := g.DB().Exec(ctx, `UPDATE wireguard_peer SET persistent_keepalive = -1 WHERE persistent_keepalive = 25`); err != nil {
+			return err
+		}
+		_, _ = g.DB().Exec(ctx, `PRAGMA user_version = 1`)
+	}
+	// 迁移：旧版本在创建或移入分组时把分组限速复制到客户端，现改为运行时继承 (客户端为 0 时使用分组限速)，
+	// 与分组一致的复制值清零，以便修改分组或移出分组后生效
+	if schemaVersion.Int() < 2 {
+		for _, col := range []string{"upload_limit", "download_limit"} {
+			if _, err := g.DB().Exec(ctx, `UPDATE wireguard_peer SET `+col+` = 0 WHERE group_id > 0 AND `+col+` > 0 AND `+col+
+				` = (SELECT `+col+` FROM wireguard_peer_group WHERE wireguard_peer_group.id = wireguard_peer.group_id)`); err != nil {
+				return err
+			}
+		}
+		_, _ = g.DB().Exec(ctx, `PRAGMA user_version = 2`)
+	}
+
 	// 插入默认管理员（如果不存在）
 	count, _ := g.DB().Model("user").Where("username", "admin").Count()
 	if count == 0 {
@@ -97,6 +97,7 @@ func (c *ControllerV1) UserList(ctx context.Context, req *openvpn.UserListReq) (
 			Enabled:     u.Enabled == 1,
 			Online:      u.Online == 1,
 			IP:          u.IP,
+			StaticIP:    u.StaticIP,
 			ConnectedAt: u.ConnectedAt,
 			CreatedAt:   u.CreatedAt,
 			RxBytes:     u.RxBytes,
@@ -107,17 +108,17 @@ func (c *ControllerV1) UserList(ctx context.Context, req *openvpn.UserListReq) (
 }
 
 func (c *ControllerV1) UserCreate(ctx context.Context, req *openvpn.UserCreateReq) (res *openvpn.UserCreateRes, err error) {
-	u, err := svc.CreateUser(ctx, req.Username, req.Password)
+	u, err := svc.CreateUser(ctx, req.Username, req.Password, req.StaticIP)
 	if err != nil {
 		return nil, err
 	}
 	return &openvpn.UserCreateRes{User: &openvpn.UserInfo{
-		Id: u.Id, Username: u.Username, Enabled: true,
+		Id: u.Id, Username: u.Username, Enabled: true, StaticIP: u.StaticIP,
 	}}, nil
 }
 
 func (c *ControllerV1) UserUpdate(ctx context.Context, req *openvpn.UserUpdateReq) (res *openvpn.UserUpdateRes, err error) {
-	if err = svc.UpdateUser(ctx, req.Id, req.Password, req.Enabled); err != nil {
+	if err = svc.UpdateUser(ctx, req.Id, req.Password, req.StaticIP, req.Enabled); err != nil {
 		return nil, err
 	}
 	return &openvpn.UserUpdateRes{Success: true}, nil
@@ -40,11 +40,13 @@ func (c *ControllerV1) Info(ctx context.Context, req *system.InfoReq) (res *syst
 func (c *ControllerV1) Dashboard(ctx context.Context, req *system.DashboardReq) (res *system.DashboardRes, err error) {
 	res = &system.DashboardRes{}
 
-	// WireGuard 状态
-	if wgserver.GetServer() != nil && wgserver.GetServer().IsRunning() {
-		res.WireguardStatus = "running"
-	} else {
-		res.WireguardStatus = "stopped"
+	// WireGuard 状态：任一接口运行即视为运行中
+	res.WireguardStatus = "stopped"
+	for _, server := range wgserver.Servers() {
+		if server.IsRunning() {
+			res.WireguardStatus = "running"
+			break
+		}
 	}
 
 	// 从数据库获取真实数据
@@ -0,0 +1,54 @@
+// ==========================================================================
+// OmniWire - WireGuard 接口管理控制器
+// 接口本身的增删查不属于任何接口作用域，单独绑定在 /wireguard 下
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+
+	"omniwire/api/v1/wireguard"
+	svcWireguard "omniwire/internal/service/wireguard"
+)
+
+// ControllerInterfaceV1 WireGuard 接口管理控制器
+type ControllerInterfaceV1 struct{}
+
+// NewInterfaceV1 创建 WireGuard 接口管理控制器实例
+func NewInterfaceV1() *ControllerInterfaceV1 {
+	return &ControllerInterfaceV1{}
+}
+
+// InterfaceList 获取接口列表
+func (c *ControllerInterfaceV1) InterfaceList(ctx context.Context, req *wireguard.InterfaceListReq) (res *wireguard.InterfaceListRes, err error) {
+	list, err := svcWireguard.GetInterfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &wireguard.InterfaceListRes{Interfaces: list}, nil
+}
+
+// InterfaceCreate 新建接口
+func (c *ControllerInterfaceV1) InterfaceCreate(ctx context.Context, req *wireguard.InterfaceCreateReq) (res *wireguard.InterfaceCreateRes, err error) {
+	id, err := svcWireguard.CreateInterface(ctx, &svcWireguard.InterfaceInput{
+		Name:            req.Name,
+		ListenPort:      req.ListenPort,
+		Address:         req.Address,
+		DNS:             req.DNS,
+		EndpointAddress: req.EndpointAddress,
+		Mode:            req.Mode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &wireguard.InterfaceCreateRes{Id: id}, nil
+}
+
+// InterfaceDelete 删除接口
+func (c *ControllerInterfaceV1) InterfaceDelete(ctx context.Context, req *wireguard.InterfaceDeleteReq) (res *wireguard.InterfaceDeleteRes, err error) {
+	if err = svcWireguard.DeleteInterface(ctx, req.Id); err != nil {
+		return nil, err
+	}
+	return &wireguard.InterfaceDeleteRes{Success: true}, nil
+}
@@ -6,8 +6,10 @@ package wireguard
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
 
 	"omniwire/api/v1/wireguard"
 	svcWireguard "omniwire/internal/service/wireguard"
@@ -23,23 +25,32 @@ func NewV1() *ControllerV1 {
 
 // Status WireGuard 服务状态
 func (c *ControllerV1) Status(ctx context.Context, req *wireguard.StatusReq) (res *wireguard.StatusRes, err error) {
-	status, err := svcWireguard.Status(ctx)
+	status, err := svcWireguard.Status(ctx, req.InterfaceId)
 	if err != nil {
 		return nil, err
 	}
 	res = &wireguard.StatusRes{
-		Running:    status.Running,
-		Interface:  status.Interface,
-		ListenPort: status.ListenPort,
-		PublicKey:  status.PublicKey,
-		PeerCount:  status.PeerCount,
+		InterfaceId: req.InterfaceId,
+		Running:     status.Running,
+		Interface:   status.Interface,
+		ListenPort:  status.ListenPort,
+		PublicKey:   status.PublicKey,
+		PeerCount:   status.PeerCount,
+		Mode:        status.Mode,
+	}
+	if status.NAT != nil {
+		res.Nat = &wireguard.NatInfo{
+			Backend:      status.NAT.Backend,
+			OutInterface: status.NAT.OutInterface,
+			Subnets:      status.NAT.Subnets,
+		}
 	}
 	return
 }
 
 // Start 启动 WireGuard 服务
 func (c *ControllerV1) Start(ctx context.Context, req *wireguard.StartReq) (res *wireguard.StartRes, err error) {
-	err = svcWireguard.Start(ctx)
+	err = svcWireguard.Start(ctx, req.InterfaceId)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +61,7 @@ func (c *ControllerV1) Start(ctx context.Context, req *wireguard.StartReq) (res
 
 // Stop 停止 WireGuard 服务
 func (c *ControllerV1) Stop(ctx context.Context, req *wireguard.StopReq) (res *wireguard.StopRes, err error) {
-	err = svcWireguard.Stop(ctx)
+	err = svcWireguard.Stop(ctx, req.InterfaceId)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +72,7 @@ func (c *ControllerV1) Stop(ctx context.Context, req *wireguard.StopReq) (res *w
 
 // Restart 重启 WireGuard 服务
 func (c *ControllerV1) Restart(ctx context.Context, req *wireguard.RestartReq) (res *wireguard.RestartRes, err error) {
-	err = svcWireguard.Restart(ctx)
+	err = svcWireguard.Restart(ctx, req.InterfaceId)
 	if err != nil {
 		return nil, err
 	}
@@ -72,11 +83,12 @@ func (c *ControllerV1) Restart(ctx context.Context, req *wireguard.RestartReq) (
 
 // Config 获取 WireGuard 配置
 func (c *ControllerV1) Config(ctx context.Context, req *wireguard.ConfigReq) (res *wireguard.ConfigRes, err error) {
-	config, err := svcWireguard.GetConfig(ctx)
+	config, err := svcWireguard.GetConfig(ctx, req.InterfaceId)
 	if err != nil {
 		return nil, err
 	}
 	res = &wireguard.ConfigRes{
+		InterfaceId:         config.Id,
 		Interface:           config.Interface,
 		ListenPort:          config.ListenPort,
 		PrivateKey:          config.PrivateKey,
@@ -93,13 +105,19 @@ func (c *ControllerV1) Config(ctx context.Context, req *wireguard.ConfigReq) (re
 		ProxyAddress:        config.ProxyAddress,
 		LogLevel:            config.LogLevel,
 		AutoStart:           config.AutoStart,
+		Mode:                config.Mode,
+		UAPI:                config.UAPI,
+		HookTimeout:         config.HookTimeout,
+		PostUpRollback:      config.PostUpRollback,
+		BuiltinDNS:          config.BuiltinDNS,
+		HandshakeDiag:       config.HandshakeDiag,
 	}
 	return
 }
 
 // UpdateConfig 更新 WireGuard 配置
 func (c *ControllerV1) UpdateConfig(ctx context.Context, req *wireguard.UpdateConfigReq) (res *wireguard.UpdateConfigRes, err error) {
-	err = svcWireguard.UpdateConfig(ctx, &svcWireguard.ConfigInput{
+	result, err := svcWireguard.UpdateConfig(ctx, req.InterfaceId, &svcWireguard.ConfigInput{
 		ListenPort:          req.ListenPort,
 		EndpointAddress:     req.EndpointAddress,
 		Address:             req.Address,
@@ -111,18 +129,47 @@ func (c *ControllerV1) UpdateConfig(ctx context.Context, req *wireguard.UpdateCo
 		ProxyAddress:        req.ProxyAddress,
 		LogLevel:            req.LogLevel,
 		AutoStart:           req.AutoStart,
+		Mode:                req.Mode,
+		UAPI:                req.UAPI,
+		PostUp:              req.PostUp,
+		PostDown:            req.PostDown,
+		HookTimeout:         req.HookTimeout,
+		PostUpRollback:      req.PostUpRollback,
+		BuiltinDNS:          req.BuiltinDNS,
+		HandshakeDiag:       req.HandshakeDiag,
 	})
 	if err != nil {
 		return nil, err
 	}
-	res = &wireguard.UpdateConfigRes{Success: true}
+	res = &wireguard.UpdateConfigRes{Success: true, Applied: result.Path, Changes: result.Changes}
 	g.Log().Info(ctx, "WireGuard 配置已更新")
 	return
 }
 
+// HookResults 获取 PostUp / PostDown 执行结果
+func (c *ControllerV1) HookResults(ctx context.Context, req *wireguard.HookResultsReq) (res *wireguard.HookResultsRes, err error) {
+	results, err := svcWireguard.GetHookResults(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.HookResultsRes{Results: make([]*wireguard.HookResult, 0, len(results))}
+	for _, r := range results {
+		res.Results = append(res.Results, &wireguard.HookResult{
+			Hook:       r.Hook,
+			Command:    r.Command,
+			Output:     r.Output,
+			ExitCode:   r.ExitCode,
+			Error:      r.Error,
+			DurationMs: r.Duration.Milliseconds(),
+			RanAt:      gtime.New(r.RanAt).String(),
+		})
+	}
+	return
+}
+
 // PeerList 获取客户端列表
 func (c *ControllerV1) PeerList(ctx context.Context, req *wireguard.PeerListReq) (res *wireguard.PeerListRes, err error) {
-	peers, err := svcWireguard.GetPeers(ctx)
+	peers, err := svcWireguard.GetPeers(ctx, req.InterfaceId, req.GroupId, req.Tag)
 	if err != nil {
 		return nil, err
 	}
@@ -134,22 +181,49 @@ func (c *ControllerV1) PeerList(ctx context.Context, req *wireguard.PeerListReq)
 
 // PeerCreate 创建客户端
 func (c *ControllerV1) PeerCreate(ctx context.Context, req *wireguard.PeerCreateReq) (res *wireguard.PeerCreateRes, err error) {
-	peer, err := svcWireguard.CreatePeer(ctx, &svcWireguard.PeerInput{
-		Name:       req.Name,
-		AllowedIPs: req.AllowedIPs,
+	peer, err := svcWireguard.CreatePeer(ctx, req.InterfaceId, &svcWireguard.PeerInput{
+		Name:              req.Name,
+		AllowedIPs:        req.AllowedIPs,
+		UploadLimit:       req.UploadLimit,
+		DownloadLimit:     req.DownloadLimit,
+		Endpoint:          req.StaticEndpoint,
+		Keepalive:         req.PersistentKeepalive,
+		RoutedNetworks:    req.RoutedNetworks,
+		ExpiresAt:         req.ExpiresAt,
+		QuotaBytes:        req.QuotaBytes,
+		QuotaResetDay:     req.QuotaResetDay,
+		QuotaAction:       req.QuotaAction,
+		QuotaThrottleRate: req.QuotaThrottleRate,
+		GroupId:           &req.GroupId,
+		Tags:              &req.Tags,
+		PublicKey:         &req.PublicKey,
 	})
 	if err != nil {
 		return nil, err
 	}
 	res = &wireguard.PeerCreateRes{
 		Peer: &wireguard.PeerInfo{
-			Id:         peer.Id,
-			Name:       peer.Name,
-			PublicKey:  peer.PublicKey,
-			AllowedIPs: peer.AllowedIps,
-			Enabled:    peer.Enabled == 1,
-			CreatedAt:  peer.CreatedAt.String(),
-			UpdatedAt:  peer.UpdatedAt.String(),
+			Id:                  peer.Id,
+			Name:                peer.Name,
+			PublicKey:           peer.PublicKey,
+			AllowedIPs:          peer.AllowedIps,
+			RoutedNetworks:      peer.RoutedNetworks,
+			UploadLimit:         peer.UploadLimit,
+			DownloadLimit:       peer.DownloadLimit,
+			Enabled:             peer.Enabled == 1,
+			StaticEndpoint:      peer.Endpoint,
+			PersistentKeepalive: peer.Keepalive,
+			ExpiresAt:           peer.ExpiresAt.String(),
+			RemainingSeconds:    svcWireguard.RemainingSeconds(peer.ExpiresAt),
+			QuotaBytes:          peer.QuotaBytes,
+			QuotaResetDay:       peer.QuotaResetDay,
+			QuotaAction:         peer.QuotaAction,
+			QuotaThrottleRate:   peer.QuotaThrottleRate,
+			GroupId:             peer.GroupId,
+			Tags:                peer.Tags,
+			External:            peer.External == 1,
+			CreatedAt:           peer.CreatedAt.String(),
+			UpdatedAt:           peer.UpdatedAt.String(),
 		},
 	}
 	g.Log().Infof(ctx, "客户端 %s 已创建", req.Name)
@@ -158,10 +232,23 @@ func (c *ControllerV1) PeerCreate(ctx context.Context, req *wireguard.PeerCreate
 
 // PeerUpdate 更新客户端
 func (c *ControllerV1) PeerUpdate(ctx context.Context, req *wireguard.PeerUpdateReq) (res *wireguard.PeerUpdateRes, err error) {
-	err = svcWireguard.UpdatePeer(ctx, req.Id, &svcWireguard.PeerInput{
-		Name:       req.Name,
-		AllowedIPs: req.AllowedIPs,
-		Enabled:    req.Enabled,
+	err = svcWireguard.UpdatePeer(ctx, req.InterfaceId, req.Id, &svcWireguard.PeerInput{
+		Name:              req.Name,
+		AllowedIPs:        req.AllowedIPs,
+		Enabled:           req.Enabled,
+		UploadLimit:       req.UploadLimit,
+		DownloadLimit:     req.DownloadLimit,
+		Endpoint:          req.StaticEndpoint,
+		Keepalive:         req.PersistentKeepalive,
+		RoutedNetworks:    req.RoutedNetworks,
+		ExpiresAt:         req.ExpiresAt,
+		QuotaBytes:        req.QuotaBytes,
+		QuotaResetDay:     req.QuotaResetDay,
+		QuotaAction:       req.QuotaAction,
+		QuotaThrottleRate: req.QuotaThrottleRate,
+		GroupId:           req.GroupId,
+		Tags:              req.Tags,
+		PublicKey:         req.PublicKey,
 	})
 	if err != nil {
 		return nil, err
@@ -173,7 +260,7 @@ func (c *ControllerV1) PeerUpdate(ctx context.Context, req *wireguard.PeerUpdate
 
 // PeerDelete 删除客户端
 func (c *ControllerV1) PeerDelete(ctx context.Context, req *wireguard.PeerDeleteReq) (res *wireguard.PeerDeleteRes, err error) {
-	err = svcWireguard.DeletePeer(ctx, req.Id)
+	err = svcWireguard.DeletePeer(ctx, req.InterfaceId, req.Id)
 	if err != nil {
 		return nil, err
 	}
@@ -182,9 +269,63 @@ func (c *ControllerV1) PeerDelete(ctx context.Context, req *wireguard.PeerDelete
 	return
 }
 
+// PeerBatchCreate 批量创建客户端并下载配置压缩包
+func (c *ControllerV1) PeerBatchCreate(ctx context.Context, req *wireguard.PeerBatchCreateReq) (res *wireguard.PeerBatchCreateRes, err error) {
+	var inputs []*svcWireguard.PeerInput
+	if req.Csv != "" {
+		if inputs, err = svcWireguard.ParsePeerCSV(req.Csv); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range req.Peers {
+		inputs = append(inputs, &svcWireguard.PeerInput{Name: item.Name, AllowedIPs: item.AllowedIPs})
+	}
+	for _, input := range inputs {
+		input.UploadLimit = req.UploadLimit
+		input.DownloadLimit = req.DownloadLimit
+		input.ExpiresAt = req.ExpiresAt
+		input.GroupId = &req.GroupId
+		input.Tags = &req.Tags
+	}
+
+	peers, err := svcWireguard.BatchCreatePeers(ctx, req.InterfaceId, inputs)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := svcWireguard.BuildPeerArchive(ctx, peers)
+	if err != nil {
+		return nil, err
+	}
+	writeFile(ctx, "wireguard-peers.zip", "application/zip", archive)
+	g.Log().Infof(ctx, "已批量创建 %d 个客户端", len(peers))
+	return
+}
+
+// PeerExport 导出客户端清单
+func (c *ControllerV1) PeerExport(ctx context.Context, req *wireguard.PeerExportReq) (res *wireguard.PeerExportRes, err error) {
+	data, err := svcWireguard.ExportPeers(ctx, req.InterfaceId, req.Format)
+	if err != nil {
+		return nil, err
+	}
+	contentType := "text/csv; charset=utf-8"
+	if req.Format == svcWireguard.ExportJSON {
+		contentType = "application/json"
+	}
+	writeFile(ctx, "wireguard-peers."+req.Format, contentType, data)
+	return
+}
+
+// writeFile 以附件形式输出文件，已写入内容时 MiddlewareHandlerResponse 不再包装 JSON
+func writeFile(ctx context.Context, filename, contentType string, data []byte) {
+	r := g.RequestFromCtx(ctx)
+	r.Response.Header().Set("Content-Type", contentType)
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	r.Response.Write(data)
+}
+
 // PeerConfig 获取客户端配置文件
 func (c *ControllerV1) PeerConfig(ctx context.Context, req *wireguard.PeerConfigReq) (res *wireguard.PeerConfigRes, err error) {
-	config, err := svcWireguard.GetPeerConfig(ctx, req.Id)
+	config, err := svcWireguard.GetPeerConfig(ctx, req.InterfaceId, req.Id, req.Next)
 	if err != nil {
 		return nil, err
 	}
@@ -196,7 +337,7 @@ func (c *ControllerV1) PeerConfig(ctx context.Context, req *wireguard.PeerConfig
 
 // PeerQRCode 获取客户端配置二维码
 func (c *ControllerV1) PeerQRCode(ctx context.Context, req *wireguard.PeerQRCodeReq) (res *wireguard.PeerQRCodeRes, err error) {
-	qrcode, err := svcWireguard.GetPeerQRCode(ctx, req.Id)
+	qrcode, err := svcWireguard.GetPeerQRCode(ctx, req.InterfaceId, req.Id, req.Next)
 	if err != nil {
 		return nil, err
 	}
@@ -206,9 +347,40 @@ func (c *ControllerV1) PeerQRCode(ctx context.Context, req *wireguard.PeerQRCode
 	return
 }
 
+// PeerPresharedKey 生成或轮换客户端预共享密钥
+func (c *ControllerV1) PeerPresharedKey(ctx context.Context, req *wireguard.PeerPresharedKeyReq) (res *wireguard.PeerPresharedKeyRes, err error) {
+	if err = svcWireguard.RotatePeerPresharedKey(ctx, req.InterfaceId, req.Id); err != nil {
+		return nil, err
+	}
+	res = &wireguard.PeerPresharedKeyRes{Success: true}
+	return
+}
+
+// PeerPresharedKeyDelete 移除客户端预共享密钥
+func (c *ControllerV1) PeerPresharedKeyDelete(ctx context.Context, req *wireguard.PeerPresharedKeyDeleteReq) (res *wireguard.PeerPresharedKeyDeleteRes, err error) {
+	if err = svcWireguard.RemovePeerPresharedKey(ctx, req.InterfaceId, req.Id); err != nil {
+		return nil, err
+	}
+	res = &wireguard.PeerPresharedKeyDeleteRes{Success: true}
+	return
+}
+
+// PeerEndpoints 获取客户端 Endpoint 历史
+func (c *ControllerV1) PeerEndpoints(ctx context.Context, req *wireguard.PeerEndpointsReq) (res *wireguard.PeerEndpointsRes, err error) {
+	current, history, err := svcWireguard.GetPeerEndpoints(ctx, req.InterfaceId, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.PeerEndpointsRes{
+		Current: current,
+		History: history,
+	}
+	return
+}
+
 // ConnectionLogs 获取连接日志
 func (c *ControllerV1) ConnectionLogs(ctx context.Context, req *wireguard.ConnectionLogsReq) (res *wireguard.ConnectionLogsRes, err error) {
-	list, total, err := svcWireguard.GetConnectionLogs(ctx, req.PeerId, req.Page, req.PageSize)
+	list, total, err := svcWireguard.GetConnectionLogs(ctx, req.InterfaceId, req.PeerId, req.Page, req.PageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -219,3 +391,251 @@ func (c *ControllerV1) ConnectionLogs(ctx context.Context, req *wireguard.Connec
 	}
 	return
 }
+
+// KeyRotationList 获取服务端密钥轮换记录
+func (c *ControllerV1) KeyRotationList(ctx context.Context, req *wireguard.KeyRotationListReq) (res *wireguard.KeyRotationListRes, err error) {
+	list, err := svcWireguard.GetKeyRotations(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.KeyRotationListRes{List: list}
+	return
+}
+
+// KeyRotationCreate 发起服务端密钥轮换
+func (c *ControllerV1) KeyRotationCreate(ctx context.Context, req *wireguard.KeyRotationCreateReq) (res *wireguard.KeyRotationCreateRes, err error) {
+	switchAt, err := gtime.StrToTime(req.SwitchAt)
+	if err != nil {
+		return nil, err
+	}
+	operator := g.RequestFromCtx(ctx).GetCtxVar("username").String()
+	rotation, err := svcWireguard.CreateKeyRotation(ctx, req.InterfaceId, switchAt.Time, operator)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.KeyRotationCreateRes{Rotation: rotation}
+	return
+}
+
+// KeyRotationApply 立即切换服务端密钥
+func (c *ControllerV1) KeyRotationApply(ctx context.Context, req *wireguard.KeyRotationApplyReq) (res *wireguard.KeyRotationApplyRes, err error) {
+	if err = svcWireguard.ApplyKeyRotation(ctx, req.InterfaceId, req.Id); err != nil {
+		return nil, err
+	}
+	res = &wireguard.KeyRotationApplyRes{Success: true}
+	return
+}
+
+// KeyRotationCancel 取消服务端密钥轮换
+func (c *ControllerV1) KeyRotationCancel(ctx context.Context, req *wireguard.KeyRotationCancelReq) (res *wireguard.KeyRotationCancelRes, err error) {
+	operator := g.RequestFromCtx(ctx).GetCtxVar("username").String()
+	if err = svcWireguard.CancelKeyRotation(ctx, req.InterfaceId, req.Id, operator); err != nil {
+		return nil, err
+	}
+	res = &wireguard.KeyRotationCancelRes{Success: true}
+	return
+}
+
+// Drift 获取 UAPI 配置漂移
+func (c *ControllerV1) Drift(ctx context.Context, req *wireguard.DriftReq) (res *wireguard.DriftRes, err error) {
+	drifts, err := svcWireguard.GetDrift(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.DriftRes{UAPI: svcWireguard.UAPIEnabled(ctx, req.InterfaceId), Drifts: drifts}
+	return
+}
+
+// DriftReconcile 将设备上的修改同步到数据库
+func (c *ControllerV1) DriftReconcile(ctx context.Context, req *wireguard.DriftReconcileReq) (res *wireguard.DriftReconcileRes, err error) {
+	count, err := svcWireguard.ReconcileDrift(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.DriftReconcileRes{Reconciled: count}
+	g.Log().Infof(ctx, "已同步 %d 项 UAPI 配置漂移", count)
+	return
+}
+
+// Import 导入 wg-quick 配置
+func (c *ControllerV1) Import(ctx context.Context, req *wireguard.ImportReq) (res *wireguard.ImportRes, err error) {
+	result, err := svcWireguard.ImportWgQuick(ctx, req.InterfaceId, &svcWireguard.ImportInput{
+		Config:  req.Config,
+		Clients: req.Clients,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.ImportRes{
+		Imported: result.Imported,
+		External: result.External,
+		Skipped:  result.Skipped,
+		Warnings: result.Warnings,
+	}
+	return
+}
+
+// PeerGroupList 获取客户端分组列表
+func (c *ControllerV1) PeerGroupList(ctx context.Context, req *wireguard.PeerGroupListReq) (res *wireguard.PeerGroupListRes, err error) {
+	groups, err := svcWireguard.GetGroups(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.PeerGroupListRes{Groups: groups}
+	return
+}
+
+// PeerGroupCreate 创建客户端分组
+func (c *ControllerV1) PeerGroupCreate(ctx context.Context, req *wireguard.PeerGroupCreateReq) (res *wireguard.PeerGroupCreateRes, err error) {
+	group, err := svcWireguard.CreateGroup(ctx, &svcWireguard.GroupInput{
+		Name:             req.Name,
+		Description:      req.Description,
+		ClientAllowedIPs: req.ClientAllowedIPs,
+		DNS:              req.DNS,
+		UploadLimit:      req.UploadLimit,
+		DownloadLimit:    req.DownloadLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.PeerGroupCreateRes{Group: group}
+	return
+}
+
+// PeerGroupUpdate 更新客户端分组
+func (c *ControllerV1) PeerGroupUpdate(ctx context.Context, req *wireguard.PeerGroupUpdateReq) (res *wireguard.PeerGroupUpdateRes, err error) {
+	err = svcWireguard.UpdateGroup(ctx, req.Id, &svcWireguard.GroupInput{
+		Name:             req.Name,
+		Description:      req.Description,
+		ClientAllowedIPs: req.ClientAllowedIPs,
+		DNS:              req.DNS,
+		UploadLimit:      req.UploadLimit,
+		DownloadLimit:    req.DownloadLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.PeerGroupUpdateRes{Success: true}
+	return
+}
+
+// PeerGroupDelete 删除客户端分组
+func (c *ControllerV1) PeerGroupDelete(ctx context.Context, req *wireguard.PeerGroupDeleteReq) (res *wireguard.PeerGroupDeleteRes, err error) {
+	if err = svcWireguard.DeleteGroup(ctx, req.Id); err != nil {
+		return nil, err
+	}
+	res = &wireguard.PeerGroupDeleteRes{Success: true}
+	return
+}
+
+// PeerGroupBatch 按分组批量操作客户端
+func (c *ControllerV1) PeerGroupBatch(ctx context.Context, req *wireguard.PeerGroupBatchReq) (res *wireguard.PeerGroupBatchRes, err error) {
+	affected, err := svcWireguard.BatchGroupPeers(ctx, req.InterfaceId, req.Id, req.Action)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.PeerGroupBatchRes{Affected: affected}
+	g.Log().Infof(ctx, "分组 %d 批量 %s 客户端: %d 个", req.Id, req.Action, affected)
+	return
+}
+
+// ACL 获取隧道内访问控制策略与规则
+func (c *ControllerV1) ACL(ctx context.Context, req *wireguard.ACLReq) (res *wireguard.ACLRes, err error) {
+	acl, err := svcWireguard.GetACL(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.ACLRes{
+		Policy:      acl.Policy,
+		DefaultHits: acl.DefaultHits,
+		Rules:       acl.Rules,
+	}
+	return
+}
+
+// ACLPolicy 设置隧道内访问控制默认策略
+func (c *ControllerV1) ACLPolicy(ctx context.Context, req *wireguard.ACLPolicyReq) (res *wireguard.ACLPolicyRes, err error) {
+	if err = svcWireguard.SetACLPolicy(ctx, req.InterfaceId, req.Policy); err != nil {
+		return nil, err
+	}
+	res = &wireguard.ACLPolicyRes{Success: true}
+	return
+}
+
+// ACLRuleCreate 创建访问控制规则
+func (c *ControllerV1) ACLRuleCreate(ctx context.Context, req *wireguard.ACLRuleCreateReq) (res *wireguard.ACLRuleCreateRes, err error) {
+	id, err := svcWireguard.CreateACLRule(ctx, req.InterfaceId, &svcWireguard.ACLRuleInput{
+		Name:          req.Name,
+		Priority:      req.Priority,
+		Action:        req.Action,
+		SourcePeerId:  req.SourcePeerId,
+		SourceGroupId: req.SourceGroupId,
+		Destination:   req.Destination,
+		Protocol:      req.Protocol,
+		Port:          req.Port,
+		Enabled:       req.Enabled,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.ACLRuleCreateRes{Id: id}
+	return
+}
+
+// ACLRuleUpdate 更新访问控制规则
+func (c *ControllerV1) ACLRuleUpdate(ctx context.Context, req *wireguard.ACLRuleUpdateReq) (res *wireguard.ACLRuleUpdateRes, err error) {
+	err = svcWireguard.UpdateACLRule(ctx, req.InterfaceId, req.Id, &svcWireguard.ACLRuleInput{
+		Name:          req.Name,
+		Priority:      req.Priority,
+		Action:        req.Action,
+		SourcePeerId:  req.SourcePeerId,
+		SourceGroupId: req.SourceGroupId,
+		Destination:   req.Destination,
+		Protocol:      req.Protocol,
+		Port:          req.Port,
+		Enabled:       req.Enabled,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.ACLRuleUpdateRes{Success: true}
+	return
+}
+
+// ACLRuleDelete 删除访问控制规则
+func (c *ControllerV1) ACLRuleDelete(ctx context.Context, req *wireguard.ACLRuleDeleteReq) (res *wireguard.ACLRuleDeleteRes, err error) {
+	if err = svcWireguard.DeleteACLRule(ctx, req.InterfaceId, req.Id); err != nil {
+		return nil, err
+	}
+	res = &wireguard.ACLRuleDeleteRes{Success: true}
+	return
+}
+
+// DNS 获取内置 DNS 状态与解析记录
+func (c *ControllerV1) DNS(ctx context.Context, req *wireguard.DNSReq) (res *wireguard.DNSRes, err error) {
+	return svcWireguard.GetDNS(ctx, req.InterfaceId)
+}
+
+// DeviceLogs 获取 WireGuard 设备日志
+func (c *ControllerV1) DeviceLogs(ctx context.Context, req *wireguard.DeviceLogReq) (res *wireguard.DeviceLogRes, err error) {
+	return svcWireguard.GetDeviceLogs(ctx, req.InterfaceId, req.After, req.Limit)
+}
+
+// RejectedHandshakes 获取被拒绝的握手
+func (c *ControllerV1) RejectedHandshakes(ctx context.Context, req *wireguard.RejectedHandshakesReq) (res *wireguard.RejectedHandshakesRes, err error) {
+	list, err := svcWireguard.GetRejectedHandshakes(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	res = &wireguard.RejectedHandshakesRes{List: list, Enabled: svcWireguard.HandshakeDiagEnabled(req.InterfaceId)}
+	return
+}
+
+// RejectedHandshakesClear 清空被拒绝的握手记录
+func (c *ControllerV1) RejectedHandshakesClear(ctx context.Context, req *wireguard.RejectedHandshakesClearReq) (res *wireguard.RejectedHandshakesClearRes, err error) {
+	if err = svcWireguard.ClearRejectedHandshakes(ctx, req.InterfaceId); err != nil {
+		return nil, err
+	}
+	res = &wireguard.RejectedHandshakesClearRes{Success: true}
+	return
+}
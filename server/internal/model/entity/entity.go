@@ -8,16 +8,65 @@ import "github.com/gogf/gf/v2/os/gtime"
 
 // WireguardPeer WireGuard 客户端
 type WireguardPeer struct {
+	Id             int         `json:"id" orm:"id"`
+	Name           string      `json:"name" orm:"name"`
+	PublicKey      string      `json:"publicKey" orm:"public_key"`
+	PrivateKey     string      `json:"privateKey" orm:"private_key"`
+	PresharedKey   string      `json:"presharedKey" orm:"preshared_key"` // 预共享密钥 (Base64)，为空表示未启用
+	AllowedIps     string      `json:"allowedIps" orm:"allowed_ips"`
+	RoutedNetworks string      `json:"routedNetworks" orm:"routed_networks"`           // Peer 后方的局域网网段 (站点互联)，逗号分隔
+	Endpoint       string      `json:"endpoint" orm:"endpoint"`                        // 对端地址 host:port (站点互联)，为空表示等待对端连接
+	Keepalive      int         `json:"persistentKeepalive" orm:"persistent_keepalive"` // 秒，<0 继承全局配置，0 关闭
+	Enabled        int         `json:"enabled" orm:"enabled"`
+	UploadLimit    int64       `json:"uploadLimit" orm:"upload_limit"`     // 上传速率限制 (bytes/s), 0=使用分组限速 (未分组时无限制)
+	DownloadLimit  int64       `json:"downloadLimit" orm:"download_limit"` // 下载速率限制 (bytes/s), 0=使用分组限速 (未分组时无限制)
+	TotalUpload    int64       `json:"totalUpload" orm:"total_upload"`     // 历史总上传流量
+	TotalDownload  int64       `json:"totalDownload" orm:"total_download"` // 历史总下载流量
+	ExpiresAt      *gtime.Time `json:"expiresAt" orm:"expires_at"`         // 到期时间，为空表示永不过期
+	// 月度流量配额 (上传 + 下载)
+	QuotaBytes        int64       `json:"quotaBytes" orm:"quota_bytes"`                // 每周期配额 (bytes)，0=不限
+	QuotaResetDay     int         `json:"quotaResetDay" orm:"quota_reset_day"`         // 每月重置日 (1-28)
+	QuotaAction       string      `json:"quotaAction" orm:"quota_action"`              // 超额处理: disable | throttle
+	QuotaThrottleRate int64       `json:"quotaThrottleRate" orm:"quota_throttle_rate"` // 超额后限速 (bytes/s)
+	QuotaBase         int64       `json:"quotaBase" orm:"quota_base"`                  // 本周期开始时的历史总流量
+	QuotaPeriodStart  *gtime.Time `json:"quotaPeriodStart" orm:"quota_period_start"`   // 本周期开始时间
+	QuotaWarned       int         `json:"quotaWarned" orm:"quota_warned"`              // 本周期已预警的最高阈值 (%)
+	QuotaExceeded     int         `json:"quotaExceeded" orm:"quota_exceeded"`          // 本周期是否已超额
+	ThrottleRate      int64       `json:"throttleRate" orm:"throttle_rate"`            // 当前生效的超额限速 (bytes/s)，0=未限速
+	GroupId           int         `json:"groupId" orm:"group_id"`                      // 所属分组，0=未分组
+	Tags              string      `json:"tags" orm:"tags"`                             // 标签，逗号分隔
+	External          int         `json:"external" orm:"external"`                     // 服务端不保存私钥 (客户端自行生成或外部导入)
+	InterfaceId       int         `json:"interfaceId" orm:"interface_id"`              // 所属接口 (wireguard_config.id)
+	CreatedAt         *gtime.Time `json:"createdAt" orm:"created_at"`
+	UpdatedAt         *gtime.Time `json:"updatedAt" orm:"updated_at"`
+}
+
+// WireguardPeerGroup WireGuard 客户端分组，默认设置应用于组内客户端
+type WireguardPeerGroup struct {
+	Id               int         `json:"id" orm:"id"`
+	Name             string      `json:"name" orm:"name"`
+	Description      string      `json:"description" orm:"description"`
+	ClientAllowedIps string      `json:"clientAllowedIps" orm:"client_allowed_ips"` // 客户端 AllowedIPs，为空使用全局配置
+	Dns              string      `json:"dns" orm:"dns"`                             // 客户端 DNS，为空使用全局配置
+	UploadLimit      int64       `json:"uploadLimit" orm:"upload_limit"`            // 组内未单独设置限速的客户端的上传限速 (bytes/s)
+	DownloadLimit    int64       `json:"downloadLimit" orm:"download_limit"`        // 组内未单独设置限速的客户端的下载限速 (bytes/s)
+	CreatedAt        *gtime.Time `json:"createdAt" orm:"created_at"`
+	UpdatedAt        *gtime.Time `json:"updatedAt" orm:"updated_at"`
+}
+
+// WireguardAclRule 隧道内访问控制规则
+type WireguardAclRule struct {
 	Id            int         `json:"id" orm:"id"`
+	InterfaceId   int         `json:"interfaceId" orm:"interface_id"`
 	Name          string      `json:"name" orm:"name"`
-	PublicKey     string      `json:"publicKey" orm:"public_key"`
-	PrivateKey    string      `json:"privateKey" orm:"private_key"`
-	AllowedIps    string      `json:"allowedIps" orm:"allowed_ips"`
+	Priority      int         `json:"priority" orm:"priority"`             // 越小越先匹配
+	Action        string      `json:"action" orm:"action"`                 // allow | deny
+	SourcePeerId  int         `json:"sourcePeerId" orm:"source_peer_id"`   // 0=不限
+	SourceGroupId int         `json:"sourceGroupId" orm:"source_group_id"` // 0=不限
+	Destination   string      `json:"destination" orm:"destination"`       // 逗号分隔的目的网段，为空表示任意
+	Protocol      string      `json:"protocol" orm:"protocol"`             // tcp | udp | icmp，为空表示任意
+	Port          string      `json:"port" orm:"port"`                     // 目的端口或范围，如 "443"、"8000-8100"
 	Enabled       int         `json:"enabled" orm:"enabled"`
-	UploadLimit   int64       `json:"uploadLimit" orm:"upload_limit"`     // 上传速率限制 (bytes/s), 0=无限制
-	DownloadLimit int64       `json:"downloadLimit" orm:"download_limit"` // 下载速率限制 (bytes/s), 0=无限制
-	TotalUpload   int64       `json:"totalUpload" orm:"total_upload"`     // 历史总上传流量
-	TotalDownload int64       `json:"totalDownload" orm:"total_download"` // 历史总下载流量
 	CreatedAt     *gtime.Time `json:"createdAt" orm:"created_at"`
 	UpdatedAt     *gtime.Time `json:"updatedAt" orm:"updated_at"`
 }
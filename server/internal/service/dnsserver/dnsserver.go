@@ -0,0 +1,388 @@
+// ==========================================================================
+// OmniWire - VPN 客户端内置 DNS
+// <客户端名称>.<domain> 解析为 WireGuard 客户端 / OpenVPN 用户的隧道地址，
+// 指定域名后缀转发到对应的内网 DNS (split-horizon)，其余请求转发到上游 DNS；
+// 拦截列表中的域名 (含子域名) 返回 NXDOMAIN
+// ==========================================================================
+
+package dnsserver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	recordTTL       = 30               // 本地记录的 TTL (秒)
+	recordCacheTTL  = 10 * time.Second // 本地记录从数据库刷新的间隔
+	upstreamTimeout = 3 * time.Second
+	tcpIdleTimeout  = 10 * time.Second
+	maxUDPSize      = 4096
+)
+
+// 记录来源
+const (
+	SourceWireGuard = "wireguard"
+	SourceOpenVPN   = "openvpn"
+)
+
+// Zone 转发到指定上游的域名后缀
+type Zone struct {
+	Domain   string
+	Upstream []string
+}
+
+// Config 内置 DNS 配置
+type Config struct {
+	Domain    string   // 客户端名称所在的域，如 "vpn"
+	Upstream  []string // 默认上游，可省略端口
+	Zones     []Zone
+	Blocklist []string // 拦截的域名，子域名一并拦截
+}
+
+// Record 本地解析记录
+type Record struct {
+	Name   string // 完整域名，不含末尾的点 (数据源只需提供主机名)
+	Addrs  []netip.Addr
+	Source string // SourceWireGuard | SourceOpenVPN
+}
+
+// Stats 请求计数 (自进程启动起)
+type Stats struct {
+	Queries   uint64 // 收到的请求
+	Local     uint64 // 本地记录应答
+	Blocked   uint64 // 拦截
+	Forwarded uint64 // 转发上游成功
+	Failed    uint64 // 上游无响应
+}
+
+// Server 内置 DNS 服务，可同时服务多个接口的监听
+type Server struct {
+	domain    string
+	upstream  []string
+	zones     []Zone // 按后缀长度降序，优先匹配更具体的域名
+	blocklist map[string]bool
+	records   func(ctx context.Context) []Record
+
+	mu       sync.Mutex
+	cache    map[string]*Record
+	cachedAt time.Time
+
+	queries, local, blocked, forwarded, failed atomic.Uint64
+}
+
+// New 创建 DNS 服务，records 返回当前所有客户端记录 (名称为主机名，按 recordCacheTTL 缓存)
+func New(cfg Config, records func(ctx context.Context) []Record) *Server {
+	s := &Server{
+		domain:    normalizeDomain(cfg.Domain),
+		upstream:  upstreamAddrs(cfg.Upstream),
+		blocklist: make(map[string]bool),
+		records:   records,
+	}
+	for _, zone := range cfg.Zones {
+		if domain := normalizeDomain(zone.Domain); domain != "" {
+			s.zones = append(s.zones, Zone{Domain: domain, Upstream: upstreamAddrs(zone.Upstream)})
+		}
+	}
+	sort.SliceStable(s.zones, func(i, j int) bool { return len(s.zones[i].Domain) > len(s.zones[j].Domain) })
+	for _, domain := range cfg.Blocklist {
+		if domain = normalizeDomain(domain); domain != "" {
+			s.blocklist[domain] = true
+		}
+	}
+	return s
+}
+
+// Domain 客户端名称所在的域
+func (s *Server) Domain() string { return s.domain }
+
+// Upstream 默认上游
+func (s *Server) Upstream() []string { return s.upstream }
+
+// Stats 请求计数
+func (s *Server) Stats() Stats {
+	return Stats{
+		Queries:   s.queries.Load(),
+		Local:     s.local.Load(),
+		Blocked:   s.blocked.Load(),
+		Forwarded: s.forwarded.Load(),
+		Failed:    s.failed.Load(),
+	}
+}
+
+// Records 当前的本地解析记录 (按名称排序)
+func (s *Server) Records(ctx context.Context) []Record {
+	cache := s.recordCache(ctx)
+	records := make([]Record, 0, len(cache))
+	for _, r := range cache {
+		records = append(records, *r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records
+}
+
+// recordCache 以完整域名为键的记录，过期时从数据源刷新
+func (s *Server) recordCache(ctx context.Context) map[string]*Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache != nil && time.Since(s.cachedAt) < recordCacheTTL {
+		return s.cache
+	}
+	cache := make(map[string]*Record)
+	if s.records != nil && s.domain != "" {
+		for _, r := range s.records(ctx) {
+			if r.Name = normalizeDomain(r.Name); r.Name == "" {
+				continue
+			}
+			r.Name += "." + s.domain
+			if _, ok := cache[r.Name]; !ok {
+				// 重名时保留先出现的记录
+				cache[r.Name] = &r
+			}
+		}
+	}
+	s.cache = cache
+	s.cachedAt = time.Now()
+	return cache
+}
+
+// ServeUDP 处理 UDP 请求，连接关闭后返回
+func (s *Server) ServeUDP(conn net.PacketConn) {
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := append([]byte(nil), buf[:n]...)
+		go func() {
+			if resp := s.Handle(context.Background(), "udp", req); resp != nil {
+				_, _ = conn.WriteTo(resp, from)
+			}
+		}()
+	}
+}
+
+// ServeTCP 处理 TCP 请求 (RFC 1035 4.2.2 长度前缀)，监听关闭后返回
+func (s *Server) ServeTCP(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			for {
+				c.SetDeadline(time.Now().Add(tcpIdleTimeout))
+				req, err := readTCPMessage(c)
+				if err != nil {
+					return
+				}
+				resp := s.Handle(context.Background(), "tcp", req)
+				if resp == nil || writeTCPMessage(c, resp) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Handle 处理一条 DNS 请求，返回应答报文；无法解析的请求返回 nil (丢弃)
+func (s *Server) Handle(ctx context.Context, network string, req []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(req)
+	if err != nil || header.Response {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	s.queries.Add(1)
+	name := normalizeDomain(q.Name.String())
+
+	switch {
+	case s.isBlocked(name):
+		s.blocked.Add(1)
+		return s.reply(header, q, dnsmessage.RCodeNameError, nil, false)
+	case s.domain != "" && (name == s.domain || strings.HasSuffix(name, "."+s.domain)):
+		s.local.Add(1)
+		record := s.recordCache(ctx)[name]
+		if record == nil && name != s.domain {
+			return s.reply(header, q, dnsmessage.RCodeNameError, nil, true)
+		}
+		return s.reply(header, q, dnsmessage.RCodeSuccess, record, true)
+	}
+
+	for _, upstream := range s.upstreamFor(name) {
+		resp, err := exchange(network, upstream, req)
+		if err == nil {
+			s.forwarded.Add(1)
+			return resp
+		}
+		g.Log().Debugf(ctx, "[DNS] 上游 %s 查询 %s 失败: %v", upstream, name, err)
+	}
+	s.failed.Add(1)
+	return s.reply(header, q, dnsmessage.RCodeServerFailure, nil, false)
+}
+
+// isBlocked 域名或其上级域名在拦截列表中
+func (s *Server) isBlocked(name string) bool {
+	for name != "" {
+		if s.blocklist[name] {
+			return true
+		}
+		_, parent, ok := strings.Cut(name, ".")
+		if !ok {
+			return false
+		}
+		name = parent
+	}
+	return false
+}
+
+// upstreamFor 按 split-horizon 规则选择上游
+func (s *Server) upstreamFor(name string) []string {
+	for _, zone := range s.zones {
+		if name == zone.Domain || strings.HasSuffix(name, "."+zone.Domain) {
+			return zone.Upstream
+		}
+	}
+	return s.upstream
+}
+
+// reply 构造应答，record 非空时按查询类型返回 A / AAAA 记录，authoritative 表示本地域内的应答
+func (s *Server) reply(req dnsmessage.Header, q dnsmessage.Question, rcode dnsmessage.RCode, record *Record, authoritative bool) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 req.ID,
+		Response:           true,
+		Authoritative:      authoritative,
+		RecursionDesired:   req.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+	b.EnableCompression()
+	_ = b.StartQuestions()
+	_ = b.Question(q)
+	_ = b.StartAnswers()
+	if record != nil {
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: recordTTL}
+		for _, addr := range record.Addrs {
+			switch {
+			case q.Type == dnsmessage.TypeA && addr.Is4():
+				_ = b.AResource(rh, dnsmessage.AResource{A: addr.As4()})
+			case q.Type == dnsmessage.TypeAAAA && addr.Is6():
+				_ = b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: addr.As16()})
+			}
+		}
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// exchange 将原始请求转发到上游并返回应答，network 与客户端请求保持一致
+func exchange(network, upstream string, req []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	var resp []byte
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, req); err != nil {
+			return nil, err
+		}
+		if resp, err = readTCPMessage(conn); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, maxUDPSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp = buf[:n]
+	}
+	if len(resp) < 2 || resp[0] != req[0] || resp[1] != req[1] {
+		return nil, errors.New("应答 ID 不匹配")
+	}
+	return resp, nil
+}
+
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+// normalizeDomain 转为小写并去掉首尾的点
+func normalizeDomain(name string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// upstreamAddrs 为未指定端口的上游补充 53 端口
+func upstreamAddrs(list []string) []string {
+	addrs := make([]string, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(item); err == nil {
+			item = netip.AddrPortFrom(addr, 53).String()
+		}
+		addrs = append(addrs, item)
+	}
+	return addrs
+}
+
+// HostLabel 将客户端名称转换为可用的 DNS 标签：小写，字母数字以外的字符替换为 "-"
+func HostLabel(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else if b.Len() > 0 && !strings.HasSuffix(b.String(), "-") {
+			b.WriteByte('-')
+		}
+	}
+	label := strings.TrimRight(b.String(), "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return label
+}
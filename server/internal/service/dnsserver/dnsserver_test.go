@@ -0,0 +1,166 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func query(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 0x1234, RecursionDesired: true})
+	_ = b.StartQuestions()
+	if err := b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func parseReply(t *testing.T, resp []byte) (dnsmessage.Header, []dnsmessage.Resource) {
+	t.Helper()
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		t.Fatalf("unpack reply: %v", err)
+	}
+	return msg.Header, msg.Answers
+}
+
+// fakeUpstream 对所有请求返回固定 A 记录的上游
+func fakeUpstream(t *testing.T, addr [4]byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if msg.Unpack(buf[:n]) != nil {
+				continue
+			}
+			msg.Response = true
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: msg.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: addr},
+			}}
+			resp, _ := msg.Pack()
+			conn.WriteTo(resp, from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestHandleLocalRecords(t *testing.T) {
+	s := New(Config{Domain: "VPN."}, func(context.Context) []Record {
+		return []Record{
+			{Name: "laptop", Addrs: []netip.Addr{netip.MustParseAddr("10.66.66.2"), netip.MustParseAddr("fd42::2")}, Source: SourceWireGuard},
+			{Name: "laptop", Addrs: []netip.Addr{netip.MustParseAddr("10.8.0.9")}, Source: SourceOpenVPN},
+		}
+	})
+	ctx := context.Background()
+
+	header, answers := parseReply(t, s.Handle(ctx, "udp", query(t, "Laptop.vpn.", dnsmessage.TypeA)))
+	if header.ID != 0x1234 || header.RCode != dnsmessage.RCodeSuccess || !header.Authoritative {
+		t.Fatalf("unexpected header: %+v", header)
+	}
+	if len(answers) != 1 || answers[0].Body.(*dnsmessage.AResource).A != [4]byte{10, 66, 66, 2} {
+		t.Fatalf("unexpected A answers: %+v", answers)
+	}
+
+	_, answers = parseReply(t, s.Handle(ctx, "udp", query(t, "laptop.vpn.", dnsmessage.TypeAAAA)))
+	if len(answers) != 1 || answers[0].Body.(*dnsmessage.AAAAResource).AAAA != netip.MustParseAddr("fd42::2").As16() {
+		t.Fatalf("unexpected AAAA answers: %+v", answers)
+	}
+
+	header, _ = parseReply(t, s.Handle(ctx, "udp", query(t, "unknown.vpn.", dnsmessage.TypeA)))
+	if header.RCode != dnsmessage.RCodeNameError {
+		t.Fatalf("unknown name rcode = %v, want NXDOMAIN", header.RCode)
+	}
+}
+
+func TestHandleBlocklistAndZones(t *testing.T) {
+	corp := fakeUpstream(t, [4]byte{10, 0, 0, 80})
+	public := fakeUpstream(t, [4]byte{1, 2, 3, 4})
+	s := New(Config{
+		Domain:    "vpn",
+		Upstream:  []string{public},
+		Zones:     []Zone{{Domain: "corp.example.com", Upstream: []string{corp}}},
+		Blocklist: []string{"ads.example.com"},
+	}, nil)
+	ctx := context.Background()
+
+	header, _ := parseReply(t, s.Handle(ctx, "udp", query(t, "tracker.ads.example.com.", dnsmessage.TypeA)))
+	if header.RCode != dnsmessage.RCodeNameError {
+		t.Fatalf("blocked rcode = %v, want NXDOMAIN", header.RCode)
+	}
+
+	_, answers := parseReply(t, s.Handle(ctx, "udp", query(t, "git.corp.example.com.", dnsmessage.TypeA)))
+	if len(answers) != 1 || answers[0].Body.(*dnsmessage.AResource).A != [4]byte{10, 0, 0, 80} {
+		t.Fatalf("split-horizon answer: %+v", answers)
+	}
+
+	_, answers = parseReply(t, s.Handle(ctx, "udp", query(t, "www.example.com.", dnsmessage.TypeA)))
+	if len(answers) != 1 || answers[0].Body.(*dnsmessage.AResource).A != [4]byte{1, 2, 3, 4} {
+		t.Fatalf("upstream answer: %+v", answers)
+	}
+
+	stats := s.Stats()
+	if stats.Queries != 3 || stats.Blocked != 1 || stats.Forwarded != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	s := New(Config{Domain: "vpn"}, func(context.Context) []Record {
+		return []Record{{Name: "nas", Addrs: []netip.Addr{netip.MustParseAddr("10.66.66.5")}}}
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.ServeTCP(l)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := writeTCPMessage(c, query(t, "nas.vpn.", dnsmessage.TypeA)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := readTCPMessage(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, answers := parseReply(t, resp); len(answers) != 1 {
+		t.Fatalf("unexpected answers: %+v", answers)
+	}
+}
+
+func TestHostLabel(t *testing.T) {
+	cases := map[string]string{
+		"Alice's Laptop": "alice-s-laptop",
+		"  web_01 ":      "web-01",
+		"办公室":            "",
+		"--x--":          "x",
+	}
+	for name, want := range cases {
+		if got := HostLabel(name); got != want {
+			t.Errorf("HostLabel(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
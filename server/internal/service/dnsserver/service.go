@@ -0,0 +1,124 @@
+// ==========================================================================
+// OmniWire - 内置 DNS 配置与客户端记录
+// ==========================================================================
+
+package dnsserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+var defaultServer = New(Config{Domain: "vpn", Upstream: []string{"223.5.5.5", "119.29.29.29"}}, loadRecords)
+
+// Default 全局内置 DNS 服务，各接口开启内置 DNS 时共用
+func Default() *Server {
+	return defaultServer
+}
+
+// Init 按配置文件 dns 段创建内置 DNS 服务，需在启动 WireGuard 之前调用
+func Init(ctx context.Context) {
+	cfg := Config{
+		Domain:    g.Cfg().MustGet(ctx, "dns.domain", "vpn").String(),
+		Upstream:  g.Cfg().MustGet(ctx, "dns.upstream", []string{"223.5.5.5", "119.29.29.29"}).Strings(),
+		Blocklist: g.Cfg().MustGet(ctx, "dns.blocklist").Strings(),
+	}
+	if err := g.Cfg().MustGet(ctx, "dns.zones").Scan(&cfg.Zones); err != nil {
+		g.Log().Warningf(ctx, "[DNS] dns.zones 配置无效: %v", err)
+	}
+	if file := g.Cfg().MustGet(ctx, "dns.blocklistFile").String(); file != "" {
+		domains, err := readBlocklist(file)
+		if err != nil {
+			g.Log().Warningf(ctx, "[DNS] 读取拦截列表失败: %v", err)
+		}
+		cfg.Blocklist = append(cfg.Blocklist, domains...)
+	}
+	defaultServer = New(cfg, loadRecords)
+	g.Log().Infof(ctx, "[DNS] 客户端域名: %s, 上游: %v, 分流域名: %d 个, 拦截域名: %d 个",
+		defaultServer.Domain(), defaultServer.Upstream(), len(cfg.Zones), len(defaultServer.blocklist))
+}
+
+// readBlocklist 读取拦截列表文件，兼容 hosts 格式 ("0.0.0.0 example.com") 与每行一个域名
+func readBlocklist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 0:
+		case 1:
+			domains = append(domains, fields[0])
+		default:
+			domains = append(domains, fields[1:]...)
+		}
+	}
+	return domains, scanner.Err()
+}
+
+// loadRecords 从数据库读取已启用的 WireGuard 客户端与 OpenVPN 用户的隧道地址
+// 名称无法转换为 DNS 标签时 (如全中文)，使用 peer-<id> / ovpn-<id>
+func loadRecords(ctx context.Context) []Record {
+	var records []Record
+
+	peers, err := g.DB().Model("wireguard_peer").Ctx(ctx).Fields("id, name, allowed_ips").Where("enabled", 1).OrderAsc("id").All()
+	if err != nil {
+		g.Log().Warningf(ctx, "[DNS] 读取 WireGuard 客户端失败: %v", err)
+	}
+	for _, row := range peers {
+		var addrs []netip.Addr
+		for _, item := range strings.Split(row["allowed_ips"].String(), ",") {
+			if prefix, err := netip.ParsePrefix(strings.TrimSpace(item)); err == nil && prefix.IsSingleIP() {
+				addrs = append(addrs, prefix.Addr())
+			}
+		}
+		if len(addrs) > 0 {
+			records = append(records, Record{
+				Name:   hostName(row["name"].String(), "peer", row["id"].Int()),
+				Addrs:  addrs,
+				Source: SourceWireGuard,
+			})
+		}
+	}
+
+	users, err := g.DB().Model("openvpn_user").Ctx(ctx).Fields("id, username, static_ip, ip, online").Where("enabled", 1).OrderAsc("id").All()
+	if err != nil {
+		g.Log().Warningf(ctx, "[DNS] 读取 OpenVPN 用户失败: %v", err)
+	}
+	for _, row := range users {
+		// 固定地址优先，否则使用在线时分配的地址
+		ip := row["static_ip"].String()
+		if ip == "" && row["online"].Int() == 1 {
+			ip = row["ip"].String()
+		}
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		records = append(records, Record{
+			Name:   hostName(row["username"].String(), "ovpn", row["id"].Int()),
+			Addrs:  []netip.Addr{addr},
+			Source: SourceOpenVPN,
+		})
+	}
+	return records
+}
+
+func hostName(name, fallback string, id int) string {
+	if label := HostLabel(name); label != "" {
+		return label
+	}
+	return fmt.Sprintf("%s-%d", fallback, id)
+}
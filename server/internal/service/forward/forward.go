@@ -17,6 +17,7 @@ import (
 
 	"omniwire/api/v1/forward"
 	"omniwire/internal/model/entity"
+	"omniwire/internal/service/wgserver"
 )
 
 // RuleInput 规则输入
@@ -154,6 +155,8 @@ func Create(ctx context.Context, input *RuleInput) (*forward.RuleInfo, error) {
 	if input.Enabled {
 		go Start(context.Background(), int(id))
 	}
+	// WireGuard netstack 模式下同步映射到隧道地址
+	wgserver.ReloadAllNetstackForwards(ctx)
 	return &forward.RuleInfo{
 		Id: int(id), Name: input.Name, Protocol: input.Protocol,
 		ListenPort: input.ListenPort, TargetAddr: input.TargetAddr, TargetPort: input.TargetPort,
@@ -195,6 +198,7 @@ func Update(ctx context.Context, id int, input *RuleInput) error {
 	if input.Enabled {
 		go Start(context.Background(), id)
 	}
+	wgserver.ReloadAllNetstackForwards(ctx)
 	return nil
 }
 
@@ -202,6 +206,9 @@ func Update(ctx context.Context, id int, input *RuleInput) error {
 func Delete(ctx context.Context, id int) error {
 	Stop(ctx, id)
 	_, err := g.Model("forward_rule").Where("id", id).Delete()
+	if err == nil {
+		wgserver.ReloadAllNetstackForwards(ctx)
+	}
 	return err
 }
 
@@ -0,0 +1,68 @@
+// ==========================================================================
+// OmniWire - WireGuard / OpenVPN 网段冲突检测
+// ==========================================================================
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/text/gstr"
+)
+
+const (
+	ServiceWireGuard = "WireGuard"
+	ServiceOpenVPN   = "OpenVPN"
+)
+
+// Subnets 读取指定服务当前配置的网段，未配置时返回空
+// WireGuard 返回所有接口的网段
+func Subnets(ctx context.Context, service string) []netip.Prefix {
+	var value string
+	switch service {
+	case ServiceWireGuard:
+		values, err := g.DB().Model("wireguard_config").Ctx(ctx).WhereNot("address", "").Array("address")
+		if err == nil && len(values) > 0 {
+			value = gstr.JoinAny(values, ", ")
+		} else {
+			value = g.Cfg().MustGet(ctx, "wireguard.addressRange", "10.66.66.1/24").String()
+		}
+	case ServiceOpenVPN:
+		v, err := g.DB().Model("openvpn_config").Ctx(ctx).Where("id", 1).Value("subnet")
+		if err == nil && !v.IsEmpty() {
+			value = v.String()
+		}
+	}
+	prefixes, _ := ParsePrefixes(value)
+	return prefixes
+}
+
+// CheckOverlap 检查某服务的网段是否与另一服务的网段重叠
+func CheckOverlap(ctx context.Context, service string, prefixes []netip.Prefix) error {
+	other := otherService(service)
+	if x, y, ok := Overlap(prefixes, Subnets(ctx, other)); ok {
+		return fmt.Errorf("网段 %s 与 %s 网段 %s 冲突", x.Masked(), other, y.Masked())
+	}
+	return nil
+}
+
+// CheckAddr 检查指定地址是否落在另一服务的网段内
+func CheckAddr(ctx context.Context, service string, addr netip.Addr) error {
+	other := otherService(service)
+	for _, prefix := range Subnets(ctx, other) {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("地址 %s 位于 %s 网段 %s 内", addr, other, prefix.Masked())
+		}
+	}
+	return nil
+}
+
+func otherService(service string) string {
+	if service == ServiceOpenVPN {
+		return ServiceWireGuard
+	}
+	return ServiceOpenVPN
+}
@@ -0,0 +1,183 @@
+// ==========================================================================
+// OmniWire - 通用 IP 地址分配 (IPAM)，WireGuard 与 OpenVPN 共用
+// ==========================================================================
+
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// maxScan 单次分配最多检查的地址数，避免在 IPv6 大网段中长时间遍历
+const maxScan = 1 << 16
+
+// addrRange 保留地址段 (闭区间)
+type addrRange struct {
+	from, to netip.Addr
+	reason   string
+}
+
+func (r addrRange) contains(addr netip.Addr) bool {
+	return r.from.Compare(addr) <= 0 && addr.Compare(r.to) <= 0
+}
+
+// Pool 单个网段的地址池，支持任意前缀长度
+type Pool struct {
+	prefix   netip.Prefix
+	reserved []addrRange
+	used     map[netip.Addr]string // 地址 -> 占用者
+}
+
+// NewPool 创建地址池并自动保留网络地址，IPv4 网段同时保留广播地址
+// /31、/32 (IPv4) 与 /127、/128 (IPv6) 点对点网段不做保留
+func NewPool(prefix netip.Prefix) *Pool {
+	prefix = prefix.Masked()
+	p := &Pool{
+		prefix: prefix,
+		used:   make(map[netip.Addr]string),
+	}
+	if prefix.Addr().BitLen()-prefix.Bits() < 2 {
+		return p
+	}
+	p.Reserve(prefix.Addr(), "网络地址")
+	if prefix.Addr().Is4() {
+		p.Reserve(LastAddr(prefix), "广播地址")
+	}
+	return p
+}
+
+// Prefix 地址池网段
+func (p *Pool) Prefix() netip.Prefix {
+	return p.prefix
+}
+
+// Reserve 保留单个地址 (服务端、网关等)，网段外的地址忽略
+func (p *Pool) Reserve(addr netip.Addr, reason string) {
+	p.ReserveRange(addr, addr, reason)
+}
+
+// ReserveRange 保留地址段 [from, to]
+func (p *Pool) ReserveRange(from, to netip.Addr, reason string) {
+	if !from.IsValid() || !to.IsValid() || to.Less(from) {
+		return
+	}
+	if !p.prefix.Contains(from) && !p.prefix.Contains(to) {
+		return
+	}
+	p.reserved = append(p.reserved, addrRange{from: from, to: to, reason: reason})
+}
+
+// Use 标记地址已被占用，网段外的地址忽略
+func (p *Pool) Use(addr netip.Addr, owner string) {
+	if p.prefix.Contains(addr) {
+		p.used[addr] = owner
+	}
+}
+
+// Owner 返回占用或保留该地址的说明，未占用返回空字符串
+func (p *Pool) Owner(addr netip.Addr) string {
+	if r := p.reservedRange(addr); r != nil {
+		return r.reason
+	}
+	return p.used[addr]
+}
+
+func (p *Pool) reservedRange(addr netip.Addr) *addrRange {
+	for i := range p.reserved {
+		if p.reserved[i].contains(addr) {
+			return &p.reserved[i]
+		}
+	}
+	return nil
+}
+
+// Allocate 分配网段中第一个可用地址并标记为已占用
+func (p *Pool) Allocate(owner string) (netip.Addr, error) {
+	addr := p.prefix.Addr()
+	for i := 0; i < maxScan && addr.IsValid() && p.prefix.Contains(addr); i++ {
+		if r := p.reservedRange(addr); r != nil {
+			addr = r.to.Next()
+			continue
+		}
+		if _, ok := p.used[addr]; !ok {
+			p.used[addr] = owner
+			return addr, nil
+		}
+		addr = addr.Next()
+	}
+	return netip.Addr{}, fmt.Errorf("IP 地址已耗尽: %s", p.prefix)
+}
+
+// Pin 由管理员指定地址，检查是否在网段内且未被保留或占用
+func (p *Pool) Pin(addr netip.Addr, owner string) error {
+	if !p.prefix.Contains(addr) {
+		return fmt.Errorf("地址 %s 不在网段 %s 内", addr, p.prefix)
+	}
+	if who := p.Owner(addr); who != "" {
+		return fmt.Errorf("地址 %s 已被占用: %s", addr, who)
+	}
+	p.used[addr] = owner
+	return nil
+}
+
+// ==================== 辅助函数 ====================
+
+// LastAddr 返回网段最后一个地址 (IPv4 即广播地址)
+func LastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// FirstHost 返回网段第一个主机地址，通常作为服务端 / 网关
+func FirstHost(prefix netip.Prefix) netip.Addr {
+	return prefix.Masked().Addr().Next()
+}
+
+// ParsePrefixes 解析逗号分隔的网段列表
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段: %s", item)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// ParseAddrs 解析逗号分隔的地址列表，兼容 "10.66.66.2/32" 与 "10.66.66.2" 写法，无效项忽略
+func ParseAddrs(s string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			addrs = append(addrs, prefix.Addr())
+		} else if addr, err := netip.ParseAddr(item); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Overlap 检查两组网段是否存在重叠，返回第一对重叠网段
+func Overlap(a, b []netip.Prefix) (netip.Prefix, netip.Prefix, bool) {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Overlaps(y) {
+				return x, y, true
+			}
+		}
+	}
+	return netip.Prefix{}, netip.Prefix{}, false
+}
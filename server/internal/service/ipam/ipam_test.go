@@ -0,0 +1,67 @@
+package ipam
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPoolAllocateArbitraryPrefix(t *testing.T) {
+	// /28: .0 网络地址、.15 广播地址保留，.1 为网关
+	pool := NewPool(netip.MustParsePrefix("192.168.10.0/28"))
+	pool.Reserve(netip.MustParseAddr("192.168.10.1"), "网关")
+	pool.Use(netip.MustParseAddr("192.168.10.2"), "peer-a")
+
+	var got []netip.Addr
+	for {
+		addr, err := pool.Allocate("peer")
+		if err != nil {
+			break
+		}
+		got = append(got, addr)
+	}
+	if len(got) != 12 || got[0] != netip.MustParseAddr("192.168.10.3") || got[11] != netip.MustParseAddr("192.168.10.14") {
+		t.Fatalf("unexpected allocation in /28: %v", got)
+	}
+
+	// /16: 跨越第三个字节
+	pool = NewPool(netip.MustParsePrefix("10.20.0.0/16"))
+	pool.ReserveRange(netip.MustParseAddr("10.20.0.1"), netip.MustParseAddr("10.20.0.255"), "保留段")
+	if addr, err := pool.Allocate("peer"); err != nil || addr != netip.MustParseAddr("10.20.1.0") {
+		t.Fatalf("expected 10.20.1.0, got %s %v", addr, err)
+	}
+
+	// IPv6
+	pool = NewPool(netip.MustParsePrefix("fd42:42:42::/64"))
+	pool.Reserve(netip.MustParseAddr("fd42:42:42::1"), "服务端")
+	if addr, err := pool.Allocate("peer"); err != nil || addr != netip.MustParseAddr("fd42:42:42::2") {
+		t.Fatalf("expected fd42:42:42::2, got %s %v", addr, err)
+	}
+}
+
+func TestPoolPin(t *testing.T) {
+	pool := NewPool(netip.MustParsePrefix("10.8.0.0/24"))
+	pool.Reserve(netip.MustParseAddr("10.8.0.1"), "服务端")
+	pool.Use(netip.MustParseAddr("10.8.0.5"), "alice")
+
+	for _, addr := range []string{"10.8.0.0", "10.8.0.1", "10.8.0.5", "10.8.0.255", "10.9.0.5"} {
+		if err := pool.Pin(netip.MustParseAddr(addr), "bob"); err == nil {
+			t.Fatalf("expected pin of %s to fail", addr)
+		}
+	}
+	if err := pool.Pin(netip.MustParseAddr("10.8.0.100"), "bob"); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	if owner := pool.Owner(netip.MustParseAddr("10.8.0.100")); owner != "bob" {
+		t.Fatalf("expected owner bob, got %q", owner)
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	wg, _ := ParsePrefixes("10.66.66.1/24, fd42::1/64")
+	if _, _, ok := Overlap(wg, []netip.Prefix{netip.MustParsePrefix("10.8.0.0/24")}); ok {
+		t.Fatal("unexpected overlap")
+	}
+	if _, _, ok := Overlap(wg, []netip.Prefix{netip.MustParsePrefix("10.66.0.0/16")}); !ok {
+		t.Fatal("expected overlap with 10.66.0.0/16")
+	}
+}
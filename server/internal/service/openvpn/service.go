@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -18,6 +19,8 @@ import (
 	"github.com/gogf/gf/v2/frame/g"
 	"golang.org/x/crypto/bcrypt"
 
+	"omniwire/internal/service/ipam"
+
 	"crypto/ecdsa"
 	"crypto/x509"
 )
@@ -65,6 +68,7 @@ type UserInfo struct {
 	Enabled     int
 	Online      int
 	IP          string
+	StaticIP    string
 	ConnectedAt string
 	CreatedAt   string
 	RxBytes     int64
@@ -176,6 +180,34 @@ func GetConfig(ctx context.Context) (*ConfigInfo, error) {
 }
 
 func UpdateConfig(ctx context.Context, input *ConfigInfo) error {
+	prefix, err := netip.ParsePrefix(input.Subnet)
+	if err != nil || !prefix.Addr().Is4() {
+		return fmt.Errorf("无效的子网: %s", input.Subnet)
+	}
+	if err := ipam.CheckOverlap(ctx, ipam.ServiceOpenVPN, []netip.Prefix{prefix}); err != nil {
+		return err
+	}
+	// 已有用户的固定 IP 须位于新子网内且不与服务端地址冲突
+	if rows, err := g.DB().Model("openvpn_user").Fields("username,static_ip").All(); err == nil {
+		gateway := ipam.FirstHost(prefix)
+		var outside []string
+		for _, r := range rows {
+			addr, err := netip.ParseAddr(r["static_ip"].String())
+			if err != nil {
+				continue
+			}
+			if addr == gateway {
+				return fmt.Errorf("服务端地址 %s 与用户 %s 的固定 IP 冲突", gateway, r["username"].String())
+			}
+			if !prefix.Contains(addr) {
+				outside = append(outside, fmt.Sprintf("%s (%s)", r["username"].String(), addr))
+			}
+		}
+		if len(outside) > 0 {
+			return fmt.Errorf("以下用户的固定 IP 不在子网 %s 内，请先修改或清除: %s", prefix.Masked(), strings.Join(outside, ", "))
+		}
+	}
+
 	data := g.Map{
 		"protocol": input.Protocol, "port": input.Port, "endpoint": input.Endpoint,
 		"subnet": input.Subnet, "dns": input.DNS, "auto_start": boolToInt(input.AutoStart),
@@ -187,7 +219,7 @@ func UpdateConfig(ctx context.Context, input *ConfigInfo) error {
 		_, err := g.DB().Model("openvpn_config").Insert(data)
 		return err
 	}
-	_, err := g.DB().Model("openvpn_config").Where("id", 1).Update(data)
+	_, err = g.DB().Model("openvpn_config").Where("id", 1).Update(data)
 	return err
 }
 
@@ -213,7 +245,7 @@ func GetUsers(ctx context.Context) ([]*UserInfo, error) {
 		users = append(users, &UserInfo{
 			Id: row["id"].Int(), Username: username,
 			Enabled: row["enabled"].Int(), Online: isOnline,
-			IP: ip, ConnectedAt: connectedAt,
+			IP: ip, StaticIP: row["static_ip"].String(), ConnectedAt: connectedAt,
 			CreatedAt: row["created_at"].String(),
 			RxBytes:   rxBytes, TxBytes: txBytes,
 		})
@@ -221,7 +253,8 @@ func GetUsers(ctx context.Context) ([]*UserInfo, error) {
 	return users, nil
 }
 
-func CreateUser(ctx context.Context, username, password string) (*UserInfo, error) {
+// CreateUser 创建用户，staticIP 为空时自动分配
+func CreateUser(ctx context.Context, username, password, staticIP string) (*UserInfo, error) {
 	count, _ := g.DB().Model("openvpn_user").Where("username", username).Count()
 	if count > 0 {
 		return nil, fmt.Errorf("用户名已存在")
@@ -238,7 +271,11 @@ func CreateUser(ctx context.Context, username, password string) (*UserInfo, erro
 		return nil, err
 	}
 	config, _ := GetConfig(ctx)
-	staticIP, _ := assignNextIP(ctx, config.Subnet)
+	if staticIP == "" {
+		staticIP, _ = assignNextIP(ctx, config.Subnet)
+	} else if err := pinIP(ctx, config.Subnet, staticIP, 0); err != nil {
+		return nil, err
+	}
 	res, err := g.DB().Model("openvpn_user").Insert(g.Map{
 		"username": username, "password": string(hashed),
 		"cert": string(bundle.CertPEM), "key": string(bundle.KeyPEM),
@@ -248,11 +285,19 @@ func CreateUser(ctx context.Context, username, password string) (*UserInfo, erro
 		return nil, err
 	}
 	id, _ := res.LastInsertId()
-	return &UserInfo{Id: int(id), Username: username, Enabled: 1}, nil
+	return &UserInfo{Id: int(id), Username: username, Enabled: 1, StaticIP: staticIP}, nil
 }
 
-func UpdateUser(ctx context.Context, id int, password string, enabled *bool) error {
+// UpdateUser 更新用户，staticIP 为空表示不修改
+func UpdateUser(ctx context.Context, id int, password, staticIP string, enabled *bool) error {
 	data := g.Map{}
+	if staticIP != "" {
+		config, _ := GetConfig(ctx)
+		if err := pinIP(ctx, config.Subnet, staticIP, id); err != nil {
+			return err
+		}
+		data["static_ip"] = staticIP
+	}
 	if password != "" {
 		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
@@ -548,25 +593,53 @@ func boolToInt(b bool) int {
 	return 0
 }
 
-// assignNextIP 从 VPN 子网中分配下一个可用 IP（从 .2 开始，.1 为服务端）
+// assignNextIP 从 VPN 子网中分配下一个可用 IP（网段第一个地址为服务端）
 func assignNextIP(ctx context.Context, subnet string) (string, error) {
-	_, ipNet, err := net.ParseCIDR(subnet)
+	pool, err := userPool(ctx, subnet, 0)
 	if err != nil {
 		return "", err
 	}
-	rows, _ := g.DB().Model("openvpn_user").Fields("static_ip").All()
-	used := map[string]bool{}
-	for _, r := range rows {
-		used[r["static_ip"].String()] = true
+	addr, err := pool.Allocate("新用户")
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// pinIP 检查管理员指定的固定 IP 是否可用，excludeID 为正在编辑的用户
+func pinIP(ctx context.Context, subnet, ip string, excludeID int) error {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return fmt.Errorf("无效的 IP 地址: %s", ip)
 	}
-	ip := ipNet.IP.To4()
-	for i := 2; i < 254; i++ {
-		candidate := fmt.Sprintf("%d.%d.%d.%d", ip[0], ip[1], ip[2], byte(i))
-		if !used[candidate] {
-			return candidate, nil
+	if err := ipam.CheckAddr(ctx, ipam.ServiceOpenVPN, addr); err != nil {
+		return err
+	}
+	pool, err := userPool(ctx, subnet, excludeID)
+	if err != nil {
+		return err
+	}
+	return pool.Pin(addr, "当前用户")
+}
+
+// userPool 构建 OpenVPN 地址池，服务端地址保留，已有用户的固定 IP 标记为占用
+func userPool(ctx context.Context, subnet string, excludeID int) (*ipam.Pool, error) {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return nil, fmt.Errorf("解析子网失败: %v", err)
+	}
+	pool := ipam.NewPool(prefix)
+	pool.Reserve(ipam.FirstHost(prefix), "服务端")
+	rows, _ := g.DB().Model("openvpn_user").Fields("id,username,static_ip").All()
+	for _, r := range rows {
+		if r["id"].Int() == excludeID {
+			continue
+		}
+		if addr, err := netip.ParseAddr(r["static_ip"].String()); err == nil {
+			pool.Use(addr, "用户 "+r["username"].String())
 		}
 	}
-	return "", fmt.Errorf("IP 地址池已耗尽")
+	return pool, nil
 }
 
 func parseCIDRRoutes(routes string) string {
@@ -0,0 +1,438 @@
+// ==========================================================================
+// OmniWire - 隧道内访问控制 (ACL，位于 TUN 与限速层之间)
+// 只检查 Peer 发出的数据包 (device -> 系统)，Peer 之间的流量也必经此方向；
+// 规则按顺序匹配，未命中时按默认策略处理。Peer 之间已放行的会话记录在流表中，
+// 对端的回包直接放行，避免隔离模式下单向规则无法通信
+// ==========================================================================
+
+package wgserver
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// ACL 默认策略
+const (
+	ACLAllowAll = "allow"   // 未命中规则时放行
+	ACLIsolate  = "isolate" // 未命中规则时禁止 Peer 之间互访，访问服务端与其他网络不受影响
+)
+
+// ACL 规则动作
+const (
+	ACLActionAllow = "allow"
+	ACLActionDeny  = "deny"
+)
+
+// aclFlowTimeout Peer 之间会话的空闲超时，超时后回包按规则重新检查
+const aclFlowTimeout = 3 * time.Minute
+
+// maxACLFlows 流表达到该大小时清理过期会话
+const maxACLFlows = 8192
+
+// ACLRule 访问控制规则，来源均为空表示任意 Peer
+type ACLRule struct {
+	Id           int
+	Action       string         // ACLActionAllow | ACLActionDeny
+	SourcePeer   int            // 来源客户端 ID，0 表示不限
+	SourceGroup  int            // 来源分组 ID，0 表示不限
+	Destinations []netip.Prefix // 目的网段，为空表示任意
+	Protocol     string         // tcp | udp | icmp，为空表示任意
+	PortFrom     uint16         // 目的端口范围，0 表示任意 (仅 tcp / udp)
+	PortTo       uint16
+}
+
+// aclRule 编译后的规则
+type aclRule struct {
+	ACLRule
+	protocol uint8
+	sources  []netip.Prefix // 来源 Peer 的隧道地址与路由网段
+	anySrc   bool
+	hits     *atomic.Uint64
+}
+
+// flowKey Peer 之间的会话 (按发起方向记录)
+type flowKey struct {
+	src, dst     netip.Addr
+	proto        uint8
+	sport, dport uint16
+	// 无法确定协议 / 端口的数据包 (扩展头链异常、分片)，带协议或端口条件的拒绝规则视为命中
+	protoUnknown bool
+	portsUnknown bool
+}
+
+// aclTUN 包装 tun.Device，按 ACL 丢弃 Peer 发出的数据包
+type aclTUN struct {
+	tun.Device
+
+	mu          sync.RWMutex
+	policy      string
+	rules       []*aclRule
+	peerAddrs   map[netip.Addr]bool // 所有 Peer 的隧道地址
+	peerRoutes  []netip.Prefix      // 所有 Peer 后方的路由网段
+	hits        map[int]*atomic.Uint64
+	defaultHits atomic.Uint64 // 默认策略丢弃的数据包
+
+	flowMu    sync.Mutex
+	flows     map[flowKey]time.Time
+	lastPrune time.Time
+}
+
+func newACLTUN(dev tun.Device) *aclTUN {
+	return &aclTUN{
+		Device:    dev,
+		policy:    ACLAllowAll,
+		peerAddrs: make(map[netip.Addr]bool),
+		hits:      make(map[int]*atomic.Uint64),
+		flows:     make(map[flowKey]time.Time),
+	}
+}
+
+// SetACL 保存访问控制策略，运行中立即生效
+func (s *WireGuardServer) SetACL(policy string, rules []ACLRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if policy == "" {
+		policy = ACLAllowAll
+	}
+	s.aclPolicy = policy
+	s.aclRules = rules
+	if s.acl != nil {
+		s.acl.sync(s.aclPolicy, s.aclRules, s.peers)
+	}
+}
+
+// ACLHits 各规则命中次数 (以规则 ID 为键) 与默认策略丢弃次数，服务未运行时返回 nil
+func (s *WireGuardServer) ACLHits() (map[int]uint64, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.acl == nil {
+		return nil, 0
+	}
+	return s.acl.counters()
+}
+
+// sync 根据规则与当前 Peer 列表重建过滤表，命中计数按规则 ID 保留
+func (t *aclTUN) sync(policy string, rules []ACLRule, peers map[string]*Peer) {
+	peerAddrs := make(map[netip.Addr]bool)
+	var peerRoutes []netip.Prefix
+	byId := make(map[int][]netip.Prefix)
+	byGroup := make(map[int][]netip.Prefix)
+	for _, p := range peers {
+		var prefixes []netip.Prefix
+		for _, addr := range peerTunnelAddrs(p.AllowedIPs) {
+			peerAddrs[addr] = true
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+		for _, item := range strings.Split(p.RoutedNetworks, ",") {
+			if prefix, err := netip.ParsePrefix(strings.TrimSpace(item)); err == nil {
+				peerRoutes = append(peerRoutes, prefix.Masked())
+				prefixes = append(prefixes, prefix.Masked())
+			}
+		}
+		byId[p.Id] = append(byId[p.Id], prefixes...)
+		if p.GroupId > 0 {
+			byGroup[p.GroupId] = append(byGroup[p.GroupId], prefixes...)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hits := make(map[int]*atomic.Uint64, len(rules))
+	compiled := make([]*aclRule, 0, len(rules))
+	for _, rule := range rules {
+		r := &aclRule{ACLRule: rule, protocol: protocolNumber(rule.Protocol)}
+		switch {
+		case rule.SourcePeer > 0:
+			r.sources = byId[rule.SourcePeer]
+		case rule.SourceGroup > 0:
+			r.sources = byGroup[rule.SourceGroup]
+		default:
+			r.anySrc = true
+		}
+		r.hits = t.hits[rule.Id]
+		if r.hits == nil {
+			r.hits = new(atomic.Uint64)
+		}
+		hits[rule.Id] = r.hits
+		compiled = append(compiled, r)
+	}
+	t.policy = policy
+	t.rules = compiled
+	t.peerAddrs = peerAddrs
+	t.peerRoutes = peerRoutes
+	t.hits = hits
+}
+
+func (t *aclTUN) counters() (map[int]uint64, uint64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	result := make(map[int]uint64, len(t.hits))
+	for id, h := range t.hits {
+		result[id] = h.Load()
+	}
+	return result, t.defaultHits.Load()
+}
+
+// isPeer 目的地址是否属于某个 Peer (调用方需持有 t.mu 读锁)
+func (t *aclTUN) isPeer(addr netip.Addr) bool {
+	if t.peerAddrs[addr] {
+		return true
+	}
+	for _, prefix := range t.peerRoutes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow 判断 Peer 发出的数据包是否放行
+func (t *aclTUN) allow(pkt []byte) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.rules) == 0 && t.policy == ACLAllowAll {
+		return true
+	}
+	key, ok := parseFlow(pkt)
+	if !ok {
+		return true
+	}
+
+	// Peer 之间已放行会话的回包
+	toPeer := t.isPeer(key.dst)
+	if toPeer && t.isReply(key) {
+		return true
+	}
+
+	allowed := true
+	matched := false
+	for _, r := range t.rules {
+		if r.match(key) {
+			r.hits.Add(1)
+			allowed = r.Action == ACLActionAllow
+			matched = true
+			break
+		}
+	}
+	if !matched && t.policy == ACLIsolate && toPeer && key.src != key.dst {
+		t.defaultHits.Add(1)
+		allowed = false
+	}
+	if allowed && toPeer {
+		t.trackFlow(key)
+	}
+	return allowed
+}
+
+// match 规则是否匹配数据包；协议或端口无法确定时，拒绝规则按命中处理，放行规则按未命中处理
+func (r *aclRule) match(key flowKey) bool {
+	deny := r.Action == ACLActionDeny
+	if r.protocol != 0 && r.protocol != key.proto && !(deny && key.protoUnknown) {
+		return false
+	}
+	if r.PortFrom > 0 {
+		if key.portsUnknown {
+			if !deny {
+				return false
+			}
+		} else if key.dport < r.PortFrom || key.dport > r.PortTo {
+			return false
+		}
+	}
+	if !r.anySrc && !containsAddr(r.sources, key.src) {
+		return false
+	}
+	if len(r.Destinations) > 0 && !containsAddr(r.Destinations, key.dst) {
+		return false
+	}
+	return true
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReply 数据包是否为已放行会话的回包，是则刷新会话时间
+func (t *aclTUN) isReply(key flowKey) bool {
+	reverse := flowKey{src: key.dst, dst: key.src, proto: key.proto, sport: key.dport, dport: key.sport}
+	t.flowMu.Lock()
+	defer t.flowMu.Unlock()
+	seen, ok := t.flows[reverse]
+	if !ok || time.Since(seen) > aclFlowTimeout {
+		return false
+	}
+	t.flows[reverse] = time.Now()
+	return true
+}
+
+// trackFlow 记录 Peer 之间放行的会话
+func (t *aclTUN) trackFlow(key flowKey) {
+	now := time.Now()
+	t.flowMu.Lock()
+	defer t.flowMu.Unlock()
+	if len(t.flows) >= maxACLFlows && now.Sub(t.lastPrune) > 10*time.Second {
+		t.lastPrune = now
+		for k, seen := range t.flows {
+			if now.Sub(seen) > aclFlowTimeout {
+				delete(t.flows, k)
+			}
+		}
+	}
+	t.flows[key] = now
+}
+
+// Write Peer -> 系统方向，丢弃被 ACL 拒绝的数据包
+func (t *aclTUN) Write(bufs [][]byte, offset int) (int, error) {
+	var kept [][]byte
+	for i, buf := range bufs {
+		if !t.allow(buf[offset:]) {
+			if kept == nil {
+				kept = append(make([][]byte, 0, len(bufs)), bufs[:i]...)
+			}
+			continue
+		}
+		if kept != nil {
+			kept = append(kept, buf)
+		}
+	}
+	if kept == nil {
+		return t.Device.Write(bufs, offset)
+	}
+	if len(kept) == 0 {
+		return len(bufs), nil
+	}
+	if _, err := t.Device.Write(kept, offset); err != nil {
+		return 0, err
+	}
+	return len(bufs), nil
+}
+
+// ==================== 数据包解析 ====================
+
+// 协议号
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+// protocolNumber 规则协议名转换为协议号，icmp 同时匹配 ICMPv6
+func protocolNumber(protocol string) uint8 {
+	switch protocol {
+	case "tcp":
+		return protoTCP
+	case "udp":
+		return protoUDP
+	case "icmp":
+		return protoICMP
+	}
+	return 0
+}
+
+// IPv6 扩展头
+const (
+	ipv6HopByHop  = 0
+	ipv6Routing   = 43
+	ipv6Fragment  = 44
+	ipv6AuthHdr   = 51
+	ipv6DestOpts  = 60
+	ipv6Mobility  = 135
+	ipv6HIP       = 139
+	ipv6Shim6     = 140
+	maxIPv6Chains = 8 // 最多解析的扩展头数量，超出时视为无法确定上层协议
+)
+
+// parseFlow 解析数据包的地址、协议与端口；IPv6 会跳过扩展头找到上层协议。
+// 扩展头过长或被截断时 protoUnknown，IPv4 / IPv6 后续分片与截断的 TCP / UDP 头部 portsUnknown
+func parseFlow(pkt []byte) (flowKey, bool) {
+	var key flowKey
+	var payload []byte
+	if len(pkt) < 1 {
+		return key, false
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) < 20 {
+			return key, false
+		}
+		ihl := int(pkt[0]&0x0f) * 4
+		key.src = netip.AddrFrom4([4]byte(pkt[12:16]))
+		key.dst = netip.AddrFrom4([4]byte(pkt[16:20]))
+		key.proto = pkt[9]
+		if binary.BigEndian.Uint16(pkt[6:8])&0x1fff == 0 && len(pkt) >= ihl {
+			payload = pkt[ihl:]
+		}
+	case 6:
+		if len(pkt) < 40 {
+			return key, false
+		}
+		key.src = netip.AddrFrom16([16]byte(pkt[8:24]))
+		key.dst = netip.AddrFrom16([16]byte(pkt[24:40]))
+		key.proto, payload, key.protoUnknown = skipIPv6Extensions(pkt[6], pkt[40:])
+		if key.proto == protoICMPv6 {
+			key.proto = protoICMP
+		}
+	default:
+		return key, false
+	}
+	switch {
+	case key.protoUnknown:
+		key.proto = 0
+		key.portsUnknown = true
+	case key.proto == protoTCP || key.proto == protoUDP:
+		if len(payload) >= 4 {
+			key.sport = binary.BigEndian.Uint16(payload[0:2])
+			key.dport = binary.BigEndian.Uint16(payload[2:4])
+		} else {
+			key.portsUnknown = true
+		}
+	}
+	return key, true
+}
+
+// skipIPv6Extensions 沿扩展头链找到上层协议；后续分片返回 nil 负载，无法解析时 unknown 为 true
+func skipIPv6Extensions(next uint8, payload []byte) (proto uint8, upper []byte, unknown bool) {
+	for i := 0; i < maxIPv6Chains; i++ {
+		var size int
+		switch next {
+		case ipv6HopByHop, ipv6Routing, ipv6DestOpts, ipv6Mobility, ipv6HIP, ipv6Shim6:
+			if len(payload) < 2 {
+				return 0, nil, true
+			}
+			size = (int(payload[1]) + 1) * 8
+		case ipv6AuthHdr:
+			if len(payload) < 2 {
+				return 0, nil, true
+			}
+			size = (int(payload[1]) + 2) * 4
+		case ipv6Fragment:
+			if len(payload) < 8 {
+				return 0, nil, true
+			}
+			if binary.BigEndian.Uint16(payload[2:4])&0xfff8 != 0 {
+				return payload[0], nil, false // 后续分片不含上层头部
+			}
+			size = 8
+		default:
+			return next, payload, false
+		}
+		if len(payload) < size {
+			return 0, nil, true
+		}
+		next, payload = payload[0], payload[size:]
+	}
+	return 0, nil, true
+}
@@ -0,0 +1,151 @@
+package wgserver
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+)
+
+// tcpPacket 构造 IPv4 TCP 数据包 (只填充地址与端口)
+func tcpPacket(src, dst string, sport, dport uint16) []byte {
+	pkt := ipv4Packet(src, dst, 40)
+	pkt[9] = protoTCP
+	binary.BigEndian.PutUint16(pkt[20:22], sport)
+	binary.BigEndian.PutUint16(pkt[22:24], dport)
+	return pkt
+}
+
+func aclTestPeers() map[string]*Peer {
+	return map[string]*Peer{
+		"peer-a": {Id: 1, GroupId: 7, PublicKey: "peer-a", AllowedIPs: "10.66.66.2/32", Enabled: true},
+		"peer-b": {Id: 2, PublicKey: "peer-b", AllowedIPs: "10.66.66.3/32", RoutedNetworks: "192.168.50.0/24", Enabled: true},
+		"peer-c": {Id: 3, GroupId: 7, PublicKey: "peer-c", AllowedIPs: "10.66.66.4/32", Enabled: true},
+	}
+}
+
+func TestACLIsolateDropsPeerToPeer(t *testing.T) {
+	acl := newACLTUN(&fakeTUN{})
+	acl.sync(ACLIsolate, nil, aclTestPeers())
+
+	if acl.allow(tcpPacket("10.66.66.2", "10.66.66.3", 40000, 22)) {
+		t.Fatal("peer to peer packet should be dropped")
+	}
+	if acl.allow(tcpPacket("10.66.66.2", "192.168.50.10", 40000, 22)) {
+		t.Fatal("packet to network routed behind a peer should be dropped")
+	}
+	if !acl.allow(tcpPacket("10.66.66.2", "10.66.66.1", 40000, 22)) {
+		t.Fatal("packet to server should pass")
+	}
+	if !acl.allow(tcpPacket("10.66.66.2", "8.8.8.8", 40000, 443)) {
+		t.Fatal("packet to internet should pass")
+	}
+	if _, defaultHits := acl.counters(); defaultHits != 2 {
+		t.Fatalf("default hits = %d, want 2", defaultHits)
+	}
+}
+
+func TestACLRuleAllowsReplies(t *testing.T) {
+	acl := newACLTUN(&fakeTUN{})
+	acl.sync(ACLIsolate, []ACLRule{{
+		Id:           10,
+		Action:       ACLActionAllow,
+		SourcePeer:   1,
+		Destinations: []netip.Prefix{netip.MustParsePrefix("10.66.66.3/32")},
+		Protocol:     "tcp",
+		PortFrom:     22,
+		PortTo:       22,
+	}}, aclTestPeers())
+
+	if !acl.allow(tcpPacket("10.66.66.2", "10.66.66.3", 40000, 22)) {
+		t.Fatal("allowed rule should pass")
+	}
+	if !acl.allow(tcpPacket("10.66.66.3", "10.66.66.2", 22, 40000)) {
+		t.Fatal("reply of allowed flow should pass")
+	}
+	if acl.allow(tcpPacket("10.66.66.3", "10.66.66.2", 22, 40001)) {
+		t.Fatal("unrelated packet from peer-b should be dropped")
+	}
+	if acl.allow(tcpPacket("10.66.66.2", "10.66.66.3", 40000, 80)) {
+		t.Fatal("port outside rule should be dropped")
+	}
+	if hits, _ := acl.counters(); hits[10] != 1 {
+		t.Fatalf("rule hits = %d, want 1", hits[10])
+	}
+}
+
+func TestACLDenyByGroup(t *testing.T) {
+	inner := &fakeTUN{}
+	acl := newACLTUN(inner)
+	acl.sync(ACLAllowAll, []ACLRule{{
+		Id:           20,
+		Action:       ACLActionDeny,
+		SourceGroup:  7,
+		Destinations: []netip.Prefix{netip.MustParsePrefix("192.168.50.0/24")},
+	}}, aclTestPeers())
+
+	bufs := [][]byte{
+		tcpPacket("10.66.66.4", "192.168.50.10", 40000, 80), // 组内成员，拒绝
+		tcpPacket("10.66.66.3", "10.66.66.4", 40000, 80),    // 非组内成员，放行
+		tcpPacket("10.66.66.2", "192.168.50.20", 40000, 80), // 组内成员，拒绝
+	}
+	n, err := acl.Write(bufs, 0)
+	if err != nil || n != len(bufs) {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	if len(inner.written) != 1 {
+		t.Fatalf("written %d packets, want 1", len(inner.written))
+	}
+	if hits, _ := acl.counters(); hits[20] != 2 {
+		t.Fatalf("rule hits = %d, want 2", hits[20])
+	}
+}
+
+// tcp6Packet 构造带 Hop-by-Hop 扩展头的 IPv6 TCP 数据包
+func tcp6Packet(src, dst string, sport, dport uint16) []byte {
+	pkt := make([]byte, 40+8+20)
+	pkt[0] = 0x60
+	pkt[6] = ipv6HopByHop
+	s, d := netip.MustParseAddr(src).As16(), netip.MustParseAddr(dst).As16()
+	copy(pkt[8:24], s[:])
+	copy(pkt[24:40], d[:])
+	pkt[40] = protoTCP // HBH: next header = TCP，长度 8 字节
+	binary.BigEndian.PutUint16(pkt[48:50], sport)
+	binary.BigEndian.PutUint16(pkt[50:52], dport)
+	return pkt
+}
+
+func TestACLDenyIPv6ExtensionHeaders(t *testing.T) {
+	acl := newACLTUN(&fakeTUN{})
+	acl.sync(ACLAllowAll, []ACLRule{{
+		Id:       30,
+		Action:   ACLActionDeny,
+		Protocol: "tcp",
+		PortFrom: 22,
+		PortTo:   22,
+	}}, map[string]*Peer{
+		"peer-a": {Id: 1, PublicKey: "peer-a", AllowedIPs: "fd42::2/128", Enabled: true},
+	})
+
+	if acl.allow(tcp6Packet("fd42::2", "fd42::1", 40000, 22)) {
+		t.Fatal("tcp/22 behind hop-by-hop header should be denied")
+	}
+	if !acl.allow(tcp6Packet("fd42::2", "fd42::1", 40000, 443)) {
+		t.Fatal("tcp/443 behind hop-by-hop header should pass")
+	}
+
+	// 扩展头链被截断，无法确定协议与端口
+	truncated := tcp6Packet("fd42::2", "fd42::1", 40000, 443)[:44]
+	if acl.allow(truncated) {
+		t.Fatal("packet with unparsable extension chain should match deny rule")
+	}
+
+	// IPv4 后续分片没有端口
+	frag := tcpPacket("10.66.66.2", "10.66.66.1", 40000, 443)
+	binary.BigEndian.PutUint16(frag[6:8], 100)
+	if acl.allow(frag) {
+		t.Fatal("non-first tcp fragment should match port-qualified deny rule")
+	}
+	if hits, _ := acl.counters(); hits[30] != 3 {
+		t.Fatalf("rule hits = %d, want 3", hits[30])
+	}
+}
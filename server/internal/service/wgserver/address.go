@@ -0,0 +1,43 @@
+// ==========================================================================
+// OmniWire - WireGuard 地址解析 (IPv4 / IPv6 双栈)
+// ==========================================================================
+
+package wgserver
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParseServerAddress 解析服务端地址，支持 "10.66.66.1/24, fd42:42:42::1/64" 形式的双栈配置
+// 每个地址族最多一个网段；主机位全 0 时自动修正为网段第一个地址 (/31、/32 与 /127、/128 没有网络地址，保持不变)
+func ParseServerAddress(address string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	var has4, has6 bool
+	for _, item := range strings.Split(address, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的地址: %s", item)
+		}
+		addr := prefix.Addr()
+		if addr.Is4() && has4 || addr.Is6() && has6 {
+			return nil, fmt.Errorf("每个地址族只能配置一个网段: %s", item)
+		}
+		has4 = has4 || addr.Is4()
+		has6 = has6 || addr.Is6()
+
+		if prefix.Bits() < addr.BitLen()-1 && addr == prefix.Masked().Addr() {
+			addr = addr.Next()
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, prefix.Bits()))
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("地址不能为空")
+	}
+	return prefixes, nil
+}
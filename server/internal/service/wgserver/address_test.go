@@ -0,0 +1,31 @@
+package wgserver
+
+import "testing"
+
+func TestParseServerAddress(t *testing.T) {
+	cases := map[string]string{
+		"10.66.66.0/24":                  "10.66.66.1/24",
+		"10.66.66.1/24":                  "10.66.66.1/24",
+		"10.66.66.1/32":                  "10.66.66.1/32",
+		"10.66.66.0/31":                  "10.66.66.0/31",
+		"fd42::/64":                      "fd42::1/64",
+		"fd42::1/128":                    "fd42::1/128",
+		"10.66.66.0/24, fd42:42:42::/64": "10.66.66.1/24,fd42:42:42::1/64",
+	}
+	for in, want := range cases {
+		prefixes, err := ParseServerAddress(in)
+		if err != nil {
+			t.Fatalf("ParseServerAddress(%q): %v", in, err)
+		}
+		got := ""
+		for i, p := range prefixes {
+			if i > 0 {
+				got += ","
+			}
+			got += p.String()
+		}
+		if got != want {
+			t.Errorf("ParseServerAddress(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// ==========================================================================
+// OmniWire - 配置热更新 (按差异在线生效，必要时才重建网卡)
+// ==========================================================================
+
+package wgserver
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 配置生效方式
+const (
+	ApplyNone    = "none"    // 服务未运行或配置无变化，下次启动时生效
+	ApplyLive    = "live"    // 已通过 IPC / 系统命令在线生效，Peer 连接不中断
+	ApplyRestart = "restart" // 网卡本身需要变更，已重建设备
+)
+
+// ApplyResult 配置热更新结果
+type ApplyResult struct {
+	Path    string   // ApplyNone | ApplyLive | ApplyRestart
+	Changes []string // 发生变化的配置项
+}
+
+// Apply 对比运行中的配置与新配置，仅应用有变化的部分
+// 监听端口、私钥、保活间隔、UAPI 套接字、日志等级以及 TUN 模式下的服务端地址、NAT 可在线修改；
+// 接口名、运行模式、MTU 以及 netstack 模式下的地址 / DNS 需要重建设备
+func (s *WireGuardServer) Apply(opts Options) (*ApplyResult, error) {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return &ApplyResult{Path: ApplyNone}, nil
+	}
+
+	if opts.Mode == "" {
+		opts.Mode = ModeTUN
+	}
+	if opts.MTU <= 0 {
+		opts.MTU = s.mtu
+	}
+
+	result := &ApplyResult{}
+	restart := false
+	change := func(name string, needRestart bool) {
+		result.Changes = append(result.Changes, name)
+		restart = restart || needRestart
+	}
+	if opts.Interface != s.ifaceName {
+		change("interface", true)
+	}
+	if opts.Mode != s.mode {
+		change("mode", true)
+	}
+	if opts.MTU != s.mtu {
+		change("mtu", true)
+	}
+	if opts.ListenPort != s.listenPort {
+		change("listenPort", false)
+	}
+	if opts.PrivateKey != s.privateKey {
+		change("privateKey", false)
+	}
+	if opts.Keepalive != s.keepalive {
+		change("persistentKeepalive", false)
+	}
+	// netstack 的地址与 DNS 在创建网络栈时确定；TUN 模式下 DNS 只用于客户端配置
+	if opts.Address != s.address {
+		change("address", s.mode == ModeNetstack)
+	}
+	if opts.UAPI != (s.uapi != nil) {
+		change("uapi", false)
+	}
+	if opts.DNSServer != s.dnsHandler {
+		change("builtinDns", false)
+	}
+	if opts.HandshakeDiag != s.handshakeDiag {
+		change("handshakeDiagnostics", true)
+	}
+	if normalizeLogLevel(opts.LogLevel) != s.LogLevel() {
+		change("logLevel", false)
+	}
+	if s.mode == ModeTUN && (opts.NAT != s.natEnabled || opts.OutInterface != s.natOut) {
+		change("nat", false)
+	}
+	// 钩子只在启动 / 停止时执行，修改后保存供下次使用
+	if opts.PostUp != s.postUp || opts.PostDown != s.postDown || opts.HookTimeout != s.hookTimeout || opts.PostUpRollback != s.postUpRollback {
+		change("hooks", false)
+	}
+	if s.mode == ModeNetstack {
+		if opts.DNS != s.dns {
+			change("dns", true)
+		}
+		if opts.ProxyAddress != s.proxyAddr {
+			change("proxyAddress", false)
+		}
+		if !slices.Equal(opts.ProxyAllow, s.proxyAllow) {
+			change("proxyAllow", false)
+		}
+	}
+
+	if len(result.Changes) == 0 {
+		s.mu.Unlock()
+		result.Path = ApplyNone
+		return result, nil
+	}
+
+	if restart {
+		s.mu.Unlock()
+		g.Log().Infof(context.Background(), "[WireGuard] 配置变更 %v 需要重建网卡", result.Changes)
+		if err := s.Stop(); err != nil {
+			return nil, err
+		}
+		time.Sleep(time.Second)
+		if err := s.Start(opts); err != nil {
+			return nil, err
+		}
+		result.Path = ApplyRestart
+		return result, nil
+	}
+
+	defer s.mu.Unlock()
+	if err := s.applyLiveLocked(opts); err != nil {
+		return nil, err
+	}
+	g.Log().Infof(context.Background(), "[WireGuard] 配置变更 %v 已在线生效", result.Changes)
+	result.Path = ApplyLive
+	return result, nil
+}
+
+// applyLiveLocked 在线应用无需重建网卡的配置项 (调用方需持有 s.mu)
+func (s *WireGuardServer) applyLiveLocked(opts Options) error {
+	natChanged := opts.NAT != s.natEnabled || opts.OutInterface != s.natOut || opts.Address != s.address
+	dnsChanged := opts.DNSServer != s.dnsHandler || opts.Address != s.address
+
+	// 1. 设备级参数：先按 opts 生成 IPC，设备接受后再更新内存状态，
+	// 失败时 (如端口被占用) 保留旧值，下次 Apply 仍能检测到差异并重试
+	var ipc strings.Builder
+	var publicKey string
+	keyChanged := opts.PrivateKey != s.privateKey
+	if keyChanged {
+		var err error
+		if publicKey, err = PublicKeyFromPrivate(opts.PrivateKey); err != nil {
+			return err
+		}
+		hexKey, _ := base64ToHex(opts.PrivateKey)
+		fmt.Fprintf(&ipc, "private_key=%s\n", hexKey)
+	}
+	if opts.ListenPort != s.listenPort {
+		fmt.Fprintf(&ipc, "listen_port=%d\n", opts.ListenPort)
+	}
+
+	// 2. 全局保活间隔：重新下发继承全局配置的站点互联 Peer
+	if opts.Keepalive != s.keepalive {
+		for _, p := range s.peers {
+			if !p.Enabled || p.StaticEndpoint == "" || p.Keepalive >= 0 {
+				continue
+			}
+			peerConf, err := peerIpc(p, opts.Keepalive)
+			if err != nil {
+				g.Log().Warningf(context.Background(), "[WireGuard] 跳过 Peer %s: %v", p.Name, err)
+				continue
+			}
+			ipc.WriteString(peerConf)
+		}
+	}
+
+	if ipc.Len() > 0 {
+		if err := s.dev.IpcSet(ipc.String()); err != nil {
+			return fmt.Errorf("配置 Device 失败: %v", err)
+		}
+	}
+	if keyChanged {
+		s.privateKey = opts.PrivateKey
+		s.publicKey = publicKey
+		s.handshakes.setKey(opts.PrivateKey)
+	}
+	s.listenPort = opts.ListenPort
+	s.keepalive = opts.Keepalive
+
+	// 3. 服务端地址 (TUN 模式)
+	if opts.Address != s.address {
+		if err := s.replaceAddressLocked(opts.Address); err != nil {
+			return err
+		}
+	}
+
+	// 4. netstack 内置代理
+	if s.mode == ModeNetstack && opts.ProxyAddress != s.proxyAddr {
+		s.netstack.listenProxy(context.Background(), opts.ProxyAddress)
+		s.proxyAddr = opts.ProxyAddress
+	}
+	if s.mode == ModeNetstack && !slices.Equal(opts.ProxyAllow, s.proxyAllow) {
+		s.netstack.setProxyAllow(opts.ProxyAllow)
+		s.proxyAllow = opts.ProxyAllow
+	}
+
+	// 5. UAPI 套接字
+	if opts.UAPI && s.uapi == nil {
+		if err := s.startUAPILocked(); err != nil {
+			return fmt.Errorf("开放 UAPI 套接字失败: %v", err)
+		}
+	} else if !opts.UAPI {
+		s.stopUAPILocked()
+	}
+
+	// 6. NAT 规则 (服务端网段或出口网卡变化时重新安装)
+	if s.mode == ModeTUN && natChanged {
+		s.natEnabled = opts.NAT
+		s.natOut = opts.OutInterface
+		s.setupNATLocked()
+	}
+
+	// 7. 内置 DNS (开关或服务端地址变化时重新监听)
+	if dnsChanged {
+		s.dnsHandler = opts.DNSServer
+		s.startDNSLocked()
+	}
+
+	// 8. 钩子与日志等级
+	s.setHooks(opts)
+	s.setLogLevel(opts.LogLevel)
+	return nil
+}
+
+// replaceAddressLocked 删除不再使用的服务端地址并添加新地址 (调用方需持有 s.mu)
+func (s *WireGuardServer) replaceAddressLocked(address string) error {
+	newPrefixes, err := ParseServerAddress(address)
+	if err != nil {
+		return err
+	}
+	oldPrefixes, _ := ParseServerAddress(s.address)
+
+	contains := func(list []netip.Prefix, p netip.Prefix) bool {
+		for _, x := range list {
+			if x == p {
+				return true
+			}
+		}
+		return false
+	}
+	for _, prefix := range oldPrefixes {
+		if !contains(newPrefixes, prefix) {
+			if err := removeInterfaceIP(s.tunName, prefix); err != nil {
+				g.Log().Warningf(context.Background(), "[WireGuard] %v", err)
+			}
+		}
+	}
+	for _, prefix := range newPrefixes {
+		if contains(oldPrefixes, prefix) {
+			continue
+		}
+		cidr := prefix.String()
+		if runtime.GOOS == "windows" {
+			if err := configureIPWithLUID(s.tun, cidr); err == nil {
+				continue
+			}
+		}
+		if err := s.configureInterfaceIP(s.tunName, cidr); err != nil {
+			return fmt.Errorf("配置地址 %s 失败: %v", cidr, err)
+		}
+	}
+	s.address = address
+	return nil
+}
@@ -0,0 +1,95 @@
+// ==========================================================================
+// OmniWire - 隧道地址上的内置 DNS 监听
+// 解析逻辑由服务层提供 (DNSHandler)，这里只负责在服务端隧道地址的 53 端口上
+// 建立 UDP / TCP 监听；TUN 模式使用系统网络，netstack 模式使用用户态网络栈
+// ==========================================================================
+
+package wgserver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// dnsPort 内置 DNS 监听端口
+const dnsPort = 53
+
+// DNSHandler 内置 DNS 服务，在监听关闭前持续处理请求
+type DNSHandler interface {
+	ServeUDP(conn net.PacketConn)
+	ServeTCP(l net.Listener)
+}
+
+// DNSListenAddrs 内置 DNS 正在监听的地址，未开启时返回 nil
+func (s *WireGuardServer) DNSListenAddrs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var addrs []string
+	for _, c := range s.dnsListeners {
+		switch l := c.(type) {
+		case net.PacketConn:
+			addrs = append(addrs, "udp://"+l.LocalAddr().String())
+		case net.Listener:
+			addrs = append(addrs, "tcp://"+l.Addr().String())
+		}
+	}
+	return addrs
+}
+
+// startDNSLocked 在所有服务端隧道地址上启动内置 DNS，单个地址失败只记录日志 (调用方需持有 s.mu)
+func (s *WireGuardServer) startDNSLocked() {
+	s.stopDNSLocked()
+	if s.dnsHandler == nil {
+		return
+	}
+	prefixes, err := ParseServerAddress(s.address)
+	if err != nil {
+		return
+	}
+	for _, prefix := range prefixes {
+		addr := netip.AddrPortFrom(prefix.Addr(), dnsPort)
+		conn, err := s.listenDNSUDP(addr)
+		if err != nil {
+			g.Log().Warningf(context.Background(), "[WireGuard] 内置 DNS 监听 udp %s 失败: %v", addr, err)
+			continue
+		}
+		s.dnsListeners = append(s.dnsListeners, conn)
+		go s.dnsHandler.ServeUDP(conn)
+
+		l, err := s.listenDNSTCP(addr)
+		if err != nil {
+			g.Log().Warningf(context.Background(), "[WireGuard] 内置 DNS 监听 tcp %s 失败: %v", addr, err)
+			continue
+		}
+		s.dnsListeners = append(s.dnsListeners, l)
+		go s.dnsHandler.ServeTCP(l)
+	}
+	if len(s.dnsListeners) > 0 {
+		g.Log().Infof(context.Background(), "[WireGuard] 内置 DNS 已在 %s 的隧道地址上监听", s.ifaceName)
+	}
+}
+
+// stopDNSLocked 关闭内置 DNS 监听 (调用方需持有 s.mu)
+func (s *WireGuardServer) stopDNSLocked() {
+	for _, c := range s.dnsListeners {
+		c.Close()
+	}
+	s.dnsListeners = nil
+}
+
+func (s *WireGuardServer) listenDNSUDP(addr netip.AddrPort) (net.PacketConn, error) {
+	if s.netstack != nil {
+		return s.netstack.net.ListenUDPAddrPort(addr)
+	}
+	return net.ListenUDP("udp", net.UDPAddrFromAddrPort(addr))
+}
+
+func (s *WireGuardServer) listenDNSTCP(addr netip.AddrPort) (net.Listener, error) {
+	if s.netstack != nil {
+		return s.netstack.net.ListenTCPAddrPort(addr)
+	}
+	return net.ListenTCP("tcp", net.TCPAddrFromAddrPort(addr))
+}
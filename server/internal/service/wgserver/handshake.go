@@ -0,0 +1,449 @@
+// ==========================================================================
+// OmniWire - 握手失败诊断
+// 包装 UDP Bind，在握手发起包交给 wireguard-go 之前用服务端私钥独立解出客户端公钥，
+// 记录会被拒绝的握手 (服务端公钥不符、未知 / 已禁用的客户端、时间戳回退) 及其来源地址。
+// 只读取数据包，不影响 wireguard-go 的处理结果；包装后 Linux 上不再启用粘性套接字的
+// 路由监听 (仅在路由变化时刷新回包源地址)，因此按接口配置开启 (Options.HandshakeDiag)，默认关闭
+// ==========================================================================
+
+package wgserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// 握手被拒绝的原因
+const (
+	RejectWrongServerKey = "wrong_server_key" // mac1 校验失败：客户端配置的服务端公钥不正确 (如密钥轮换后未更新配置)
+	RejectInvalid        = "invalid"          // 无法解密，数据包损坏或伪造
+	RejectUnknownPeer    = "unknown_peer"     // 客户端公钥不属于该接口
+	RejectDisabledPeer   = "disabled_peer"    // 客户端已禁用
+	RejectStaleTimestamp = "stale_timestamp"  // 时间戳不晚于上一次握手：客户端时钟回拨或重放
+)
+
+const (
+	// maxHandshakeRejects 每个接口保留的拒绝记录数，超出时淘汰最久未出现的记录
+	maxHandshakeRejects = 200
+	// handshakeInspectRate 每秒最多检查的握手发起包，超出部分不做诊断 (避免放大洪水攻击的开销)
+	handshakeInspectRate = 100
+	// handshakeLogRate 每分钟最多写入日志的新拒绝记录，其余只计数，在下一条日志中汇总
+	// (服务端公钥不符按来源 IP 记录，扫描器可在短时间内产生大量新记录)
+	handshakeLogRate = 10
+)
+
+// WireGuard 握手发起包格式 (type, sender, ephemeral, static, timestamp, mac1, mac2)
+const (
+	initiationSize     = 148
+	initiationType     = 1
+	offsetEphemeral    = 8
+	offsetStatic       = 40
+	offsetTimestamp    = 88
+	offsetMAC1         = 116
+	tai64nBase         = uint64(0x400000000000000a)
+	noiseConstruction  = "Noise_IKpsk2_25519_ChaChaPoly_BLAKE2s"
+	noiseIdentifier    = "WireGuard v1 zx2c4 Jason@zx2c4.com"
+	noiseLabelMAC1     = "mac1----"
+	sealedStaticSize   = 32 + chacha20poly1305.Overhead
+	sealedTimestampLen = 12 + chacha20poly1305.Overhead
+)
+
+var (
+	noiseInitialChainKey [blake2s.Size]byte
+	noiseInitialHash     [blake2s.Size]byte
+	noiseZeroNonce       [chacha20poly1305.NonceSize]byte
+)
+
+func init() {
+	noiseInitialChainKey = blake2s.Sum256([]byte(noiseConstruction))
+	noiseInitialHash = mixHash(noiseInitialChainKey, []byte(noiseIdentifier))
+}
+
+// HandshakeReject 被拒绝的握手，同一来源 IP、公钥与原因合并为一条
+type HandshakeReject struct {
+	Endpoint   string // 最近一次的来源地址 ip:port
+	PublicKey  string // 客户端公钥 (Base64)，服务端公钥不符或无法解密时为空
+	PeerId     int    // 对应的客户端 ID，未知客户端为 0
+	PeerName   string
+	Reason     string // RejectXxx
+	Count      uint64
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	ClientTime time.Time // 握手包中的客户端时间，仅时间戳回退时有值
+}
+
+type rejectKey struct {
+	ip        netip.Addr
+	publicKey [32]byte
+	reason    string
+}
+
+// handshakePeer 诊断用的 Peer 信息
+type handshakePeer struct {
+	id      int
+	name    string
+	enabled bool
+}
+
+// handshakeMonitor 握手诊断状态，零值可用，设置私钥后开始检查
+type handshakeMonitor struct {
+	mu         sync.Mutex
+	ready      bool
+	privateKey [32]byte
+	mac1Key    [blake2s.Size]byte
+	hash0      [blake2s.Size]byte // 已混入服务端公钥的初始哈希
+
+	peers        map[[32]byte]handshakePeer
+	staticStatic map[[32]byte][32]byte // 服务端私钥与客户端公钥的共享密钥缓存
+	timestamps   map[[32]byte][12]byte // 每个客户端最近一次的握手时间戳
+
+	rejects map[rejectKey]*HandshakeReject
+
+	windowStart time.Time
+	inspected   int
+
+	logWindowStart time.Time
+	logged         int // 当前分钟已写入日志的记录数
+	suppressed     int // 超出 handshakeLogRate 未写入日志的记录数
+
+	onReject func(r HandshakeReject, suppressed int) // 新增一条需要写入日志的拒绝记录时回调 (在锁外调用)，suppressed 为此前省略的记录数
+}
+
+// start 设备启动时设置服务端私钥与拒绝回调
+func (m *handshakeMonitor) start(privateKey string, onReject func(r HandshakeReject, suppressed int)) {
+	m.mu.Lock()
+	m.onReject = onReject
+	m.mu.Unlock()
+	m.setKey(privateKey)
+}
+
+// setKey 设置服务端私钥，清空与旧密钥相关的缓存
+func (m *handshakeMonitor) setKey(privateKey string) {
+	raw, err := base64.StdEncoding.DecodeString(privateKey)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ready = err == nil && len(raw) == 32
+	if !m.ready {
+		return
+	}
+	copy(m.privateKey[:], raw)
+	var pub [32]byte
+	curve25519.ScalarBaseMult(&pub, &m.privateKey)
+	m.mac1Key = blake2s.Sum256(append([]byte(noiseLabelMAC1), pub[:]...))
+	m.hash0 = mixHash(noiseInitialHash, pub[:])
+	m.staticStatic = nil
+}
+
+// sync 更新客户端列表；已删除或禁用的客户端重新启用时 wireguard-go 会重置其时间戳，这里同步清除
+func (m *handshakeMonitor) sync(peers map[string]*Peer) {
+	next := make(map[[32]byte]handshakePeer, len(peers))
+	for key, p := range peers {
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(raw) != 32 {
+			continue
+		}
+		next[[32]byte(raw)] = handshakePeer{id: p.Id, name: p.Name, enabled: p.Enabled}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.timestamps {
+		if !next[key].enabled {
+			delete(m.timestamps, key)
+		}
+	}
+	m.peers = next
+}
+
+// list 拒绝记录，按最近出现时间倒序
+func (m *handshakeMonitor) list() []HandshakeReject {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]HandshakeReject, 0, len(m.rejects))
+	for _, r := range m.rejects {
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastSeen.After(result[j].LastSeen) })
+	return result
+}
+
+func (m *handshakeMonitor) clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejects = nil
+}
+
+// inspect 检查一个握手发起包，msg 长度需为 initiationSize
+func (m *handshakeMonitor) inspect(msg []byte, endpoint string, ip netip.Addr, now time.Time) {
+	m.mu.Lock()
+	reject, isNew := m.inspectLocked(msg, endpoint, ip, now)
+	callback := m.onReject
+	suppressed, shouldLog := 0, false
+	if isNew {
+		suppressed, shouldLog = m.allowLogLocked(now)
+	}
+	m.mu.Unlock()
+	if shouldLog && callback != nil {
+		callback(reject, suppressed)
+	}
+}
+
+// allowLogLocked 按 handshakeLogRate 限制日志条数，允许写入时返回此前省略的记录数
+func (m *handshakeMonitor) allowLogLocked(now time.Time) (int, bool) {
+	if now.Sub(m.logWindowStart) >= time.Minute {
+		m.logWindowStart = now
+		m.logged = 0
+	}
+	if m.logged >= handshakeLogRate {
+		m.suppressed++
+		return 0, false
+	}
+	m.logged++
+	suppressed := m.suppressed
+	m.suppressed = 0
+	return suppressed, true
+}
+
+func (m *handshakeMonitor) inspectLocked(msg []byte, endpoint string, ip netip.Addr, now time.Time) (HandshakeReject, bool) {
+	if !m.ready {
+		return HandshakeReject{}, false
+	}
+	if now.Sub(m.windowStart) >= time.Second {
+		m.windowStart = now
+		m.inspected = 0
+	}
+	if m.inspected >= handshakeInspectRate {
+		return HandshakeReject{}, false
+	}
+	m.inspected++
+
+	// 1. mac1 以服务端公钥为密钥，校验失败说明客户端使用了错误的服务端公钥
+	mac, _ := blake2s.New128(m.mac1Key[:])
+	mac.Write(msg[:offsetMAC1])
+	if !hmac.Equal(mac.Sum(nil), msg[offsetMAC1:offsetMAC1+blake2s.Size128]) {
+		return m.recordLocked(rejectKey{ip: ip, reason: RejectWrongServerKey}, endpoint, now, time.Time{})
+	}
+
+	// 2. 解出客户端公钥 (与 wireguard-go ConsumeMessageInitiation 相同的 Noise IK 步骤)
+	ephemeral := msg[offsetEphemeral:offsetStatic]
+	h := mixHash(m.hash0, ephemeral)
+	chainKey := kdf1(noiseInitialChainKey[:], ephemeral)
+	ss, err := curve25519.X25519(m.privateKey[:], ephemeral)
+	if err != nil {
+		return m.recordLocked(rejectKey{ip: ip, reason: RejectInvalid}, endpoint, now, time.Time{})
+	}
+	chainKey, key := kdf2(chainKey[:], ss)
+	aead, _ := chacha20poly1305.New(key[:])
+	sealedStatic := msg[offsetStatic : offsetStatic+sealedStaticSize]
+	peerKey, err := aead.Open(nil, noiseZeroNonce[:], sealedStatic, h[:])
+	if err != nil {
+		return m.recordLocked(rejectKey{ip: ip, reason: RejectInvalid}, endpoint, now, time.Time{})
+	}
+	h = mixHash(h, sealedStatic)
+	publicKey := [32]byte(peerKey)
+
+	// 3. 客户端是否存在且已启用
+	peer, ok := m.peers[publicKey]
+	if !ok {
+		return m.recordLocked(rejectKey{ip: ip, publicKey: publicKey, reason: RejectUnknownPeer}, endpoint, now, time.Time{})
+	}
+	if !peer.enabled {
+		return m.recordLocked(rejectKey{ip: ip, publicKey: publicKey, reason: RejectDisabledPeer}, endpoint, now, time.Time{})
+	}
+
+	// 4. 时间戳必须晚于上一次握手
+	shared, ok := m.staticStatic[publicKey]
+	if !ok {
+		raw, err := curve25519.X25519(m.privateKey[:], publicKey[:])
+		if err != nil {
+			return m.recordLocked(rejectKey{ip: ip, publicKey: publicKey, reason: RejectInvalid}, endpoint, now, time.Time{})
+		}
+		shared = [32]byte(raw)
+		if m.staticStatic == nil {
+			m.staticStatic = make(map[[32]byte][32]byte)
+		}
+		m.staticStatic[publicKey] = shared
+	}
+	_, key = kdf2(chainKey[:], shared[:])
+	aead, _ = chacha20poly1305.New(key[:])
+	stamp, err := aead.Open(nil, noiseZeroNonce[:], msg[offsetTimestamp:offsetTimestamp+sealedTimestampLen], h[:])
+	if err != nil {
+		return m.recordLocked(rejectKey{ip: ip, publicKey: publicKey, reason: RejectInvalid}, endpoint, now, time.Time{})
+	}
+	timestamp := [12]byte(stamp)
+	if last, ok := m.timestamps[publicKey]; ok && bytes.Compare(timestamp[:], last[:]) <= 0 {
+		return m.recordLocked(rejectKey{ip: ip, publicKey: publicKey, reason: RejectStaleTimestamp}, endpoint, now, tai64nTime(timestamp))
+	}
+	if m.timestamps == nil {
+		m.timestamps = make(map[[32]byte][12]byte)
+	}
+	m.timestamps[publicKey] = timestamp
+	return HandshakeReject{}, false
+}
+
+// recordLocked 合并或新增拒绝记录，新增时返回 true
+func (m *handshakeMonitor) recordLocked(key rejectKey, endpoint string, now, clientTime time.Time) (HandshakeReject, bool) {
+	if r, ok := m.rejects[key]; ok {
+		r.Endpoint = endpoint
+		r.Count++
+		r.LastSeen = now
+		r.ClientTime = clientTime
+		return *r, false
+	}
+	if m.rejects == nil {
+		m.rejects = make(map[rejectKey]*HandshakeReject)
+	}
+	if len(m.rejects) >= maxHandshakeRejects {
+		var oldest rejectKey
+		var oldestTime time.Time
+		for k, r := range m.rejects {
+			if oldestTime.IsZero() || r.LastSeen.Before(oldestTime) {
+				oldest, oldestTime = k, r.LastSeen
+			}
+		}
+		delete(m.rejects, oldest)
+	}
+	r := &HandshakeReject{
+		Endpoint:   endpoint,
+		Reason:     key.reason,
+		Count:      1,
+		FirstSeen:  now,
+		LastSeen:   now,
+		ClientTime: clientTime,
+	}
+	if key.publicKey != [32]byte{} {
+		r.PublicKey = base64.StdEncoding.EncodeToString(key.publicKey[:])
+		peer := m.peers[key.publicKey]
+		r.PeerId, r.PeerName = peer.id, peer.name
+	}
+	m.rejects[key] = r
+	return *r, true
+}
+
+// handshakeBind 包装 conn.Bind，接收数据时检查握手发起包
+type handshakeBind struct {
+	conn.Bind
+	monitor *handshakeMonitor
+}
+
+func newHandshakeBind(bind conn.Bind, monitor *handshakeMonitor) *handshakeBind {
+	return &handshakeBind{Bind: bind, monitor: monitor}
+}
+
+func (b *handshakeBind) Open(port uint16) ([]conn.ReceiveFunc, uint16, error) {
+	fns, actualPort, err := b.Bind.Open(port)
+	if err != nil {
+		return nil, 0, err
+	}
+	wrapped := make([]conn.ReceiveFunc, len(fns))
+	for i, fn := range fns {
+		wrapped[i] = b.wrapReceive(fn)
+	}
+	return wrapped, actualPort, nil
+}
+
+func (b *handshakeBind) wrapReceive(fn conn.ReceiveFunc) conn.ReceiveFunc {
+	return func(packets [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+		n, err := fn(packets, sizes, eps)
+		for i := 0; i < n; i++ {
+			packet := packets[i][:sizes[i]]
+			if len(packet) != initiationSize || binary.LittleEndian.Uint32(packet) != initiationType {
+				continue
+			}
+			b.monitor.inspect(packet, eps[i].DstToString(), eps[i].DstIP(), time.Now())
+		}
+		return n, err
+	}
+}
+
+// HandshakeDiagEnabled 服务运行中且开启了握手诊断
+func (s *WireGuardServer) HandshakeDiagEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.running && s.handshakeDiag
+}
+
+// HandshakeRejects 最近被拒绝的握手，按最近出现时间倒序
+func (s *WireGuardServer) HandshakeRejects() []HandshakeReject {
+	return s.handshakes.list()
+}
+
+// ClearHandshakeRejects 清空被拒绝的握手记录
+func (s *WireGuardServer) ClearHandshakeRejects() {
+	s.handshakes.clear()
+}
+
+// logHandshakeReject 新的拒绝记录写入程序日志与设备日志，suppressed 为此前因限流省略的记录数
+// 在接收协程中调用，不能获取 s.mu
+func (s *WireGuardServer) logHandshakeReject(ifaceName string, r HandshakeReject, suppressed int) {
+	who := r.PublicKey
+	if r.PeerName != "" {
+		who = fmt.Sprintf("%s (%s)", r.PeerName, r.PublicKey)
+	}
+	message := fmt.Sprintf("拒绝来自 %s 的握手: %s", r.Endpoint, r.Reason)
+	if who != "" {
+		message += "，客户端 " + who
+	}
+	if suppressed > 0 {
+		message += fmt.Sprintf(" (此前另有 %d 条新的拒绝记录未写入日志)", suppressed)
+	}
+	s.logs.add(DeviceLogError, message)
+	g.Log().Warningf(context.Background(), "[WireGuard] (%s) %s", ifaceName, message)
+}
+
+// ==================== Noise 辅助函数 ====================
+
+func newBlake2s() hash.Hash {
+	h, _ := blake2s.New256(nil)
+	return h
+}
+
+func hmacBlake2s(key []byte, inputs ...[]byte) [blake2s.Size]byte {
+	mac := hmac.New(newBlake2s, key)
+	for _, in := range inputs {
+		mac.Write(in)
+	}
+	var sum [blake2s.Size]byte
+	mac.Sum(sum[:0])
+	return sum
+}
+
+func mixHash(h [blake2s.Size]byte, data []byte) [blake2s.Size]byte {
+	d := newBlake2s()
+	d.Write(h[:])
+	d.Write(data)
+	var sum [blake2s.Size]byte
+	d.Sum(sum[:0])
+	return sum
+}
+
+func kdf1(key, input []byte) [blake2s.Size]byte {
+	prk := hmacBlake2s(key, input)
+	return hmacBlake2s(prk[:], []byte{0x1})
+}
+
+func kdf2(key, input []byte) ([blake2s.Size]byte, [blake2s.Size]byte) {
+	prk := hmacBlake2s(key, input)
+	t0 := hmacBlake2s(prk[:], []byte{0x1})
+	t1 := hmacBlake2s(prk[:], t0[:], []byte{0x2})
+	return t0, t1
+}
+
+// tai64nTime 解析握手包中的 TAI64N 时间戳
+func tai64nTime(t [12]byte) time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint64(t[:8])-tai64nBase), int64(binary.BigEndian.Uint32(t[8:])))
+}
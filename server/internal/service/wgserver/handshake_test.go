@@ -0,0 +1,163 @@
+package wgserver
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+func mustKeyPair(t *testing.T) (priv, pub [32]byte) {
+	t.Helper()
+	privB64, pubB64, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := base64.StdEncoding.DecodeString(privB64)
+	b, _ := base64.StdEncoding.DecodeString(pubB64)
+	return [32]byte(a), [32]byte(b)
+}
+
+// buildInitiation 按客户端一侧的 Noise IK 步骤构造握手发起包
+func buildInitiation(t *testing.T, clientPriv, serverPub [32]byte, at time.Time) []byte {
+	t.Helper()
+	msg := make([]byte, initiationSize)
+	binary.LittleEndian.PutUint32(msg, initiationType)
+	binary.LittleEndian.PutUint32(msg[4:], 42)
+
+	ephPriv, ephPub := mustKeyPair(t)
+	copy(msg[offsetEphemeral:], ephPub[:])
+	h := mixHash(mixHash(noiseInitialHash, serverPub[:]), ephPub[:])
+	chainKey := kdf1(noiseInitialChainKey[:], ephPub[:])
+
+	ss, _ := curve25519.X25519(ephPriv[:], serverPub[:])
+	chainKey, key := kdf2(chainKey[:], ss)
+	var clientPub [32]byte
+	curve25519.ScalarBaseMult(&clientPub, &clientPriv)
+	aead, _ := chacha20poly1305.New(key[:])
+	aead.Seal(msg[offsetStatic:offsetStatic], noiseZeroNonce[:], clientPub[:], h[:])
+	h = mixHash(h, msg[offsetStatic:offsetStatic+sealedStaticSize])
+
+	ss, _ = curve25519.X25519(clientPriv[:], serverPub[:])
+	_, key = kdf2(chainKey[:], ss)
+	var stamp [12]byte
+	binary.BigEndian.PutUint64(stamp[:], tai64nBase+uint64(at.Unix()))
+	binary.BigEndian.PutUint32(stamp[8:], uint32(at.Nanosecond()))
+	aead, _ = chacha20poly1305.New(key[:])
+	aead.Seal(msg[offsetTimestamp:offsetTimestamp], noiseZeroNonce[:], stamp[:], h[:])
+
+	mac1Key := blake2s.Sum256(append([]byte(noiseLabelMAC1), serverPub[:]...))
+	mac, _ := blake2s.New128(mac1Key[:])
+	mac.Write(msg[:offsetMAC1])
+	copy(msg[offsetMAC1:], mac.Sum(nil))
+	return msg
+}
+
+func TestHandshakeMonitor(t *testing.T) {
+	serverPriv, serverPub := mustKeyPair(t)
+	_, otherPub := mustKeyPair(t)
+	goodPriv, goodPub := mustKeyPair(t)
+	disabledPriv, disabledPub := mustKeyPair(t)
+	unknownPriv, unknownPub := mustKeyPair(t)
+
+	var m handshakeMonitor
+	var reported []HandshakeReject
+	m.start(base64.StdEncoding.EncodeToString(serverPriv[:]), func(r HandshakeReject, _ int) { reported = append(reported, r) })
+	key := func(k [32]byte) string { return base64.StdEncoding.EncodeToString(k[:]) }
+	m.sync(map[string]*Peer{
+		key(goodPub):     {Id: 1, Name: "laptop", Enabled: true},
+		key(disabledPub): {Id: 2, Name: "old-phone", Enabled: false},
+	})
+
+	ip := netip.MustParseAddr("203.0.113.7")
+	now := time.Now()
+	send := func(msg []byte) { m.inspect(msg, "203.0.113.7:40000", ip, now) }
+
+	send(buildInitiation(t, goodPriv, serverPub, now))
+	if len(reported) != 0 {
+		t.Fatalf("valid handshake rejected: %+v", reported)
+	}
+
+	send(buildInitiation(t, goodPriv, otherPub, now))
+	send(buildInitiation(t, unknownPriv, serverPub, now))
+	send(buildInitiation(t, unknownPriv, serverPub, now))
+	send(buildInitiation(t, disabledPriv, serverPub, now))
+	send(buildInitiation(t, goodPriv, serverPub, now.Add(-time.Hour)))
+
+	want := []string{RejectWrongServerKey, RejectUnknownPeer, RejectDisabledPeer, RejectStaleTimestamp}
+	if len(reported) != len(want) {
+		t.Fatalf("reported %d rejects, want %d: %+v", len(reported), len(want), reported)
+	}
+	for i, reason := range want {
+		if reported[i].Reason != reason {
+			t.Errorf("reject %d reason = %s, want %s", i, reported[i].Reason, reason)
+		}
+	}
+	if reported[0].PublicKey != "" || reported[1].PublicKey != key(unknownPub) {
+		t.Errorf("unexpected public keys: %q, %q", reported[0].PublicKey, reported[1].PublicKey)
+	}
+	if reported[2].PeerId != 2 || reported[2].PeerName != "old-phone" {
+		t.Errorf("disabled peer not identified: %+v", reported[2])
+	}
+	if got := reported[3].ClientTime.Unix(); got != now.Add(-time.Hour).Unix() {
+		t.Errorf("client time = %d, want %d", got, now.Add(-time.Hour).Unix())
+	}
+
+	list := m.list()
+	if len(list) != 4 {
+		t.Fatalf("list has %d entries, want 4", len(list))
+	}
+	for _, r := range list {
+		if r.Reason == RejectUnknownPeer && r.Count != 2 {
+			t.Errorf("unknown peer count = %d, want 2", r.Count)
+		}
+	}
+
+	// 重新启用后 wireguard-go 重置时间戳，较早的时间戳不再视为回退
+	m.sync(map[string]*Peer{key(goodPub): {Id: 1, Name: "laptop", Enabled: false}})
+	m.sync(map[string]*Peer{key(goodPub): {Id: 1, Name: "laptop", Enabled: true}})
+	reported = nil
+	send(buildInitiation(t, goodPriv, serverPub, now.Add(-2*time.Hour)))
+	if len(reported) != 0 {
+		t.Fatalf("handshake after re-enable rejected: %+v", reported)
+	}
+}
+
+func TestHandshakeMonitorRateLimitsLogs(t *testing.T) {
+	serverPriv, _ := mustKeyPair(t)
+	_, otherPub := mustKeyPair(t)
+	clientPriv, _ := mustKeyPair(t)
+
+	var m handshakeMonitor
+	logged, suppressed := 0, 0
+	m.start(base64.StdEncoding.EncodeToString(serverPriv[:]), func(_ HandshakeReject, n int) {
+		logged++
+		suppressed += n
+	})
+
+	// 扫描器从不同 IP 使用错误的服务端公钥，每个 IP 都是一条新记录
+	now := time.Now()
+	msg := buildInitiation(t, clientPriv, otherPub, now)
+	for i := 0; i < 50; i++ {
+		ip := netip.AddrFrom4([4]byte{198, 51, 100, byte(i)})
+		m.inspect(msg, ip.String()+":40000", ip, now.Add(time.Duration(i)*time.Second/50))
+	}
+	if logged != handshakeLogRate {
+		t.Fatalf("logged %d rejects, want %d", logged, handshakeLogRate)
+	}
+	if len(m.list()) != 50 {
+		t.Fatalf("recorded %d rejects, want 50", len(m.list()))
+	}
+
+	// 下一分钟的第一条日志汇总此前省略的记录
+	ip := netip.MustParseAddr("198.51.100.200")
+	m.inspect(msg, "198.51.100.200:40000", ip, now.Add(time.Minute))
+	if logged != handshakeLogRate+1 || suppressed != 50-handshakeLogRate {
+		t.Fatalf("logged %d, suppressed %d", logged, suppressed)
+	}
+}
@@ -0,0 +1,125 @@
+// ==========================================================================
+// OmniWire - PostUp / PostDown 钩子
+// 与 wg-quick 一致：每行一条命令，%i 替换为网卡真实名称；PostUp 在网卡就绪后执行，
+// PostDown 在网卡删除后执行，执行结果保留最近若干条供 API 查看
+// ==========================================================================
+
+package wgserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 钩子类型
+const (
+	HookPostUp   = "PostUp"
+	HookPostDown = "PostDown"
+)
+
+const (
+	defaultHookTimeout = 30 * time.Second
+	maxHookOutput      = 4096 // 每条命令保留的输出字节数
+	maxHookResults     = 20   // 每个接口保留的执行结果条数
+)
+
+// HookResult 钩子命令执行结果
+type HookResult struct {
+	Hook     string // HookPostUp | HookPostDown
+	Command  string // 替换 %i 后的命令
+	Output   string // 标准输出与标准错误，超出部分截断
+	ExitCode int    // 超时或无法执行时为 -1
+	Error    string
+	Duration time.Duration
+	RanAt    time.Time
+}
+
+// HookResults 最近的钩子执行结果 (按时间倒序)
+func (s *WireGuardServer) HookResults() []HookResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := make([]HookResult, 0, len(s.hookResults))
+	for i := len(s.hookResults) - 1; i >= 0; i-- {
+		results = append(results, s.hookResults[i])
+	}
+	return results
+}
+
+// runHook 依次执行钩子中的每条命令，遇到失败即停止 (调用方不能持有 s.mu)
+func (s *WireGuardServer) runHook(hook, script, ifaceName string, timeout time.Duration) error {
+	if strings.TrimSpace(script) == "" {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result := runHookCommand(hook, strings.ReplaceAll(line, "%i", ifaceName), timeout)
+		s.mu.Lock()
+		s.hookResults = append(s.hookResults, result)
+		if len(s.hookResults) > maxHookResults {
+			s.hookResults = s.hookResults[len(s.hookResults)-maxHookResults:]
+		}
+		s.mu.Unlock()
+
+		if result.Error != "" {
+			g.Log().Errorf(context.Background(), "[WireGuard] %s 执行失败: %s: %s, output: %s", hook, result.Command, result.Error, result.Output)
+			return fmt.Errorf("%s 命令 %q 执行失败: %s", hook, result.Command, result.Error)
+		}
+		g.Log().Infof(context.Background(), "[WireGuard] %s 已执行: %s", hook, result.Command)
+	}
+	return nil
+}
+
+// runHookCommand 通过系统 shell 执行单条命令
+func runHookCommand(hook, command string, timeout time.Duration) HookResult {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// 超时后不再等待子进程继承的输出管道
+	cmd.WaitDelay = time.Second
+
+	result := HookResult{Hook: hook, Command: command, RanAt: time.Now()}
+	err := cmd.Run()
+	result.Duration = time.Since(result.RanAt)
+	result.Output = strings.TrimSpace(output.String())
+	if len(result.Output) > maxHookOutput {
+		result.Output = result.Output[:maxHookOutput] + "...(truncated)"
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		result.Error = fmt.Sprintf("执行超时 (%s)", timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Error = err.Error()
+	default:
+		result.ExitCode = -1
+		result.Error = err.Error()
+	}
+	return result
+}
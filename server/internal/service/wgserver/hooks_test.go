@@ -0,0 +1,68 @@
+package wgserver_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogf/gf/v2/database/gdb"
+
+	"omniwire/internal/cmd"
+	"omniwire/internal/service/wgserver"
+)
+
+// TestPostUpFailureRollsBackStart PostUp 失败且开启回滚时服务不应保持运行，
+// 执行结果按时间倒序保留，后续命令不再执行
+func TestPostUpFailureRollsBackStart(t *testing.T) {
+	gdb.SetConfig(gdb.Config{"default": gdb.ConfigGroup{{Type: "sqlite", Link: "sqlite::@file(" + t.TempDir() + "/omniwire.db)"}}})
+	if err := cmd.InitDatabase(context.Background()); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+
+	privateKey, _, _ := wgserver.GenerateKeyPair()
+	server := wgserver.GetServer(99)
+	defer wgserver.RemoveServer(99)
+	opts := wgserver.Options{
+		Interface:      "hooktest",
+		Mode:           wgserver.ModeNetstack,
+		ListenPort:     freeUDPPort(t),
+		PrivateKey:     privateKey,
+		Address:        "10.98.0.1/24",
+		PostUp:         "echo up %i\nexit 3\necho never",
+		PostDown:       "echo down %i",
+		HookTimeout:    5 * time.Second,
+		PostUpRollback: true,
+	}
+	err := server.Start(opts)
+	if err == nil || server.IsRunning() {
+		t.Fatalf("expected start to be rolled back, err=%v running=%v", err, server.IsRunning())
+	}
+
+	results := server.HookResults()
+	if len(results) != 3 {
+		t.Fatalf("expected 3 hook results, got %+v", results)
+	}
+	down, failed, up := results[0], results[1], results[2]
+	if up.Output != "up hooktest" || up.ExitCode != 0 {
+		t.Fatalf("unexpected PostUp result: %+v", up)
+	}
+	if failed.ExitCode != 3 || failed.Error == "" {
+		t.Fatalf("expected exit code 3, got %+v", failed)
+	}
+	if down.Hook != wgserver.HookPostDown || down.Output != "down hooktest" {
+		t.Fatalf("unexpected PostDown result: %+v", down)
+	}
+
+	// 超时的命令被终止
+	opts.PostUp = "sleep 5"
+	opts.HookTimeout = 200 * time.Millisecond
+	opts.PostDown = ""
+	err = server.Start(opts)
+	if err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if r := server.HookResults()[0]; r.ExitCode != -1 || r.Duration > 2*time.Second {
+		t.Fatalf("unexpected timeout result: %+v", r)
+	}
+}
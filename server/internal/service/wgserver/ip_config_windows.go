@@ -16,19 +16,19 @@ import (
 
 // configureIPWithLUID 使用 Windows LUID API 配置 IP 地址
 func configureIPWithLUID(tunDevice tun.Device, address string) error {
-	fmt.Printf("[DEBUG] configureIPWithLUID called with address: %s\n", address)
+	g.Log().Debugf(context.Background(), "[WireGuard] configureIPWithLUID called with address: %s", address)
 
 	// 解析 CIDR 地址
 	prefix, err := netip.ParsePrefix(address)
 	if err != nil {
-		fmt.Printf("[DEBUG] ParsePrefix failed: %v\n", err)
+		g.Log().Debugf(context.Background(), "[WireGuard] ParsePrefix failed: %v", err)
 		return fmt.Errorf("解析地址失败: %v", err)
 	}
-	fmt.Printf("[DEBUG] Parsed prefix: %s\n", prefix.String())
+	g.Log().Debugf(context.Background(), "[WireGuard] Parsed prefix: %s", prefix.String())
 
-	// 如果 IP 等于网络地址（主机位全 0），自动修正为 .1
+	// 如果 IP 等于网络地址（主机位全 0），自动修正为 .1 (/31、/32 没有网络地址)
 	addr := prefix.Addr()
-	if addr.Is4() {
+	if addr.Is4() && prefix.Bits() < 31 {
 		ip4 := addr.As4()
 		bits := prefix.Bits()
 		shift := uint(32 - bits)
@@ -43,57 +43,62 @@ func configureIPWithLUID(tunDevice tun.Device, address string) error {
 			ip4[3] = byte(hostNum)
 			addr = netip.AddrFrom4(ip4)
 			prefix = netip.PrefixFrom(addr, bits)
-			fmt.Printf("[DEBUG] Auto-corrected to: %s\n", prefix.String())
+			g.Log().Debugf(context.Background(), "[WireGuard] Auto-corrected to: %s", prefix.String())
 			g.Log().Infof(context.Background(), "[WireGuard] 检测到网络地址，自动修正服务端 IP 为: %s", addr.String())
 		}
 	}
 
+	family := winipcfg.AddressFamily(windows.AF_INET)
+	if addr.Is6() {
+		family = winipcfg.AddressFamily(windows.AF_INET6)
+	}
+
 	// 获取 NativeTun 以访问 LUID
-	fmt.Printf("[DEBUG] Getting NativeTun...\n")
+	g.Log().Debugf(context.Background(), "[WireGuard] Getting NativeTun...")
 	nativeTun, ok := tunDevice.(*tun.NativeTun)
 	if !ok {
-		fmt.Printf("[DEBUG] Failed to cast to NativeTun\n")
+		g.Log().Debugf(context.Background(), "[WireGuard] Failed to cast to NativeTun")
 		return fmt.Errorf("无法获取 NativeTun 类型")
 	}
 
 	// 获取 LUID
 	luid := winipcfg.LUID(nativeTun.LUID())
-	fmt.Printf("[DEBUG] Got LUID: %d\n", luid)
+	g.Log().Debugf(context.Background(), "[WireGuard] Got LUID: %d", luid)
 	g.Log().Infof(context.Background(), "[WireGuard] 获取到 LUID: %d", luid)
 
 	// 等待接口完全就绪
-	fmt.Printf("[DEBUG] Waiting 2 seconds for interface...\n")
+	g.Log().Debugf(context.Background(), "[WireGuard] Waiting 2 seconds for interface...")
 	g.Log().Infof(context.Background(), "[WireGuard] 等待接口初始化...")
 	time.Sleep(2 * time.Second)
 
 	// 重试机制
 	var lastErr error
 	for i := 0; i < 5; i++ {
-		fmt.Printf("[DEBUG] Attempt %d/5: Setting IP %s\n", i+1, prefix.String())
+		g.Log().Debugf(context.Background(), "[WireGuard] Attempt %d/5: Setting IP %s", i+1, prefix.String())
 		g.Log().Infof(context.Background(), "[WireGuard] 使用 LUID 配置 IP (%d/5): %s", i+1, prefix.String())
 
-		// 先清除现有 IP 配置 (AF_INET = 2 for IPv4)
-		flushErr := luid.FlushIPAddresses(winipcfg.AddressFamily(windows.AF_INET))
+		// 先清除同一地址族的现有 IP 配置 (双栈时 IPv4 / IPv6 分别调用)
+		flushErr := luid.FlushIPAddresses(family)
 		if flushErr != nil {
-			fmt.Printf("[DEBUG] FlushIPAddresses failed: %v\n", flushErr)
+			g.Log().Debugf(context.Background(), "[WireGuard] FlushIPAddresses failed: %v", flushErr)
 			g.Log().Warningf(context.Background(), "[WireGuard] FlushIPAddresses 失败: %v", flushErr)
 		}
 		time.Sleep(500 * time.Millisecond)
 
 		// 设置新 IP
-		err = luid.SetIPAddressesForFamily(winipcfg.AddressFamily(windows.AF_INET), []netip.Prefix{prefix})
+		err = luid.SetIPAddressesForFamily(family, []netip.Prefix{prefix})
 		if err == nil {
-			fmt.Printf("[DEBUG] IP configured successfully: %s\n", prefix.String())
+			g.Log().Debugf(context.Background(), "[WireGuard] IP configured successfully: %s", prefix.String())
 			g.Log().Infof(context.Background(), "[WireGuard] IP 配置成功: %s", prefix.String())
 			return nil
 		}
 
 		lastErr = err
-		fmt.Printf("[DEBUG] SetIPAddressesForFamily failed: %v\n", err)
+		g.Log().Debugf(context.Background(), "[WireGuard] SetIPAddressesForFamily failed: %v", err)
 		g.Log().Warningf(context.Background(), "[WireGuard] SetIPAddressesForFamily 尝试 %d 失败: %v", i+1, err)
 		time.Sleep(time.Duration(1+i) * time.Second)
 	}
 
-	fmt.Printf("[DEBUG] All attempts failed, last error: %v\n", lastErr)
+	g.Log().Debugf(context.Background(), "[WireGuard] All attempts failed, last error: %v", lastErr)
 	return fmt.Errorf("LUID IP 配置最终失败: %v", lastErr)
 }
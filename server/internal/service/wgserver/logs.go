@@ -0,0 +1,133 @@
+// ==========================================================================
+// OmniWire - wireguard-go 设备日志
+// 按接口配置的日志等级输出到 g.Log()，并在内存中保留最近的日志供 API 查看；
+// 日志等级通过原子变量读取，修改后立即生效，无需重建设备
+// ==========================================================================
+
+package wgserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.zx2c4.com/wireguard/device"
+)
+
+// 接口日志等级 (wireguard_config.log_level)
+const (
+	LogLevelError   = "error"   // 仅设备错误
+	LogLevelWarning = "warning" // 同 error，wireguard-go 没有警告级别
+	LogLevelInfo    = "info"    // 设备详细日志 (握手、密钥协商等)，以 Info 输出
+	LogLevelDebug   = "debug"   // 同 info，以 Debug 输出
+)
+
+// 设备日志类型
+const (
+	DeviceLogError   = "error"
+	DeviceLogVerbose = "verbose"
+)
+
+// maxDeviceLogs 每个接口保留的设备日志条数
+const maxDeviceLogs = 1000
+
+// DeviceLog 一条设备日志
+type DeviceLog struct {
+	Seq     uint64 // 递增序号，可用于增量获取
+	Time    time.Time
+	Level   string // DeviceLogError | DeviceLogVerbose
+	Message string
+}
+
+// deviceLogs 设备日志环形缓冲，零值可用
+type deviceLogs struct {
+	mu      sync.Mutex
+	entries []DeviceLog
+	next    int // 缓冲满后下一条写入的位置
+	seq     uint64
+}
+
+func (b *deviceLogs) add(level, message string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	entry := DeviceLog{Seq: b.seq, Time: time.Now(), Level: level, Message: message}
+	if len(b.entries) < maxDeviceLogs {
+		b.entries = append(b.entries, entry)
+		return
+	}
+	b.entries[b.next] = entry
+	b.next = (b.next + 1) % maxDeviceLogs
+}
+
+// since 序号大于 after 的日志 (按时间正序)，limit > 0 时只返回最新的 limit 条
+func (b *deviceLogs) since(after uint64, limit int) []DeviceLog {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]DeviceLog, 0)
+	for i := range b.entries {
+		entry := b.entries[(b.next+i)%len(b.entries)]
+		if entry.Seq > after {
+			result = append(result, entry)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
+
+// DeviceLogs 获取序号大于 after 的设备日志，limit > 0 时只返回最新的 limit 条
+func (s *WireGuardServer) DeviceLogs(after uint64, limit int) []DeviceLog {
+	return s.logs.since(after, limit)
+}
+
+// LogLevel 当前生效的日志等级
+func (s *WireGuardServer) LogLevel() string {
+	if level, ok := s.logLevel.Load().(string); ok {
+		return level
+	}
+	return LogLevelError
+}
+
+// setLogLevel 更新日志等级
+func (s *WireGuardServer) setLogLevel(level string) {
+	s.logLevel.Store(normalizeLogLevel(level))
+}
+
+// normalizeLogLevel 未知或为空的日志等级按 error 处理
+func normalizeLogLevel(level string) string {
+	switch level {
+	case LogLevelError, LogLevelWarning, LogLevelInfo, LogLevelDebug:
+		return level
+	}
+	return LogLevelError
+}
+
+// newDeviceLogger 创建交给 wireguard-go 的日志器
+// 回调在设备协程中执行，不能获取 s.mu (停止设备时会持有锁等待协程退出)
+func (s *WireGuardServer) newDeviceLogger(ifaceName string) *device.Logger {
+	prefix := fmt.Sprintf("[WireGuard] (%s) ", ifaceName)
+	return &device.Logger{
+		Verbosef: func(format string, args ...any) {
+			level := s.LogLevel()
+			if level != LogLevelInfo && level != LogLevelDebug {
+				return
+			}
+			message := fmt.Sprintf(format, args...)
+			s.logs.add(DeviceLogVerbose, message)
+			if level == LogLevelDebug {
+				g.Log().Debug(context.Background(), prefix+message)
+			} else {
+				g.Log().Info(context.Background(), prefix+message)
+			}
+		},
+		Errorf: func(format string, args ...any) {
+			message := fmt.Sprintf(format, args...)
+			s.logs.add(DeviceLogError, message)
+			g.Log().Warning(context.Background(), prefix+message)
+		},
+	}
+}
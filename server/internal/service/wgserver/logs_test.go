@@ -0,0 +1,39 @@
+package wgserver
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDeviceLogsRing(t *testing.T) {
+	var b deviceLogs
+	for i := 1; i <= maxDeviceLogs+5; i++ {
+		b.add(DeviceLogVerbose, fmt.Sprintf("line %d", i))
+	}
+
+	all := b.since(0, 0)
+	if len(all) != maxDeviceLogs || all[0].Seq != 6 || all[len(all)-1].Seq != maxDeviceLogs+5 {
+		t.Fatalf("unexpected window: %d entries, first %d, last %d", len(all), all[0].Seq, all[len(all)-1].Seq)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Seq != all[i-1].Seq+1 {
+			t.Fatalf("entries out of order at %d: %d after %d", i, all[i].Seq, all[i-1].Seq)
+		}
+	}
+
+	tail := b.since(maxDeviceLogs, 3)
+	if len(tail) != 3 || tail[0].Seq != maxDeviceLogs+3 || tail[2].Message != fmt.Sprintf("line %d", maxDeviceLogs+5) {
+		t.Fatalf("unexpected tail: %+v", tail)
+	}
+	if got := b.since(maxDeviceLogs+5, 0); len(got) != 0 {
+		t.Fatalf("expected no entries after last seq, got %d", len(got))
+	}
+}
+
+func TestNormalizeLogLevel(t *testing.T) {
+	for in, want := range map[string]string{"debug": LogLevelDebug, "": LogLevelError, "verbose": LogLevelError} {
+		if got := normalizeLogLevel(in); got != want {
+			t.Errorf("normalizeLogLevel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// ==========================================================================
+// OmniWire - TUN 模式 NAT / 转发规则
+// Linux 下为 VPN 网段安装 MASQUERADE 与 FORWARD 规则 (iptables 优先，缺失时使用 nftables)，
+// 规则均以接口名打标，停止或异常退出后再次启动时据此清理
+// ==========================================================================
+
+package wgserver
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// NAT 规则后端
+const (
+	NATIptables = "iptables"
+	NATNftables = "nftables"
+)
+
+// NATStatus 已安装的 NAT 规则
+type NATStatus struct {
+	Backend      string   // NATIptables | NATNftables
+	OutInterface string   // 出口网卡
+	Subnets      []string // 做 MASQUERADE 的 VPN 网段
+}
+
+// NATStatus 当前接口已安装的 NAT 规则，未安装时返回 nil
+func (s *WireGuardServer) NATStatus() *NATStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.nat == nil {
+		return nil
+	}
+	status := *s.nat
+	return &status
+}
+
+// CleanupNAT 清理接口残留的 NAT 规则，用于进程异常退出后的恢复
+func CleanupNAT(ifaceName string) {
+	if ifaceName != "" {
+		teardownNAT(ifaceName)
+	}
+}
+
+// setupNATLocked 按当前地址与配置重新安装 NAT 规则 (调用方需持有 s.mu)
+func (s *WireGuardServer) setupNATLocked() {
+	s.teardownNATLocked()
+	if !s.natEnabled || s.mode != ModeTUN || s.tunName == "" {
+		return
+	}
+	prefixes, err := ParseServerAddress(s.address)
+	if err != nil || len(prefixes) == 0 {
+		return
+	}
+	subnets := make([]netip.Prefix, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		subnets = append(subnets, prefix.Masked())
+	}
+	status, err := setupNAT(s.tunName, s.natOut, subnets)
+	if err != nil {
+		g.Log().Warningf(context.Background(), "[WireGuard] 配置 NAT 失败，请手动配置转发规则: %v", err)
+		return
+	}
+	s.nat = status
+}
+
+// teardownNATLocked 删除接口的 NAT 规则 (调用方需持有 s.mu)
+func (s *WireGuardServer) teardownNATLocked() {
+	if s.nat == nil {
+		return
+	}
+	teardownNAT(s.tunName)
+	s.nat = nil
+}
+
+// natTag 标记规则归属的注释 / 表名
+func natTag(ifaceName string) string {
+	return "omniwire:" + ifaceName
+}
+
+// natTable nftables 表名，标识符只能包含字母、数字与下划线
+func natTable(ifaceName string) string {
+	var b strings.Builder
+	b.WriteString("omniwire_")
+	for _, r := range ifaceName {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// iptablesDeleteArgs 从 `iptables -S <chain>` 的输出中找出带有 tag 注释的规则，返回对应的删除参数
+func iptablesDeleteArgs(listing, tag string) [][]string {
+	var result [][]string
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "-A" {
+			continue
+		}
+		matched := false
+		for i, f := range fields {
+			if unquoted, err := strconv.Unquote(f); err == nil {
+				fields[i] = unquoted
+			}
+			if i > 0 && fields[i-1] == "--comment" && fields[i] == tag {
+				matched = true
+			}
+		}
+		if matched {
+			fields[0] = "-D"
+			result = append(result, fields)
+		}
+	}
+	return result
+}
+
+// parseDefaultRoute 从 /proc/net/route 中取 metric 最小的 IPv4 默认路由网卡
+func parseDefaultRoute(data string) string {
+	best, bestMetric := "", -1
+	for _, line := range strings.Split(data, "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" || fields[0] == "lo" {
+			continue
+		}
+		metric, _ := strconv.Atoi(fields[6])
+		if bestMetric < 0 || metric < bestMetric {
+			best, bestMetric = fields[0], metric
+		}
+	}
+	return best
+}
+
+// parseDefaultRoute6 从 /proc/net/ipv6_route 中取 metric 最小的 IPv6 默认路由网卡
+func parseDefaultRoute6(data string) string {
+	best, bestMetric := "", int64(-1)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || strings.Trim(fields[0], "0") != "" || fields[1] != "00" || fields[9] == "lo" {
+			continue
+		}
+		// 不可达的默认路由 (如 lo 上的 reject) 下一跳与 metric 全为 f
+		metric, err := strconv.ParseInt(fields[5], 16, 64)
+		if err != nil || fields[5] == "ffffffff" {
+			continue
+		}
+		if bestMetric < 0 || metric < bestMetric {
+			best, bestMetric = fields[9], metric
+		}
+	}
+	return best
+}
@@ -0,0 +1,187 @@
+//go:build linux
+
+package wgserver
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// setupNAT 开启内核转发，并为 VPN 网段安装 FORWARD 放行与 MASQUERADE 规则
+// outInterface 为空时按默认路由自动检测出口网卡
+func setupNAT(ifaceName, outInterface string, subnets []netip.Prefix) (*NATStatus, error) {
+	hasV4, hasV6 := false, false
+	for _, subnet := range subnets {
+		if subnet.Addr().Is4() {
+			hasV4 = true
+		} else {
+			hasV6 = true
+		}
+	}
+	if outInterface == "" {
+		outInterface = detectOutInterface()
+		if outInterface == "" {
+			return nil, fmt.Errorf("未找到默认路由，无法确定出口网卡")
+		}
+	}
+	if hasV4 {
+		enableForwarding("/proc/sys/net/ipv4/ip_forward")
+	}
+	if hasV6 {
+		enableForwarding("/proc/sys/net/ipv6/conf/all/forwarding")
+	}
+
+	// 先清理残留规则 (异常退出或出口网卡变化)
+	teardownNAT(ifaceName)
+
+	status := &NATStatus{OutInterface: outInterface}
+	for _, subnet := range subnets {
+		status.Subnets = append(status.Subnets, subnet.String())
+	}
+	// iptables (含 iptables-nft) 规则插入 FORWARD 链头部，能与 Docker / ufw 等已有规则共存；
+	// 独立的 nftables 表无法越过其他表中的 drop，仅在没有 iptables 时使用
+	if _, err := exec.LookPath("iptables"); err == nil {
+		status.Backend = NATIptables
+		if err := setupIptables(ifaceName, outInterface, subnets); err != nil {
+			teardownNAT(ifaceName)
+			return nil, err
+		}
+	} else if _, err := exec.LookPath("nft"); err == nil {
+		status.Backend = NATNftables
+		if err := setupNftables(ifaceName, outInterface, subnets); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("未找到 iptables 或 nft 命令")
+	}
+
+	g.Log().Infof(context.Background(), "[WireGuard] 已通过 %s 配置 NAT: %v -> %s", status.Backend, status.Subnets, outInterface)
+	return status, nil
+}
+
+// teardownNAT 删除接口的所有 NAT 规则，两种后端都会检查
+func teardownNAT(ifaceName string) {
+	tag := natTag(ifaceName)
+	for _, bin := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			continue
+		}
+		for _, chain := range [][2]string{{"filter", "FORWARD"}, {"nat", "POSTROUTING"}} {
+			out, err := exec.Command(bin, "-w", "-t", chain[0], "-S", chain[1]).Output()
+			if err != nil {
+				continue
+			}
+			for _, args := range iptablesDeleteArgs(string(out), tag) {
+				args = append([]string{"-w", "-t", chain[0]}, args...)
+				if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+					g.Log().Warningf(context.Background(), "[WireGuard] 删除 NAT 规则失败: %v, output: %s", err, strings.TrimSpace(string(out)))
+				}
+			}
+		}
+	}
+	if _, err := exec.LookPath("nft"); err == nil {
+		// 表不存在时报错，忽略即可
+		_ = exec.Command("nft", "delete", "table", "inet", natTable(ifaceName)).Run()
+	}
+}
+
+// setupIptables 按地址族分别用 iptables / ip6tables 安装规则
+func setupIptables(ifaceName, outInterface string, subnets []netip.Prefix) error {
+	comment := []string{"-m", "comment", "--comment", natTag(ifaceName)}
+	families := map[string]bool{}
+	for _, subnet := range subnets {
+		bin := "iptables"
+		if subnet.Addr().Is6() {
+			bin = "ip6tables"
+		}
+		if !families[bin] {
+			families[bin] = true
+			forward := [][]string{
+				{"-t", "filter", "-I", "FORWARD", "-i", ifaceName, "-j", "ACCEPT"},
+				{"-t", "filter", "-I", "FORWARD", "-o", ifaceName, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+			}
+			for _, rule := range forward {
+				if err := runIptables(bin, append(rule, comment...)); err != nil {
+					return err
+				}
+			}
+		}
+		rule := []string{"-t", "nat", "-A", "POSTROUTING", "-s", subnet.String(), "-o", outInterface, "-j", "MASQUERADE"}
+		if err := runIptables(bin, append(rule, comment...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runIptables 执行 iptables 命令，-w 等待 xtables 锁
+func runIptables(bin string, args []string) error {
+	cmd := exec.Command(bin, append([]string{"-w"}, args...)...)
+	g.Log().Debugf(context.Background(), "Exec: %s", cmd.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s error: %v, output: %s", bin, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// setupNftables 创建接口专属的 inet 表，删除接口时整表删除
+func setupNftables(ifaceName, outInterface string, subnets []netip.Prefix) error {
+	table := natTable(ifaceName)
+	var masquerade strings.Builder
+	for _, subnet := range subnets {
+		family := "ip"
+		if subnet.Addr().Is6() {
+			family = "ip6"
+		}
+		fmt.Fprintf(&masquerade, "\t\t%s saddr %s oifname %q masquerade\n", family, subnet, outInterface)
+	}
+	script := fmt.Sprintf(`table inet %[1]s {
+	chain forward {
+		type filter hook forward priority 0; policy accept;
+		iifname %[2]q accept
+		oifname %[2]q ct state established,related accept
+	}
+	chain postrouting {
+		type nat hook postrouting priority 100; policy accept;
+%[3]s	}
+}
+`, table, ifaceName, masquerade.String())
+
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft error: %v, output: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// detectOutInterface 按默认路由检测出口网卡，优先 IPv4
+func detectOutInterface() string {
+	if data, err := os.ReadFile("/proc/net/route"); err == nil {
+		if name := parseDefaultRoute(string(data)); name != "" {
+			return name
+		}
+	}
+	if data, err := os.ReadFile("/proc/net/ipv6_route"); err == nil {
+		return parseDefaultRoute6(string(data))
+	}
+	return ""
+}
+
+// enableForwarding 开启内核转发，停止服务时不会关闭 (可能有其他服务依赖)
+func enableForwarding(path string) {
+	if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) == "1" {
+		return
+	}
+	if err := os.WriteFile(path, []byte("1"), 0644); err != nil {
+		g.Log().Warningf(context.Background(), "[WireGuard] 开启内核转发失败 (%s): %v", path, err)
+		return
+	}
+	g.Log().Infof(context.Background(), "[WireGuard] 已开启内核转发: %s", path)
+}
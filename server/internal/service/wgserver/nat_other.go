@@ -0,0 +1,15 @@
+//go:build !linux
+
+package wgserver
+
+import (
+	"net/netip"
+)
+
+// setupNAT 仅 Linux 支持；Windows 的 NAT 在配置网卡地址时通过 New-NetNat 创建
+func setupNAT(ifaceName, outInterface string, subnets []netip.Prefix) (*NATStatus, error) {
+	return nil, nil
+}
+
+// teardownNAT 非 Linux 平台无需清理
+func teardownNAT(ifaceName string) {}
@@ -0,0 +1,41 @@
+package wgserver
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIptablesDeleteArgsMatchesTagExactly(t *testing.T) {
+	listing := `-P FORWARD DROP
+-A FORWARD -o wg10 -m comment --comment omniwire:wg10 -j ACCEPT
+-A FORWARD -i wg1 -m comment --comment "omniwire:wg1" -j ACCEPT
+-A FORWARD -j DOCKER-USER
+`
+	args := iptablesDeleteArgs(listing, natTag("wg1"))
+	want := []string{"-D", "FORWARD", "-i", "wg1", "-m", "comment", "--comment", "omniwire:wg1", "-j", "ACCEPT"}
+	if len(args) != 1 || !slices.Equal(args[0], want) {
+		t.Fatalf("unexpected delete args: %q", args)
+	}
+}
+
+func TestParseDefaultRoute(t *testing.T) {
+	route := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	00000000	0101A8C0	0003	0	0	600	00000000	0	0	0
+eth0	00000000	0100000A	0003	0	0	100	00000000	0	0	0
+eth0	0000000A	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`
+	if got := parseDefaultRoute(route); got != "eth0" {
+		t.Fatalf("expected eth0, got %q", got)
+	}
+
+	route6 := `00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00450003     ens3
+fd000000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     ens3
+`
+	if got := parseDefaultRoute6(route6); got != "ens3" {
+		t.Fatalf("expected ens3, got %q", got)
+	}
+	if got := natTable("wg-office.1"); got != "omniwire_wg_office_1" {
+		t.Fatalf("unexpected nft table name %q", got)
+	}
+}
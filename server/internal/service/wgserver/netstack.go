@@ -0,0 +1,457 @@
+// ==========================================================================
+// OmniWire - WireGuard 用户态网络栈模式 (tun/netstack, 无需内核网卡与 root)
+// ==========================================================================
+
+package wgserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+const (
+	ModeTUN      = "tun"      // 内核 TUN 网卡 (需要 root / NET_ADMIN)
+	ModeNetstack = "netstack" // 进程内 gVisor 网络栈，隧道终止于 OmniWire 进程
+)
+
+// netstackServices netstack 模式下在隧道地址上提供的服务
+type netstackServices struct {
+	net       *netstack.Net
+	serverIPs []netip.Addr // 每个地址族一个
+
+	mu         sync.Mutex
+	proxies    []net.Listener
+	proxyAllow []netip.Prefix // 内置代理默认拒绝的目标中额外允许的网段
+	forwards   []io.Closer    // 转发规则监听器
+	closeOnce  sync.Once
+	done       chan struct{}
+}
+
+// createNetstackTUN 创建用户态 TUN，服务端地址由 address 决定 (支持双栈)
+func createNetstackTUN(address, dns string, mtu int) (tun.Device, *netstackServices, error) {
+	prefixes, err := ParseServerAddress(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverIPs := make([]netip.Addr, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		serverIPs = append(serverIPs, prefix.Addr())
+	}
+
+	var dnsServers []netip.Addr
+	for _, item := range strings.Split(dns, ",") {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(item)); err == nil {
+			dnsServers = append(dnsServers, addr)
+		}
+	}
+
+	tunDevice, tnet, err := netstack.CreateNetTUN(serverIPs, dnsServers, mtu)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tunDevice, &netstackServices{
+		net:       tnet,
+		serverIPs: serverIPs,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// start 启动内置代理与转发规则
+func (ns *netstackServices) start(ctx context.Context, proxyAddress string, proxyAllow []netip.Prefix) {
+	ns.setProxyAllow(proxyAllow)
+	ns.listenProxy(ctx, proxyAddress)
+	ns.reloadForwards(ctx)
+}
+
+// setProxyAllow 更新内置代理额外允许访问的网段，对之后的新连接生效
+func (ns *netstackServices) setProxyAllow(allow []netip.Prefix) {
+	ns.mu.Lock()
+	ns.proxyAllow = allow
+	ns.mu.Unlock()
+}
+
+// allowedProxyTarget 判断内置代理能否连接 addr
+func (ns *netstackServices) allowedProxyTarget(addr netip.Addr) bool {
+	ns.mu.Lock()
+	allow := ns.proxyAllow
+	ns.mu.Unlock()
+	return proxyTargetAllowed(addr, allow)
+}
+
+// listenProxy 关闭已有的内置代理并按新地址重新监听
+func (ns *netstackServices) listenProxy(ctx context.Context, proxyAddress string) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	for _, l := range ns.proxies {
+		l.Close()
+	}
+	ns.proxies = nil
+	if port := portFromAddress(proxyAddress); port > 0 {
+		for _, ip := range ns.serverIPs {
+			l, err := ns.net.ListenTCPAddrPort(netip.AddrPortFrom(ip, uint16(port)))
+			if err != nil {
+				g.Log().Errorf(ctx, "[WireGuard] netstack 内置代理监听失败: %v", err)
+				continue
+			}
+			ns.proxies = append(ns.proxies, l)
+			go ns.serveSocks5(l)
+			g.Log().Infof(ctx, "[WireGuard] netstack 内置 SOCKS5 代理: %s", l.Addr())
+		}
+	}
+}
+
+// close 关闭所有监听器
+func (ns *netstackServices) close() {
+	ns.closeOnce.Do(func() {
+		close(ns.done)
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		for _, l := range ns.proxies {
+			l.Close()
+		}
+		for _, c := range ns.forwards {
+			c.Close()
+		}
+		ns.forwards = nil
+	})
+}
+
+// reloadForwards 按数据库中启用的转发规则，在隧道地址上重建监听
+func (ns *netstackServices) reloadForwards(ctx context.Context) {
+	type ruleRecord struct {
+		Name       string
+		Protocol   string
+		ListenPort int
+		TargetAddr string
+		TargetPort int
+	}
+	var rules []ruleRecord
+	if err := g.DB().Model("forward_rule").Where("enabled", 1).Scan(&rules); err != nil {
+		g.Log().Warningf(ctx, "[WireGuard] netstack 读取转发规则失败: %v", err)
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	select {
+	case <-ns.done:
+		return
+	default:
+	}
+
+	for _, c := range ns.forwards {
+		c.Close()
+	}
+	ns.forwards = nil
+
+	for _, r := range rules {
+		target := net.JoinHostPort(r.TargetAddr, strconv.Itoa(r.TargetPort))
+		for _, ip := range ns.serverIPs {
+			listenAddr := netip.AddrPortFrom(ip, uint16(r.ListenPort))
+			if r.Protocol == "tcp" {
+				l, err := ns.net.ListenTCPAddrPort(listenAddr)
+				if err != nil {
+					g.Log().Warningf(ctx, "[WireGuard] netstack 转发规则 %s 监听失败: %v", r.Name, err)
+					continue
+				}
+				ns.forwards = append(ns.forwards, l)
+				go relayTCP(l, target)
+			} else {
+				c, err := ns.net.ListenUDPAddrPort(listenAddr)
+				if err != nil {
+					g.Log().Warningf(ctx, "[WireGuard] netstack 转发规则 %s 监听失败: %v", r.Name, err)
+					continue
+				}
+				ns.forwards = append(ns.forwards, c)
+				go relayUDP(c, target)
+			}
+		}
+	}
+	g.Log().Infof(ctx, "[WireGuard] netstack 已在 %v 上映射 %d 条转发规则", ns.serverIPs, len(rules))
+}
+
+// ReloadNetstackForwards 转发规则变更后调用，非 netstack 模式或未运行时忽略
+func (s *WireGuardServer) ReloadNetstackForwards(ctx context.Context) {
+	s.mu.RLock()
+	ns := s.netstack
+	s.mu.RUnlock()
+	if ns != nil {
+		ns.reloadForwards(ctx)
+	}
+}
+
+// ReloadAllNetstackForwards 在所有 netstack 模式的接口上重建转发规则
+func ReloadAllNetstackForwards(ctx context.Context) {
+	for _, s := range Servers() {
+		s.ReloadNetstackForwards(ctx)
+	}
+}
+
+// ==================== 转发 ====================
+
+// relayTCP 将隧道内的 TCP 连接转发到目标地址 (经由宿主机网络)
+func relayTCP(l net.Listener, target string) {
+	for {
+		src, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer src.Close()
+			dst, err := net.DialTimeout("tcp", target, 10*time.Second)
+			if err != nil {
+				return
+			}
+			defer dst.Close()
+			pipe(src, dst)
+		}()
+	}
+}
+
+// relayUDP 将隧道内的 UDP 数据报转发到目标地址，按来源地址维护会话
+func relayUDP(c net.PacketConn, target string) {
+	targetAddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	var mu sync.Mutex
+	sessions := make(map[string]*net.UDPConn)
+	defer func() {
+		mu.Lock()
+		for _, s := range sessions {
+			s.Close()
+		}
+		mu.Unlock()
+	}()
+
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		key := from.String()
+		mu.Lock()
+		session, ok := sessions[key]
+		if !ok {
+			session, err = net.DialUDP("udp", nil, targetAddr)
+			if err != nil {
+				mu.Unlock()
+				continue
+			}
+			sessions[key] = session
+			go func(from net.Addr, session *net.UDPConn) {
+				defer func() {
+					mu.Lock()
+					delete(sessions, from.String())
+					mu.Unlock()
+					session.Close()
+				}()
+				respBuf := make([]byte, 65535)
+				for {
+					session.SetReadDeadline(time.Now().Add(2 * time.Minute))
+					n, err := session.Read(respBuf)
+					if err != nil {
+						return
+					}
+					if _, err := c.WriteTo(respBuf[:n], from); err != nil {
+						return
+					}
+				}
+			}(from, session)
+		}
+		mu.Unlock()
+
+		session.Write(buf[:n])
+	}
+}
+
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// ==================== SOCKS5 代理 ====================
+
+// errProxyDenied 目标地址不允许经内置代理访问
+var errProxyDenied = errors.New("目标地址不允许经内置代理访问")
+
+// serveSocks5 最小化 SOCKS5 代理 (RFC 1928)，仅支持无认证 CONNECT
+// 隧道仅对已认证的 WireGuard Peer 可达，因此不再额外认证；
+// 但回环、链路本地等仅对宿主机开放的目标默认拒绝，见 proxyTargetAllowed
+func (ns *netstackServices) serveSocks5(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			if err := ns.handleSocks5(c); err != nil && !errors.Is(err, io.EOF) {
+				g.Log().Debugf(context.Background(), "[WireGuard] SOCKS5 %s: %v", c.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (ns *netstackServices) handleSocks5(c net.Conn) error {
+	c.SetDeadline(time.Now().Add(30 * time.Second))
+
+	// 协商认证方式: VER NMETHODS METHODS...
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(c, head); err != nil {
+		return err
+	}
+	if head[0] != 5 {
+		return fmt.Errorf("不支持的 SOCKS 版本: %d", head[0])
+	}
+	if _, err := io.ReadFull(c, make([]byte, head[1])); err != nil {
+		return err
+	}
+	if _, err := c.Write([]byte{5, 0}); err != nil {
+		return err
+	}
+
+	// 请求: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(c, req); err != nil {
+		return err
+	}
+	if req[1] != 1 {
+		c.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0}) // Command not supported
+		return fmt.Errorf("不支持的命令: %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(c, l); err != nil {
+			return err
+		}
+		name := make([]byte, l[0])
+		if _, err := io.ReadFull(c, name); err != nil {
+			return err
+		}
+		host = string(name)
+	case 4:
+		ip := make([]byte, 16)
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return err
+		}
+		host = net.IP(ip).String()
+	default:
+		c.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0}) // Address type not supported
+		return fmt.Errorf("不支持的地址类型: %d", req[3])
+	}
+	portBuf := make([]byte, 2)
+	if _, err := io.ReadFull(c, portBuf); err != nil {
+		return err
+	}
+	port := int(portBuf[0])<<8 | int(portBuf[1])
+
+	// 在解析后的地址上检查，域名解析到受限地址时同样拒绝
+	dialer := net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !ns.allowedProxyTarget(ap.Addr()) {
+				return errProxyDenied
+			}
+			return nil
+		},
+	}
+	dst, err := dialer.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if errors.Is(err, errProxyDenied) {
+		c.Write([]byte{5, 2, 0, 1, 0, 0, 0, 0, 0, 0}) // Connection not allowed by ruleset
+		return err
+	}
+	if err != nil {
+		c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0}) // Connection refused
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	c.SetDeadline(time.Time{})
+	pipe(c, dst)
+	return nil
+}
+
+// proxyTargetAllowed 内置代理默认拒绝回环、链路本地、组播、未指定地址以及宿主机自身的地址，
+// 避免 Peer 借代理访问仅对本机开放的服务 (如管理 API)；allow 中的网段不受此限制
+func proxyTargetAllowed(addr netip.Addr, allow []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	return !isHostAddr(addr)
+}
+
+// isHostAddr 判断 addr 是否为宿主机网卡上的地址，读取失败时按宿主机地址处理
+func isHostAddr(addr netip.Addr) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return true
+	}
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip, ok := netip.AddrFromSlice(ipNet.IP); ok && ip.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// portFromAddress 从 ":50122" / "0.0.0.0:50122" 形式的地址中解析端口
+func portFromAddress(address string) int {
+	address = strings.TrimSpace(address)
+	if idx := strings.LastIndex(address, ":"); idx >= 0 {
+		address = address[idx+1:]
+	}
+	port, err := strconv.Atoi(address)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0
+	}
+	return port
+}
@@ -0,0 +1,199 @@
+package wgserver_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	_ "github.com/gogf/gf/contrib/drivers/sqlite/v2"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+
+	"omniwire/internal/cmd"
+	"omniwire/internal/service/wgserver"
+)
+
+func keyHex(t *testing.T, b64 string) string {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(raw)
+}
+
+func freeUDPPort(t *testing.T) int {
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).Port
+}
+
+// TestNetstackEndToEnd 以 netstack 模式启动服务端，客户端同样使用用户态网络栈，
+// 经隧道内置 SOCKS5 代理访问宿主机上显式放行的 echo 服务
+func TestNetstackEndToEnd(t *testing.T) {
+	ctx := context.Background()
+	gdb.SetConfig(gdb.Config{"default": gdb.ConfigGroup{{Type: "sqlite", Link: "sqlite::@file(" + t.TempDir() + "/omniwire.db)"}}})
+	if err := cmd.InitDatabase(ctx); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+
+	serverPriv, serverPub, _ := wgserver.GenerateKeyPair()
+	clientPriv, clientPub, _ := wgserver.GenerateKeyPair()
+	psk, _ := wgserver.GeneratePresharedKey()
+	if _, err := g.DB().Model("wireguard_peer").Insert(g.Map{
+		"name": "e2e", "public_key": clientPub, "private_key": clientPriv,
+		"preshared_key": psk, "allowed_ips": "10.99.0.2/32", "enabled": 1,
+	}); err != nil {
+		t.Fatalf("insert peer: %v", err)
+	}
+
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	listenPort := freeUDPPort(t)
+	server := wgserver.GetServer(wgserver.DefaultInterface)
+	if err := server.Start(wgserver.Options{
+		Interface:    "omniwire-e2e",
+		Mode:         wgserver.ModeNetstack,
+		ListenPort:   listenPort,
+		PrivateKey:   serverPriv,
+		Address:      "10.99.0.1/24",
+		MTU:          1420,
+		ProxyAddress: ":1080",
+		ProxyAllow:   []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+	}); err != nil {
+		t.Fatalf("start server: %v", err)
+	}
+	defer server.Stop()
+
+	// 客户端
+	clientTun, clientNet, err := netstack.CreateNetTUN([]netip.Addr{netip.MustParseAddr("10.99.0.2")}, nil, 1420)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := device.NewDevice(clientTun, conn.NewDefaultBind(), device.NewLogger(device.LogLevelSilent, ""))
+	defer client.Close()
+	if err := client.IpcSet(fmt.Sprintf("private_key=%s\npublic_key=%s\npreshared_key=%s\nendpoint=127.0.0.1:%d\nallowed_ip=10.99.0.0/24\n",
+		keyHex(t, clientPriv), keyHex(t, serverPub), keyHex(t, psk), listenPort)); err != nil {
+		t.Fatalf("configure client: %v", err)
+	}
+	if err := client.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	echoPort := echo.Addr().(*net.TCPAddr).Port
+	// socksConnect 经隧道内置代理发起 SOCKS5 无认证 CONNECT，返回连接与应答码
+	socksConnect := func(ip [4]byte) (net.Conn, byte) {
+		c, err := clientNet.DialContext(dialCtx, "tcp", "10.99.0.1:1080")
+		if err != nil {
+			t.Fatalf("dial proxy through tunnel: %v", err)
+		}
+		c.SetDeadline(time.Now().Add(15 * time.Second))
+		if _, err := c.Write([]byte{5, 1, 0}); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, 2)
+		if _, err := io.ReadFull(c, reply); err != nil || reply[1] != 0 {
+			t.Fatalf("socks5 greeting: %v %v", reply, err)
+		}
+		if _, err := c.Write([]byte{5, 1, 0, 1, ip[0], ip[1], ip[2], ip[3], byte(echoPort >> 8), byte(echoPort)}); err != nil {
+			t.Fatal(err)
+		}
+		reply = make([]byte, 10)
+		if _, err := io.ReadFull(c, reply); err != nil {
+			t.Fatalf("socks5 connect: %v", err)
+		}
+		return c, reply[1]
+	}
+
+	// 未放行的回环地址被拒绝 (0x02: connection not allowed by ruleset)
+	denied, code := socksConnect([4]byte{127, 0, 0, 2})
+	denied.Close()
+	if code != 2 {
+		t.Fatalf("socks5 connect to 127.0.0.2: reply %d, want 2", code)
+	}
+
+	c, code := socksConnect([4]byte{127, 0, 0, 1})
+	defer c.Close()
+	if code != 0 {
+		t.Fatalf("socks5 connect to 127.0.0.1: reply %d", code)
+	}
+
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 4)
+	if _, err := io.ReadFull(c, got); err != nil {
+		t.Fatalf("read echo: %v", err)
+	}
+	if string(got) != "ping" {
+		t.Fatalf("expected ping, got %q", got)
+	}
+
+	// 修改代理地址与保活间隔可在线生效，修改 MTU 需要重建设备
+	opts := wgserver.Options{
+		Interface:    "omniwire-e2e",
+		Mode:         wgserver.ModeNetstack,
+		ListenPort:   listenPort,
+		PrivateKey:   serverPriv,
+		Address:      "10.99.0.1/24",
+		MTU:          1420,
+		ProxyAddress: ":1081",
+		ProxyAllow:   []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+		Keepalive:    15,
+	}
+	result, err := server.Apply(opts)
+	if err != nil || result.Path != wgserver.ApplyLive {
+		t.Fatalf("expected live apply, got %+v %v", result, err)
+	}
+
+	// 端口被占用时设备拒绝修改，释放后再次 Apply 仍会重试而不是视为无变化
+	busy, err := net.ListenUDP("udp4", &net.UDPAddr{Port: freeUDPPort(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.ListenPort = busy.LocalAddr().(*net.UDPAddr).Port
+	if _, err := server.Apply(opts); err == nil {
+		busy.Close()
+		t.Fatal("expected apply to fail while port is in use")
+	}
+	busy.Close()
+	result, err = server.Apply(opts)
+	if err != nil || result.Path != wgserver.ApplyLive {
+		t.Fatalf("expected retried live apply, got %+v %v", result, err)
+	}
+
+	opts.MTU = 1380
+	result, err = server.Apply(opts)
+	if err != nil || result.Path != wgserver.ApplyRestart || !server.IsRunning() {
+		t.Fatalf("expected restart apply, got %+v %v", result, err)
+	}
+}
@@ -0,0 +1,108 @@
+// ==========================================================================
+// OmniWire - Peer 路由网段 (站点互联，将 Peer 后方的局域网路由到隧道)
+// ==========================================================================
+
+package wgserver
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+
+	"omniwire/internal/service/ipam"
+)
+
+// ParseRoutedNetworks 解析逗号分隔的路由网段，统一为网络地址形式
+func ParseRoutedNetworks(s string) ([]netip.Prefix, error) {
+	prefixes, err := ipam.ParsePrefixes(s)
+	if err != nil {
+		return nil, err
+	}
+	for i := range prefixes {
+		prefixes[i] = prefixes[i].Masked()
+	}
+	return prefixes, nil
+}
+
+// syncRoutes 按启用的 Peer 同步系统路由 (调用方需持有 s.mu)
+// 新增的网段添加路由，不再需要的网段删除路由；netstack 模式没有系统网卡，跳过
+func (s *WireGuardServer) syncRoutes() {
+	if s.dev == nil || s.mode == ModeNetstack || s.tunName == "" {
+		return
+	}
+
+	want := make(map[netip.Prefix]bool)
+	for _, p := range s.peers {
+		if !p.Enabled {
+			continue
+		}
+		prefixes, _ := ParseRoutedNetworks(p.RoutedNetworks)
+		for _, prefix := range prefixes {
+			want[prefix] = true
+		}
+	}
+
+	for prefix := range s.routes {
+		if !want[prefix] {
+			if err := routeCmd("del", prefix, s.tunName); err != nil {
+				g.Log().Warningf(context.Background(), "[WireGuard] 删除路由 %s 失败: %v", prefix, err)
+			}
+			delete(s.routes, prefix)
+		}
+	}
+	for prefix := range want {
+		if s.routes[prefix] {
+			continue
+		}
+		if err := routeCmd("add", prefix, s.tunName); err != nil {
+			g.Log().Warningf(context.Background(), "[WireGuard] 添加路由 %s 失败: %v", prefix, err)
+			continue
+		}
+		s.routes[prefix] = true
+		g.Log().Infof(context.Background(), "[WireGuard] 已添加路由 %s dev %s", prefix, s.tunName)
+	}
+}
+
+// routeCmd 添加或删除指向网卡的路由
+func routeCmd(action string, prefix netip.Prefix, ifaceName string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		if action == "add" {
+			action = "replace"
+		}
+		cmd = exec.Command("ip", "route", action, prefix.String(), "dev", ifaceName)
+	case "darwin":
+		family := "-inet"
+		if prefix.Addr().Is6() {
+			family = "-inet6"
+		}
+		route := "delete"
+		if action == "add" {
+			route = "add"
+		}
+		cmd = exec.Command("route", "-n", route, family, prefix.String(), "-interface", ifaceName)
+	case "windows":
+		family := "ipv4"
+		if prefix.Addr().Is6() {
+			family = "ipv6"
+		}
+		route := "delete"
+		if action == "add" {
+			route = "add"
+		}
+		// netsh 默认写入持久路由，store=active 使路由随重启清除，与其他平台一致
+		cmd = exec.Command("netsh", "interface", family, route, "route", prefix.String(), ifaceName, "store=active")
+	default:
+		return fmt.Errorf("unsupported os: %s", runtime.GOOS)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v, output: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -10,12 +10,16 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"net"
+	"net/netip"
 	"os/exec"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gogf/gf/v2/frame/g"
@@ -27,6 +31,7 @@ import (
 
 // WireGuardServer WireGuard 服务端
 type WireGuardServer struct {
+	id         int // 接口 ID (wireguard_config.id)
 	mu         sync.RWMutex
 	running    bool
 	listenPort int
@@ -34,10 +39,50 @@ type WireGuardServer struct {
 	publicKey  string // Base64
 	address    string
 	mtu        int
+	mode       string         // ModeTUN | ModeNetstack
+	ifaceName  string         // 配置的接口名 (netstack 模式下没有真实网卡)
+	keepalive  int            // 全局 PersistentKeepalive，Peer 未单独设置时使用
+	tunName    string         // 系统网卡真实名称，用于添加路由
+	dns        string         // netstack 模式使用的 DNS
+	proxyAddr  string         // netstack 模式内置代理监听地址
+	proxyAllow []netip.Prefix // netstack 模式内置代理额外允许访问的网段
+	natEnabled bool           // TUN 模式下自动配置 NAT
+	natOut     string         // 配置的 NAT 出口网卡，为空时自动检测
+
+	// PostUp / PostDown 钩子
+	postUp         string
+	postDown       string
+	hookTimeout    time.Duration
+	postUpRollback bool // PostUp 失败时回滚启动
+	hookResults    []HookResult
 
 	// WireGuard 核心组件
-	dev *device.Device
-	tun tun.Device
+	dev    *device.Device
+	tun    tun.Device
+	shaper *shapedTUN // Peer 限速层，包装 tun 后交给 device
+	acl    *aclTUN    // 访问控制层，位于 tun 与限速层之间
+
+	aclPolicy string    // ACLAllowAll | ACLIsolate
+	aclRules  []ACLRule // 启动时载入访问控制层
+
+	groupLimits map[int]GroupLimit // 分组限速，组内未单独设置限速的 Peer 使用
+
+	netstack *netstackServices // netstack 模式下的内置服务
+
+	routes map[netip.Prefix]bool // 已添加的 Peer 路由网段
+	nat    *NATStatus            // 已安装的 NAT 规则，未安装时为 nil
+
+	uapi     net.Listener // UAPI 套接字，未开放时为 nil
+	uapiSock string       // UAPI 套接字名称
+
+	dnsHandler   DNSHandler  // 内置 DNS，未开启时为 nil
+	dnsListeners []io.Closer // 隧道地址上的 DNS 监听
+
+	logLevel atomic.Value // 设备日志等级 (string)，设备协程中无锁读取
+	logs     deviceLogs   // 最近的设备日志
+
+	handshakes    handshakeMonitor // 被拒绝的握手记录
+	handshakeDiag bool             // 是否开启握手诊断 (启动时确定)
 
 	peers  map[string]*Peer // 以公钥(Base64)为键
 	ctx    context.Context
@@ -47,19 +92,35 @@ type WireGuardServer struct {
 	// 连接日志监控
 	lastHandshakes map[string]time.Time // 上次已知握手时间
 	lastOnline     map[string]bool      // 上次在线状态
+	lastEndpoints  map[string]string    // 上次已知 Endpoint (用于识别漫游)
+
+	// 累计流量 (以公钥为键，定期写入数据库)
+	traffic map[string]*peerTraffic
 }
 
 // Peer 客户端状态
 type Peer struct {
+	Id            int // 数据库 ID，用于匹配 ACL 来源
+	GroupId       int // 所属分组，0=未分组
 	Name          string
 	PublicKey     string
 	PresharedKey  string
 	AllowedIPs    string
-	Endpoint      string
+	Endpoint      string // 运行时 Endpoint (由设备上报)
 	LastHandshake time.Time
 	TransferRx    int64
 	TransferTx    int64
-	Enabled       bool
+	// 尚未写入数据库的累计流量，与 total_upload/total_download 相加即为历史总量
+	PendingUpload   int64
+	PendingDownload int64
+	UploadLimit     int64 // bytes/s, 0=使用分组限速 (未分组时无限制)
+	DownloadLimit   int64 // bytes/s, 0=使用分组限速 (未分组时无限制)
+	Enabled         bool
+	// 站点互联等对端地址已知的 Peer，由服务端主动连接并发送保活
+	StaticEndpoint string // host:port，为空表示等待对端连接
+	Keepalive      int    // 秒，<0 表示继承全局配置，0 表示关闭
+	RoutedNetworks string // Peer 后方的局域网网段，逗号分隔
+	ThrottleRate   int64  // 流量超额后的限速 (bytes/s)，与 UploadLimit/DownloadLimit 取较小值，0=未限速
 }
 
 // ServerStats 统计信息
@@ -70,20 +131,57 @@ type ServerStats struct {
 	Connections int64
 }
 
+// DefaultInterface 默认接口 ID，旧版本的单接口配置即为该接口
+const DefaultInterface = 1
+
 var (
-	instance *WireGuardServer
-	once     sync.Once
+	registryMu sync.Mutex
+	registry   = make(map[int]*WireGuardServer) // 以接口 ID 为键
 )
 
-// GetServer 获取单例
-func GetServer() *WireGuardServer {
-	once.Do(func() {
-		instance = &WireGuardServer{
-			peers: make(map[string]*Peer),
-			stats: &ServerStats{},
+// GetServer 获取指定接口的服务端实例，不存在时创建
+func GetServer(id int) *WireGuardServer {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	s, ok := registry[id]
+	if !ok {
+		s = &WireGuardServer{
+			id:      id,
+			peers:   make(map[string]*Peer),
+			stats:   &ServerStats{},
+			traffic: make(map[string]*peerTraffic),
 		}
-	})
-	return instance
+		registry[id] = s
+	}
+	return s
+}
+
+// Servers 获取所有已创建的服务端实例，按接口 ID 排序
+func Servers() []*WireGuardServer {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	list := make([]*WireGuardServer, 0, len(registry))
+	for _, s := range registry {
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b *WireGuardServer) int { return a.id - b.id })
+	return list
+}
+
+// RemoveServer 停止并移除接口实例 (删除接口时调用)
+func RemoveServer(id int) {
+	registryMu.Lock()
+	s, ok := registry[id]
+	delete(registry, id)
+	registryMu.Unlock()
+	if ok {
+		s.Stop()
+	}
+}
+
+// ID 接口 ID
+func (s *WireGuardServer) ID() int {
+	return s.id
 }
 
 // Initialize 初始化
@@ -101,7 +199,7 @@ func (s *WireGuardServer) Initialize(ctx context.Context) error {
 		PrivateKey string
 		PublicKey  string
 	}
-	err := g.DB().Model("wireguard_config").Where("id", 1).Scan(&config)
+	err := g.DB().Model("wireguard_config").Where("id", s.id).Scan(&config)
 	if err != nil || config.PrivateKey == "" {
 		privateKey, publicKey, err := GenerateKeyPair()
 		if err != nil {
@@ -111,7 +209,7 @@ func (s *WireGuardServer) Initialize(ctx context.Context) error {
 		s.publicKey = publicKey
 
 		// 保存到数据库
-		_, _ = g.DB().Exec(ctx, `UPDATE wireguard_config SET private_key = ?, public_key = ? WHERE id = 1`, s.privateKey, s.publicKey)
+		_, _ = g.DB().Exec(ctx, `UPDATE wireguard_config SET private_key = ?, public_key = ? WHERE id = ?`, s.privateKey, s.publicKey, s.id)
 	} else {
 		s.privateKey = config.PrivateKey
 		s.publicKey = config.PublicKey
@@ -125,85 +223,164 @@ func (s *WireGuardServer) Initialize(ctx context.Context) error {
 	return nil
 }
 
-// Start 启动服务 (创建网卡 & 运行协议)
-func (s *WireGuardServer) Start(interfaceName string, listenPort int, privateKey, address, dns string) error {
+// Options 启动参数
+type Options struct {
+	Interface    string
+	Mode         string // ModeTUN (默认) | ModeNetstack
+	ListenPort   int
+	PrivateKey   string // Base64
+	Address      string
+	DNS          string
+	MTU          int            // 0 表示沿用配置文件
+	ProxyAddress string         // netstack 模式内置 SOCKS5 代理监听地址，如 ":50122"
+	ProxyAllow   []netip.Prefix // 内置代理默认拒绝回环、链路本地及宿主机地址，此处的网段例外
+	Keepalive    int            // 全局 PersistentKeepalive (秒)
+	UAPI         bool           // 开放标准 UAPI 套接字，供 wg 工具查看与修改
+	NAT          bool           // TUN 模式下自动配置转发与 MASQUERADE (仅 Linux)
+	OutInterface string         // NAT 出口网卡，为空时按默认路由自动检测
+
+	PostUp         string        // 网卡就绪后执行的命令，每行一条，%i 替换为网卡名
+	PostDown       string        // 网卡删除后执行的命令
+	HookTimeout    time.Duration // 单条命令超时，0 表示默认 30 秒
+	PostUpRollback bool          // PostUp 失败时停止服务
+
+	DNSServer     DNSHandler // 在隧道地址上提供内置 DNS，nil 表示不开启
+	LogLevel      string     // 设备日志等级 LogLevelError (默认) | LogLevelWarning | LogLevelInfo | LogLevelDebug
+	HandshakeDiag bool       // 记录被拒绝的握手；需要包装 UDP Bind，Linux 上会关闭粘性套接字，默认不开启
+}
+
+// Start 启动服务 (创建网卡 & 运行协议)，网卡就绪后执行 PostUp
+func (s *WireGuardServer) Start(opts Options) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	err := s.startLocked(opts)
+	ifaceName := s.hookInterfaceName()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
+	// 钩子执行期间不持有锁，避免长时间阻塞状态查询
+	if err := s.runHook(HookPostUp, opts.PostUp, ifaceName, opts.HookTimeout); err != nil && opts.PostUpRollback {
+		_ = s.Stop()
+		return fmt.Errorf("%v，已回滚启动", err)
+	}
+	return nil
+}
+
+// startLocked 创建网卡并启动协议 (调用方需持有 s.mu)
+func (s *WireGuardServer) startLocked(opts Options) error {
 	if s.running {
 		return fmt.Errorf("服务已在运行")
 	}
 
-	s.listenPort = listenPort
-	s.privateKey = privateKey
-	s.address = address
+	interfaceName := opts.Interface
+	s.ifaceName = interfaceName
+	s.mode = opts.Mode
+	if s.mode == "" {
+		s.mode = ModeTUN
+	}
+	s.listenPort = opts.ListenPort
+	s.keepalive = opts.Keepalive
+	s.privateKey = opts.PrivateKey
+	s.address = opts.Address
+	s.dns = opts.DNS
+	s.proxyAddr = opts.ProxyAddress
+	s.proxyAllow = opts.ProxyAllow
+	s.natEnabled = opts.NAT
+	s.natOut = opts.OutInterface
+	s.setHooks(opts)
+	s.setLogLevel(opts.LogLevel)
+	if opts.MTU > 0 {
+		s.mtu = opts.MTU
+	}
 	s.peers = make(map[string]*Peer) // 清空缓存，重新加载
 
-	// 1. 创建 TUN 设备 (跨平台)
-	// Windows会自动创建 Wintun 适配器
-	fmt.Printf("[WireGuard] Creating TUN device: %s\n", interfaceName)
-	tunDevice, err := tun.CreateTUN(interfaceName, s.mtu)
-	if err != nil {
-		return fmt.Errorf("创建 TUN 设备失败: %v", err)
+	// 1. 创建 TUN 设备
+	var tunDevice tun.Device
+	var err error
+	if s.mode == ModeNetstack {
+		// 用户态网络栈：隧道终止于本进程，不创建内核网卡
+		tunDevice, s.netstack, err = createNetstackTUN(s.address, opts.DNS, s.mtu)
+		if err != nil {
+			return fmt.Errorf("创建 netstack 设备失败: %v", err)
+		}
+	} else {
+		// 跨平台内核 TUN，Windows会自动创建 Wintun 适配器
+		tunDevice, err = tun.CreateTUN(interfaceName, s.mtu)
+		if err != nil {
+			return fmt.Errorf("创建 TUN 设备失败 (无 root/NET_ADMIN 权限时可改用 netstack 模式): %v", err)
+		}
 	}
 	s.tun = tunDevice
 
 	// 2. 获取真正的接口名称 (Windows上名字可能被重命名或GUID)
 	realName, _ := tunDevice.Name()
 	g.Log().Infof(context.Background(), "[WireGuard] TUN 设备已创建: %s", realName)
+	s.tunName = realName
+	s.routes = make(map[netip.Prefix]bool)
 
 	// 3. 创建 WireGuard 实例
-	fmt.Println("[DEBUG] Creating WireGuard device...")
-	logger := device.NewLogger(device.LogLevelError, fmt.Sprintf("(%s) ", interfaceName))
-	s.dev = device.NewDevice(tunDevice, conn.NewStdNetBind(), logger)
-	fmt.Println("[DEBUG] WireGuard device created")
+	s.acl = newACLTUN(tunDevice)
+	s.shaper = newShapedTUN(s.acl)
+	// 未开启握手诊断时直接使用 *conn.StdNetBind，保留 Linux 上的粘性套接字
+	var bind conn.Bind = conn.NewStdNetBind()
+	s.handshakeDiag = opts.HandshakeDiag
+	s.handshakes.clear()
+	if s.handshakeDiag {
+		s.handshakes.start(s.privateKey, func(r HandshakeReject, suppressed int) { s.logHandshakeReject(interfaceName, r, suppressed) })
+		bind = newHandshakeBind(bind, &s.handshakes)
+	}
+	s.dev = device.NewDevice(s.shaper, bind, s.newDeviceLogger(interfaceName))
 
 	// 4. 启动设备
-	fmt.Println("[DEBUG] Calling dev.Up()...")
 	if err := s.dev.Up(); err != nil {
-		tunDevice.Close()
+		s.stopLocked()
 		return fmt.Errorf("启动 Device 失败: %v", err)
 	}
-	fmt.Println("[DEBUG] dev.Up() completed")
 
 	// 5. 配置设备 (Private Key & Port)
 	// wireguard-go 使用 IPC 文本协议配置
 	// 密钥需要转换为 Hex
-	fmt.Println("[DEBUG] Converting private key...")
-	fmt.Printf("[DEBUG] privateKey length: %d\n", len(s.privateKey))
 	hexPrivKey, err := base64ToHex(s.privateKey)
 	if err != nil {
-		fmt.Printf("[DEBUG] base64ToHex failed: %v\n", err)
-		s.Stop()
+		s.stopLocked()
 		return fmt.Errorf("密钥格式错误: %v", err)
 	}
-	fmt.Printf("[DEBUG] hexPrivKey length: %d\n", len(hexPrivKey))
 
-	fmt.Println("[DEBUG] Calling IpcSet()...")
 	ipcConfig := fmt.Sprintf("private_key=%s\nlisten_port=%d\n", hexPrivKey, s.listenPort)
 	if err := s.dev.IpcSet(ipcConfig); err != nil {
-		fmt.Printf("[DEBUG] IpcSet failed: %v\n", err)
-		s.Stop()
+		s.stopLocked()
 		return fmt.Errorf("配置 Device 失败: %v", err)
 	}
-	fmt.Println("[DEBUG] IpcSet() completed")
 
-	// 6. 配置操作系统 IP 地址
-	fmt.Println("[DEBUG] About to configure IP...")
-	if runtime.GOOS == "windows" {
-		// Windows: 使用 LUID API 配置 IP（更可靠）
-		if err := configureIPWithLUID(tunDevice, s.address); err != nil {
-			g.Log().Errorf(context.Background(), "[WireGuard] LUID 配置 IP 失败: %v，尝试备用方案...", err)
-			// 备用方案：使用命令行
-			if err := s.configureInterfaceIP(realName, s.address); err != nil {
-				g.Log().Errorf(context.Background(), "[WireGuard] 备用方案也失败: %v", err)
-			}
-		}
+	// 6. 配置操作系统 IP 地址 (netstack 模式的地址在创建时已指定)
+	if s.mode == ModeNetstack {
+		s.netstack.start(context.Background(), opts.ProxyAddress, opts.ProxyAllow)
 	} else {
-		// Linux/macOS: 使用命令行配置 IP
-		if err := s.configureInterfaceIP(realName, s.address); err != nil {
+		prefixes, err := ParseServerAddress(s.address)
+		if err != nil {
 			g.Log().Errorf(context.Background(), "配置 IP 失败: %v", err)
 		}
+		// 双栈时 IPv4 / IPv6 地址分别下发
+		for _, prefix := range prefixes {
+			cidr := prefix.String()
+			if runtime.GOOS == "windows" {
+				// Windows: 使用 LUID API 配置 IP（更可靠）
+				if err := configureIPWithLUID(tunDevice, cidr); err != nil {
+					g.Log().Errorf(context.Background(), "[WireGuard] LUID 配置 IP 失败: %v，尝试备用方案...", err)
+					// 备用方案：使用命令行
+					if err := s.configureInterfaceIP(realName, cidr); err != nil {
+						g.Log().Errorf(context.Background(), "[WireGuard] 备用方案也失败: %v", err)
+					}
+				}
+			} else {
+				// Linux/macOS: 使用命令行配置 IP
+				if err := s.configureInterfaceIP(realName, cidr); err != nil {
+					g.Log().Errorf(context.Background(), "配置 IP 失败: %v", err)
+				}
+			}
+		}
+		s.setupNATLocked()
 	}
 
 	// 7. 加载并应用所有 Clients
@@ -211,6 +388,17 @@ func (s *WireGuardServer) Start(interfaceName string, listenPort int, privateKey
 		g.Log().Errorf(context.Background(), "加载 Clients 失败: %v", err)
 	}
 
+	// 8. 开放 UAPI 套接字 (失败不影响服务运行)
+	if opts.UAPI {
+		if err := s.startUAPILocked(); err != nil {
+			g.Log().Warningf(context.Background(), "[WireGuard] 开放 UAPI 套接字失败: %v", err)
+		}
+	}
+
+	// 9. 内置 DNS (地址配置完成后才能监听)
+	s.dnsHandler = opts.DNSServer
+	s.startDNSLocked()
+
 	s.running = true
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 	s.stats.StartTime = time.Now()
@@ -218,6 +406,7 @@ func (s *WireGuardServer) Start(interfaceName string, listenPort int, privateKey
 	// 初始化连接日志监控状态
 	s.lastHandshakes = make(map[string]time.Time)
 	s.lastOnline = make(map[string]bool)
+	s.lastEndpoints = make(map[string]string)
 
 	// 启动连接监控 goroutine
 	go s.monitorConnections()
@@ -226,33 +415,81 @@ func (s *WireGuardServer) Start(interfaceName string, listenPort int, privateKey
 	return nil
 }
 
-// Stop 停止服务
+// Stop 停止服务，网卡删除后执行 PostDown
 func (s *WireGuardServer) Stop() error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.running {
+		s.mu.Unlock()
 		return nil
 	}
+	ifaceName := s.hookInterfaceName()
+	postDown, timeout := s.postDown, s.hookTimeout
+	s.stopLocked()
+	s.mu.Unlock()
+
+	// 设备计数器随设备销毁归零，停止前把累计流量落库
+	s.FlushTraffic(context.Background())
+	// PostDown 失败不影响停止结果，执行结果可通过 HookResults 查看
+	_ = s.runHook(HookPostDown, postDown, ifaceName, timeout)
+	return nil
+}
+
+// setHooks 保存钩子配置，停止时使用最新的 PostDown (调用方需持有 s.mu)
+func (s *WireGuardServer) setHooks(opts Options) {
+	s.postUp = opts.PostUp
+	s.postDown = opts.PostDown
+	s.hookTimeout = opts.HookTimeout
+	s.postUpRollback = opts.PostUpRollback
+}
 
+// hookInterfaceName 钩子中 %i 对应的网卡名，netstack 模式下为配置的接口名 (调用方需持有 s.mu)
+func (s *WireGuardServer) hookInterfaceName() string {
+	if s.tunName != "" && s.mode != ModeNetstack {
+		return s.tunName
+	}
+	return s.ifaceName
+}
+
+// stopLocked 释放设备资源 (调用方需持有 s.mu)，也用于启动失败时的回滚
+func (s *WireGuardServer) stopLocked() {
 	if s.cancel != nil {
 		s.cancel()
+		s.cancel = nil
 	}
 
-	// 关闭 Device
+	s.stopUAPILocked()
+	s.stopDNSLocked()
+	s.teardownNATLocked()
+
+	// 关闭 Device 前读取最后一次计数器
 	if s.dev != nil {
+		s.refreshPeerStatsLocked()
+		for pubKey := range s.traffic {
+			s.resetTrafficBaseline(pubKey)
+		}
 		s.dev.Close()
 		s.dev = nil
 	}
 	// 显式关闭 TUN 设备（Windows 上必须显式关闭，否则会残留）
-	if s.tun != nil {
+	// 经由限速层关闭以保证只关闭一次，netstack 重复 Close 会 panic
+	if s.shaper != nil {
+		s.shaper.Close()
+	} else if s.tun != nil {
 		s.tun.Close()
-		s.tun = nil
+	}
+	s.tun = nil
+	s.shaper = nil
+	s.acl = nil
+	// 网卡销毁后路由随之删除
+	s.routes = nil
+	s.tunName = ""
+	if s.netstack != nil {
+		s.netstack.close()
+		s.netstack = nil
 	}
 
 	s.running = false
 	g.Log().Info(context.Background(), "[WireGuard] 服务已停止")
-	return nil
 }
 
 // IsRunning 状态查询
@@ -263,6 +500,9 @@ func (s *WireGuardServer) IsRunning() bool {
 }
 
 func (s *WireGuardServer) GetInterfaceName() string {
+	if s.mode == ModeNetstack && s.ifaceName != "" {
+		return s.ifaceName
+	}
 	if s.tun != nil {
 		name, _ := s.tun.Name()
 		return name
@@ -270,6 +510,14 @@ func (s *WireGuardServer) GetInterfaceName() string {
 	return "omniwire" // default
 }
 
+// GetMode 当前运行模式
+func (s *WireGuardServer) GetMode() string {
+	if s.mode == "" {
+		return ModeTUN
+	}
+	return s.mode
+}
+
 func (s *WireGuardServer) GetListenPort() int {
 	return s.listenPort
 }
@@ -305,6 +553,7 @@ func (s *WireGuardServer) GetAllPeers() map[string]*Peer {
 	for k, v := range s.peers {
 		// 浅拷贝
 		p := *v
+		p.PendingUpload, p.PendingDownload = s.pendingTraffic(k)
 		copyPeers[k] = &p
 	}
 	return copyPeers
@@ -315,7 +564,15 @@ func (s *WireGuardServer) RefreshPeerStats() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if !s.running || s.dev == nil {
+	if !s.running {
+		return
+	}
+	s.refreshPeerStatsLocked()
+}
+
+// refreshPeerStatsLocked 解析 IpcGet 输出并更新统计 (调用方需持有 s.mu)
+func (s *WireGuardServer) refreshPeerStatsLocked() {
+	if s.dev == nil {
 		return
 	}
 
@@ -325,11 +582,28 @@ func (s *WireGuardServer) RefreshPeerStats() {
 		return
 	}
 
-	// 解析 IPC 输出
-	// 格式: key=value\n，每个 peer 以 public_key= 开头
-	var currentPubKey string
-	var lastHandshakeSec, lastHandshakeNsec int64
-	var rxBytes, txBytes int64
+	for _, st := range parseIpcPeers(ipcData) {
+		s.updatePeerStats(st)
+	}
+}
+
+// ipcPeerStats IpcGet 输出中单个 Peer 的状态
+type ipcPeerStats struct {
+	PublicKey     string // Base64
+	PresharedKey  string // Base64，未设置时为空
+	AllowedIPs    []netip.Prefix
+	Endpoint      string
+	HandshakeSec  int64
+	HandshakeNsec int64
+	RxBytes       int64
+	TxBytes       int64
+}
+
+// parseIpcPeers 解析 IpcGet 输出
+// 格式: key=value\n，每个 peer 以 public_key= 开头
+func parseIpcPeers(ipcData string) []*ipcPeerStats {
+	var result []*ipcPeerStats
+	var current *ipcPeerStats
 
 	for _, line := range strings.Split(ipcData, "\n") {
 		line = strings.TrimSpace(line)
@@ -343,48 +617,60 @@ func (s *WireGuardServer) RefreshPeerStats() {
 		}
 
 		key, value := parts[0], parts[1]
+		if key == "public_key" {
+			// 开始新的 peer，将 hex 转为 base64
+			current = nil
+			if b64Key, err := hexToBase64(value); err == nil {
+				current = &ipcPeerStats{PublicKey: b64Key}
+				result = append(result, current)
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
 
 		switch key {
-		case "public_key":
-			// 保存上一个 peer 的数据
-			if currentPubKey != "" {
-				s.updatePeerStats(currentPubKey, lastHandshakeSec, lastHandshakeNsec, rxBytes, txBytes)
+		case "preshared_key":
+			if value != strings.Repeat("0", 64) {
+				current.PresharedKey, _ = hexToBase64(value)
 			}
-			// 开始新的 peer，将 hex 转为 base64
-			if b64Key, err := hexToBase64(value); err == nil {
-				currentPubKey = b64Key
-			} else {
-				currentPubKey = ""
+
+		case "allowed_ip":
+			if prefix, err := netip.ParsePrefix(value); err == nil {
+				current.AllowedIPs = append(current.AllowedIPs, prefix)
 			}
-			lastHandshakeSec, lastHandshakeNsec, rxBytes, txBytes = 0, 0, 0, 0
+
+		case "endpoint":
+			current.Endpoint = value
 
 		case "last_handshake_time_sec":
-			lastHandshakeSec, _ = strconv.ParseInt(value, 10, 64)
+			current.HandshakeSec, _ = strconv.ParseInt(value, 10, 64)
 
 		case "last_handshake_time_nsec":
-			lastHandshakeNsec, _ = strconv.ParseInt(value, 10, 64)
+			current.HandshakeNsec, _ = strconv.ParseInt(value, 10, 64)
 
 		case "rx_bytes":
-			rxBytes, _ = strconv.ParseInt(value, 10, 64)
+			current.RxBytes, _ = strconv.ParseInt(value, 10, 64)
 
 		case "tx_bytes":
-			txBytes, _ = strconv.ParseInt(value, 10, 64)
+			current.TxBytes, _ = strconv.ParseInt(value, 10, 64)
 		}
 	}
-
-	// 保存最后一个 peer 的数据
-	if currentPubKey != "" {
-		s.updatePeerStats(currentPubKey, lastHandshakeSec, lastHandshakeNsec, rxBytes, txBytes)
-	}
+	return result
 }
 
-func (s *WireGuardServer) updatePeerStats(pubKey string, handshakeSec, handshakeNsec, rx, tx int64) {
-	if peer, ok := s.peers[pubKey]; ok {
-		if handshakeSec > 0 {
-			peer.LastHandshake = time.Unix(handshakeSec, handshakeNsec)
+func (s *WireGuardServer) updatePeerStats(st *ipcPeerStats) {
+	if peer, ok := s.peers[st.PublicKey]; ok {
+		if st.HandshakeSec > 0 {
+			peer.LastHandshake = time.Unix(st.HandshakeSec, st.HandshakeNsec)
+		}
+		if st.Endpoint != "" {
+			peer.Endpoint = st.Endpoint
 		}
-		peer.TransferRx = rx
-		peer.TransferTx = tx
+		peer.TransferRx = st.RxBytes
+		peer.TransferTx = st.TxBytes
+		s.accumulateTraffic(st.PublicKey, st.RxBytes, st.TxBytes)
 	}
 }
 
@@ -420,6 +706,11 @@ func (s *WireGuardServer) configureInterfaceIP(ifaceName, cidr string) error {
 	ipStr := ip.String()
 	ones, _ := ipNet.Mask.Size()
 
+	// IPv6 地址单独处理，Windows 下的 NAT / APIPA 逻辑仅适用于 IPv4
+	if ip.To4() == nil {
+		return configureInterfaceIPv6(ifaceName, ipStr, ones)
+	}
+
 	// Windows implementation
 	if runtime.GOOS == "windows" {
 		// 1. 使用 PowerShell 等待并查找 Wintun 网卡 (Go 的 net 包在 Windows 上可能无法正确识别 Wintun)
@@ -664,24 +955,97 @@ func (s *WireGuardServer) configureInterfaceIP(ifaceName, cidr string) error {
 	return fmt.Errorf("unsupported os: %s", runtime.GOOS)
 }
 
+// removeInterfaceIP 删除网卡上的地址，用于在线修改服务端地址
+func removeInterfaceIP(ifaceName string, prefix netip.Prefix) error {
+	ipStr := prefix.Addr().String()
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		family := "ipv4"
+		if prefix.Addr().Is6() {
+			family = "ipv6"
+		}
+		cmd = exec.Command("netsh", "interface", family, "delete", "address", ifaceName, ipStr)
+	case "linux":
+		cmd = exec.Command("ip", "address", "del", prefix.String(), "dev", ifaceName)
+	case "darwin":
+		family := "inet"
+		if prefix.Addr().Is6() {
+			family = "inet6"
+		}
+		cmd = exec.Command("ifconfig", ifaceName, family, ipStr, "delete")
+	default:
+		return fmt.Errorf("unsupported os: %s", runtime.GOOS)
+	}
+	g.Log().Debugf(context.Background(), "Exec: %s", cmd.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("删除地址失败: %v, output: %s", err, string(out))
+	}
+	return nil
+}
+
+// configureInterfaceIPv6 为网卡添加 IPv6 地址
+func configureInterfaceIPv6(ifaceName, ipStr string, ones int) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		// netsh interface ipv6 add address "接口名" fd42::1/64
+		cmd = exec.Command("netsh", "interface", "ipv6", "add", "address", ifaceName, fmt.Sprintf("%s/%d", ipStr, ones))
+	case "linux":
+		cmd = exec.Command("ip", "-6", "address", "add", fmt.Sprintf("%s/%d", ipStr, ones), "dev", ifaceName)
+	case "darwin":
+		cmd = exec.Command("ifconfig", ifaceName, "inet6", ipStr, "prefixlen", fmt.Sprint(ones), "alias")
+	default:
+		return fmt.Errorf("unsupported os: %s", runtime.GOOS)
+	}
+	g.Log().Debugf(context.Background(), "Exec: %s", cmd.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("配置 IPv6 地址失败: %v, output: %s", err, string(out))
+	}
+	if runtime.GOOS == "linux" {
+		if out, err := exec.Command("ip", "link", "set", "up", "dev", ifaceName).CombinedOutput(); err != nil {
+			return fmt.Errorf("ip link error: %v, output: %s", err, string(out))
+		}
+	}
+	return nil
+}
+
 // loadPeersFromDB 读取数据库
 func (s *WireGuardServer) loadPeersFromDB(ctx context.Context) error {
 	type PeerRecord struct {
-		Name       string
-		PublicKey  string
-		AllowedIps string
-		Enabled    int
+		Id                  int
+		GroupId             int
+		Name                string
+		PublicKey           string
+		PresharedKey        string
+		AllowedIps          string
+		RoutedNetworks      string
+		Endpoint            string
+		PersistentKeepalive int
+		ThrottleRate        int64
+		Enabled             int
+		UploadLimit         int64
+		DownloadLimit       int64
 	}
 	var records []PeerRecord
-	if err := g.DB().Model("wireguard_peer").Scan(&records); err != nil {
+	if err := g.DB().Model("wireguard_peer").Where("interface_id", s.id).Scan(&records); err != nil {
 		return err
 	}
 	for _, r := range records {
 		s.peers[r.PublicKey] = &Peer{
-			Name:       r.Name,
-			PublicKey:  r.PublicKey,
-			AllowedIPs: r.AllowedIps,
-			Enabled:    r.Enabled == 1,
+			Id:             r.Id,
+			GroupId:        r.GroupId,
+			Name:           r.Name,
+			PublicKey:      r.PublicKey,
+			PresharedKey:   r.PresharedKey,
+			AllowedIPs:     r.AllowedIps,
+			Enabled:        r.Enabled == 1,
+			UploadLimit:    r.UploadLimit,
+			DownloadLimit:  r.DownloadLimit,
+			StaticEndpoint: r.Endpoint,
+			Keepalive:      r.PersistentKeepalive,
+			RoutedNetworks: r.RoutedNetworks,
+			ThrottleRate:   r.ThrottleRate,
 		}
 	}
 	return nil
@@ -694,31 +1058,20 @@ func (s *WireGuardServer) loadAndApplyPeers(ctx context.Context) error {
 	}
 
 	// 构建 IPC 字符串
-	// public_key=...
-	// allowed_ip=...
-	// endpoint=... (可选)
 	var ipcBuilder strings.Builder
 	for _, p := range s.peers {
 		if !p.Enabled {
 			continue // 跳过禁用的Peer
 		}
-
-		hexKey, err := base64ToHex(p.PublicKey)
+		ipc, err := peerIpc(p, s.keepalive)
 		if err != nil {
+			g.Log().Warningf(ctx, "[WireGuard] 跳过 Peer %s: %v", p.Name, err)
 			continue
 		}
-
-		ipcBuilder.WriteString(fmt.Sprintf("public_key=%s\n", hexKey))
-
-		// Allowed IPs
-		for _, cidr := range strings.Split(p.AllowedIPs, ",") {
-			cidr = strings.TrimSpace(cidr)
-			if cidr != "" {
-				ipcBuilder.WriteString(fmt.Sprintf("allowed_ip=%s\n", cidr))
-			}
-		}
-		// persistent_keepalive_interval=25
+		ipcBuilder.WriteString(ipc)
 	}
+	s.syncShaper()
+	s.syncRoutes()
 
 	if s.dev != nil {
 		return s.dev.IpcSet(ipcBuilder.String())
@@ -726,27 +1079,29 @@ func (s *WireGuardServer) loadAndApplyPeers(ctx context.Context) error {
 	return nil
 }
 
-// AddPeer 动态添加 Peer
-func (s *WireGuardServer) AddPeer(publicKey, allowedIPs string) error {
+// AddPeer 添加或更新 Peer 配置，启用状态的 Peer 立即下发到设备
+func (s *WireGuardServer) AddPeer(peer *Peer) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// 内存记录
-	s.peers[publicKey] = &Peer{
-		PublicKey:  publicKey,
-		AllowedIPs: allowedIPs,
-		Enabled:    true,
+	// 内存记录，已存在时保留运行时状态
+	if old, ok := s.peers[peer.PublicKey]; ok {
+		old.setConfig(peer)
+		peer = old
+	} else {
+		s.peers[peer.PublicKey] = peer
 	}
+	s.syncShaper()
+	s.syncRoutes()
 
-	if !s.running || s.dev == nil {
+	if !peer.Enabled || !s.running || s.dev == nil {
 		return nil
 	}
 
 	// 下发配置
-	hexKey, _ := base64ToHex(publicKey)
-	ipc := fmt.Sprintf("public_key=%s\n", hexKey)
-	for _, cidr := range strings.Split(allowedIPs, ",") {
-		ipc += fmt.Sprintf("allowed_ip=%s\n", strings.TrimSpace(cidr))
+	ipc, err := peerIpc(peer, s.keepalive)
+	if err != nil {
+		return err
 	}
 	return s.dev.IpcSet(ipc)
 }
@@ -755,8 +1110,23 @@ func (s *WireGuardServer) AddPeer(publicKey, allowedIPs string) error {
 func (s *WireGuardServer) RemovePeer(publicKey string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.removePeerLocked(publicKey)
+}
+
+// ReplacePeerKey 客户端更换公钥时移除旧 Peer，尚未写入数据库的流量转到新公钥名下
+func (s *WireGuardServer) ReplacePeerKey(oldKey, newKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moveTraffic(oldKey, newKey)
+	return s.removePeerLocked(oldKey)
+}
 
+// removePeerLocked 从内存与设备中移除 Peer (调用方需持有 s.mu)
+func (s *WireGuardServer) removePeerLocked(publicKey string) error {
 	delete(s.peers, publicKey)
+	delete(s.traffic, publicKey)
+	s.syncShaper()
+	s.syncRoutes()
 
 	if !s.running || s.dev == nil {
 		return nil
@@ -777,11 +1147,17 @@ func (s *WireGuardServer) DisablePeer(publicKey string) error {
 	if peer, ok := s.peers[publicKey]; ok {
 		peer.Enabled = false
 	}
+	s.syncShaper()
+	s.syncRoutes()
 
 	if !s.running || s.dev == nil {
 		return nil
 	}
 
+	// 移除前记录最后一次计数器，重新启用后计数器从 0 开始
+	s.refreshPeerStatsLocked()
+	s.resetTrafficBaseline(publicKey)
+
 	// 从设备移除
 	hexKey, _ := base64ToHex(publicKey)
 	ipc := fmt.Sprintf("public_key=%s\nremove=true\n", hexKey)
@@ -789,39 +1165,93 @@ func (s *WireGuardServer) DisablePeer(publicKey string) error {
 }
 
 // EnablePeer 启用 Peer（添加到设备）
-func (s *WireGuardServer) EnablePeer(publicKey, allowedIPs string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *WireGuardServer) EnablePeer(peer *Peer) error {
+	peer.Enabled = true
+	return s.AddPeer(peer)
+}
 
-	// 更新内存状态
-	if peer, ok := s.peers[publicKey]; ok {
-		peer.Enabled = true
-	} else {
-		s.peers[publicKey] = &Peer{
-			PublicKey:  publicKey,
-			AllowedIPs: allowedIPs,
-			Enabled:    true,
+// setConfig 用数据库中的配置覆盖内存记录 (握手、流量等运行时状态保留)
+func (p *Peer) setConfig(from *Peer) {
+	p.Id = from.Id
+	p.GroupId = from.GroupId
+	p.Name = from.Name
+	p.PresharedKey = from.PresharedKey
+	p.AllowedIPs = from.AllowedIPs
+	p.UploadLimit = from.UploadLimit
+	p.DownloadLimit = from.DownloadLimit
+	p.Enabled = from.Enabled
+	p.StaticEndpoint = from.StaticEndpoint
+	p.Keepalive = from.Keepalive
+	p.RoutedNetworks = from.RoutedNetworks
+	p.ThrottleRate = from.ThrottleRate
+}
+
+// peerIpc 生成单个 Peer 的 IPC 配置
+// 未设置预共享密钥时下发全 0 密钥以清除旧值；AllowedIPs 整体替换
+// 仅配置了对端地址的 Peer 下发 endpoint 与保活，其余 Peer 的保活由客户端配置决定
+func peerIpc(p *Peer, defaultKeepalive int) (string, error) {
+	hexKey, err := base64ToHex(p.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("公钥格式错误: %v", err)
+	}
+	hexPsk := strings.Repeat("0", 64)
+	if p.PresharedKey != "" {
+		if hexPsk, err = base64ToHex(p.PresharedKey); err != nil {
+			return "", fmt.Errorf("预共享密钥格式错误: %v", err)
 		}
 	}
 
-	if !s.running || s.dev == nil {
-		return nil
+	var b strings.Builder
+	fmt.Fprintf(&b, "public_key=%s\n", hexKey)
+	fmt.Fprintf(&b, "preshared_key=%s\n", hexPsk)
+	if p.StaticEndpoint != "" {
+		addr, err := net.ResolveUDPAddr("udp", p.StaticEndpoint)
+		if err != nil {
+			return "", fmt.Errorf("解析 Endpoint %s 失败: %v", p.StaticEndpoint, err)
+		}
+		keepalive := p.Keepalive
+		if keepalive < 0 {
+			keepalive = defaultKeepalive
+		}
+		ap := addr.AddrPort()
+		fmt.Fprintf(&b, "endpoint=%s\n", netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()))
+		fmt.Fprintf(&b, "persistent_keepalive_interval=%d\n", keepalive)
+	} else {
+		b.WriteString("persistent_keepalive_interval=0\n")
 	}
-
-	// 添加到设备
-	hexKey, _ := base64ToHex(publicKey)
-	ipc := fmt.Sprintf("public_key=%s\n", hexKey)
-	for _, cidr := range strings.Split(allowedIPs, ",") {
+	b.WriteString("replace_allowed_ips=true\n")
+	// 隧道地址 + 路由网段
+	for _, cidr := range strings.Split(p.AllowedIPs+","+p.RoutedNetworks, ",") {
 		cidr = strings.TrimSpace(cidr)
 		if cidr != "" {
-			ipc += fmt.Sprintf("allowed_ip=%s\n", cidr)
+			fmt.Fprintf(&b, "allowed_ip=%s\n", cidr)
 		}
 	}
-	return s.dev.IpcSet(ipc)
+	return b.String(), nil
+}
+
+// syncShaper 将内存中的 Peer 同步到限速层、访问控制层与握手诊断 (调用方需持有 s.mu)
+func (s *WireGuardServer) syncShaper() {
+	s.handshakes.sync(s.peers)
+	if s.shaper != nil {
+		s.shaper.sync(s.peers, s.groupLimits)
+	}
+	if s.acl != nil {
+		s.acl.sync(s.aclPolicy, s.aclRules, s.peers)
+	}
 }
 
 // ==================== 辅助工具 ====================
 
+// GeneratePresharedKey 生成 Base64 预共享密钥
+func GeneratePresharedKey() (string, error) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key[:]), nil
+}
+
 // GenerateKeyPair 生成 Base64 密钥对
 func GenerateKeyPair() (string, string, error) {
 	var privateKey [32]byte
@@ -842,6 +1272,30 @@ func GenerateKeyPair() (string, string, error) {
 		base64.StdEncoding.EncodeToString(publicKey[:]), nil
 }
 
+// PublicKeyFromPrivate 由 Base64 私钥计算公钥
+func PublicKeyFromPrivate(privateKey string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil || len(raw) != 32 {
+		return "", fmt.Errorf("私钥格式错误")
+	}
+	var priv, pub [32]byte
+	copy(priv[:], raw)
+	curve25519.ScalarBaseMult(&pub, &priv)
+	return base64.StdEncoding.EncodeToString(pub[:]), nil
+}
+
+// CheckKey 校验 Base64 编码的 Curve25519 密钥 (公钥 / 预共享密钥)
+func CheckKey(key string) error {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return fmt.Errorf("密钥格式错误，应为 32 字节的 Base64 编码")
+	}
+	if [32]byte(raw) == [32]byte{} {
+		return fmt.Errorf("密钥不能全为 0")
+	}
+	return nil
+}
+
 func base64ToHex(b64 string) (string, error) {
 	bytes, err := base64.StdEncoding.DecodeString(b64)
 	if err != nil {
@@ -862,6 +1316,8 @@ func hexToBase64(hexStr string) (string, error) {
 func (s *WireGuardServer) monitorConnections() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
+	flushTicker := time.NewTicker(trafficFlushInterval)
+	defer flushTicker.Stop()
 
 	for {
 		select {
@@ -869,6 +1325,9 @@ func (s *WireGuardServer) monitorConnections() {
 			return
 		case <-ticker.C:
 			s.checkConnectionChanges()
+		case <-flushTicker.C:
+			s.RefreshPeerStats()
+			s.FlushTraffic(context.Background())
 		}
 	}
 }
@@ -910,7 +1369,7 @@ func (s *WireGuardServer) checkConnectionChanges() {
 		Name      string
 	}
 	var peerIdRows []peerIdRow
-	_ = g.DB().Model("wireguard_peer").Fields("id, public_key, name").Scan(&peerIdRows)
+	_ = g.DB().Model("wireguard_peer").Fields("id, public_key, name").Where("interface_id", s.id).Scan(&peerIdRows)
 	peerIdMap := make(map[string]peerIdRow)
 	for _, row := range peerIdRows {
 		peerIdMap[row.PublicKey] = row
@@ -943,6 +1402,11 @@ func (s *WireGuardServer) checkConnectionChanges() {
 			}
 		}
 
+		// Endpoint 变化 → 记录 roaming 事件 (首次出现的 Endpoint 随 online 事件记录)
+		if prevEndpoint := s.lastEndpoints[snap.PublicKey]; snap.Endpoint != "" && prevEndpoint != "" && snap.Endpoint != prevEndpoint {
+			s.insertConnectionLog(ctx, peerID, peerName, snap.PublicKey, "roaming", snap.Endpoint, snap.TransferRx, snap.TransferTx)
+		}
+
 		// 从在线变为离线
 		if !nowOnline && wasOnline {
 			s.insertConnectionLog(ctx, peerID, peerName, snap.PublicKey, "offline", snap.Endpoint, snap.TransferRx, snap.TransferTx)
@@ -953,14 +1417,29 @@ func (s *WireGuardServer) checkConnectionChanges() {
 			s.lastHandshakes[snap.PublicKey] = snap.LastHandshake
 		}
 		s.lastOnline[snap.PublicKey] = nowOnline
+		if snap.Endpoint != "" {
+			s.lastEndpoints[snap.PublicKey] = snap.Endpoint
+		}
 	}
 }
 
+// LogPeerEvent 记录由管理操作触发的连接事件 (如 expired)，附带 Peer 当前的 Endpoint 与流量
+func (s *WireGuardServer) LogPeerEvent(ctx context.Context, peerID int, peerName, publicKey, event string) {
+	var endpoint string
+	var rx, tx int64
+	s.mu.RLock()
+	if p, ok := s.peers[publicKey]; ok {
+		endpoint, rx, tx = p.Endpoint, p.TransferRx, p.TransferTx
+	}
+	s.mu.RUnlock()
+	s.insertConnectionLog(ctx, peerID, peerName, publicKey, event, endpoint, rx, tx)
+}
+
 // insertConnectionLog 插入连接日志记录
 func (s *WireGuardServer) insertConnectionLog(ctx context.Context, peerID int, peerName, publicKey, event, endpoint string, rx, tx int64) {
 	_, err := g.DB().Exec(ctx,
-		`INSERT INTO wireguard_connection_log (peer_id, peer_name, public_key, event, endpoint, transfer_rx, transfer_tx) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		peerID, peerName, publicKey, event, endpoint, rx, tx,
+		`INSERT INTO wireguard_connection_log (interface_id, peer_id, peer_name, public_key, event, endpoint, transfer_rx, transfer_tx) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.id, peerID, peerName, publicKey, event, endpoint, rx, tx,
 	)
 	if err != nil {
 		g.Log().Warningf(ctx, "[WireGuard] 写入连接日志失败: %v", err)
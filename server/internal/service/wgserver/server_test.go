@@ -0,0 +1,79 @@
+package wgserver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPeerIpcStaticEndpointAndKeepalive(t *testing.T) {
+	_, pub, _ := GenerateKeyPair()
+	psk, _ := GeneratePresharedKey()
+
+	// 站点互联：下发 endpoint，保活继承全局配置
+	ipc, err := peerIpc(&Peer{PublicKey: pub, PresharedKey: psk, AllowedIPs: "10.66.66.2/32", RoutedNetworks: "192.168.10.0/24", StaticEndpoint: "127.0.0.1:51821", Keepalive: -1}, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"endpoint=127.0.0.1:51821\n", "persistent_keepalive_interval=25\n", "allowed_ip=192.168.10.0/24\n"} {
+		if !strings.Contains(ipc, want) {
+			t.Fatalf("expected %q in:\n%s", want, ipc)
+		}
+	}
+	if strings.Contains(ipc, "preshared_key="+strings.Repeat("0", 64)) {
+		t.Fatalf("expected preshared key to be set:\n%s", ipc)
+	}
+
+	// 普通客户端：不下发 endpoint，保活由客户端配置决定，未设置预共享密钥时清除
+	ipc, err = peerIpc(&Peer{PublicKey: pub, AllowedIPs: "10.66.66.3/32", Keepalive: 10}, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(ipc, "endpoint=") || !strings.Contains(ipc, "persistent_keepalive_interval=0\n") {
+		t.Fatalf("unexpected ipc for roaming peer:\n%s", ipc)
+	}
+	if !strings.Contains(ipc, "preshared_key="+strings.Repeat("0", 64)) {
+		t.Fatalf("expected preshared key to be cleared:\n%s", ipc)
+	}
+}
+
+func TestParseIpcPeersMatchesPeerConfig(t *testing.T) {
+	_, pub, _ := GenerateKeyPair()
+	psk, _ := GeneratePresharedKey()
+	peer := &Peer{PublicKey: pub, PresharedKey: psk, AllowedIPs: "10.66.66.2/32", RoutedNetworks: "192.168.10.1/24", Keepalive: -1}
+
+	// 下发的内容解析回来后应与数据库中的配置一致，否则会被误报为漂移
+	ipc, err := peerIpc(peer, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := parseIpcPeers(ipc)
+	if len(peers) != 1 || peers[0].PublicKey != pub || peers[0].PresharedKey != psk {
+		t.Fatalf("unexpected parsed peers: %+v", peers)
+	}
+	got, want := joinPrefixes(sortedPrefixes(peers[0].AllowedIPs)), joinPrefixes(peerAllowedPrefixes(peer))
+	if got != want || want != "10.66.66.2/32, 192.168.10.0/24" {
+		t.Fatalf("allowed ips mismatch: device %q, config %q", got, want)
+	}
+}
+
+func TestReplacePeerKeyKeepsPendingTraffic(t *testing.T) {
+	_, oldKey, _ := GenerateKeyPair()
+	_, newKey, _ := GenerateKeyPair()
+	s := &WireGuardServer{peers: map[string]*Peer{oldKey: {PublicKey: oldKey}}, traffic: make(map[string]*peerTraffic)}
+	s.accumulateTraffic(oldKey, 100, 200)
+
+	if err := s.ReplacePeerKey(oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.traffic[oldKey]; ok {
+		t.Fatal("old key traffic should be removed")
+	}
+	if rx, tx := s.pendingTraffic(newKey); rx != 100 || tx != 200 {
+		t.Fatalf("pending traffic = %d/%d, want 100/200", rx, tx)
+	}
+	// 新 Peer 的设备计数器从零开始累计
+	s.accumulateTraffic(newKey, 10, 20)
+	if rx, tx := s.pendingTraffic(newKey); rx != 110 || tx != 220 {
+		t.Fatalf("pending traffic = %d/%d, want 110/220", rx, tx)
+	}
+}
@@ -0,0 +1,315 @@
+// ==========================================================================
+// OmniWire - WireGuard Peer 限速 (令牌桶, 位于 TUN 与 device.Device 之间)
+// ==========================================================================
+
+package wgserver
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// routedShaper Peer 后方局域网网段对应的限速器
+type routedShaper struct {
+	prefix netip.Prefix
+	ps     *peerShaper
+}
+
+// minBurst 令牌桶最小容量，保证任意单个数据包都能通过
+const minBurst = 32 * 1024
+
+// tokenBucket 令牌桶 (bytes/s)
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   int64 // bytes/s, 0=无限制
+	burst  int64
+	tokens float64
+	last   time.Time
+}
+
+// setRate 修改速率，已积累的令牌按新容量截断
+func (b *tokenBucket) setRate(rate int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if rate < 0 {
+		rate = 0
+	}
+	b.rate = rate
+	b.burst = rate
+	if b.burst < minBurst {
+		b.burst = minBurst
+	}
+	if b.last.IsZero() || b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = time.Now()
+}
+
+// allow 尝试消耗 n 字节令牌，令牌不足时返回 false
+func (b *tokenBucket) allow(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// peerShaper 单个 Peer 的上下行令牌桶
+type peerShaper struct {
+	upload   tokenBucket // Peer -> 服务端
+	download tokenBucket // 服务端 -> Peer
+}
+
+// shapedTUN 包装 tun.Device，按数据包中的 Peer 隧道 IP 或 Peer 后方的路由网段执行限速
+//
+// Write: device -> 系统，数据来自 Peer，按源地址计入上传
+// Read:  系统 -> device，数据发往 Peer，按目的地址计入下载
+// 超出令牌的数据包直接丢弃 (policing)，不阻塞 wireguard-go 的收发协程，
+// TCP 等协议会据此自行降速。
+type shapedTUN struct {
+	tun.Device
+
+	mu     sync.RWMutex
+	byKey  map[string]*peerShaper     // 公钥 -> 限速器
+	byAddr map[netip.Addr]*peerShaper // 隧道 IP -> 限速器
+	byNet  []routedShaper             // 路由网段 -> 限速器，与隧道地址共用同一组令牌桶
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newShapedTUN(dev tun.Device) *shapedTUN {
+	return &shapedTUN{
+		Device: dev,
+		byKey:  make(map[string]*peerShaper),
+		byAddr: make(map[netip.Addr]*peerShaper),
+	}
+}
+
+// GroupLimit 分组限速 (bytes/s, 0=无限制)，作用于组内未单独设置限速的 Peer
+type GroupLimit struct {
+	Upload   int64
+	Download int64
+}
+
+// SetGroupLimits 替换分组限速 (以分组 ID 为键) 并立即同步到限速层，服务未运行时在启动后生效
+func (s *WireGuardServer) SetGroupLimits(limits map[int]GroupLimit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groupLimits = limits
+	if s.shaper != nil {
+		s.shaper.sync(s.peers, s.groupLimits)
+	}
+}
+
+// peerRateLimits Peer 的实际上下行限速：Peer 单独设置的值优先，为 0 时使用所在分组的限速
+func peerRateLimits(p *Peer, groups map[int]GroupLimit) (upload, download int64) {
+	upload, download = p.UploadLimit, p.DownloadLimit
+	if group, ok := groups[p.GroupId]; ok && p.GroupId > 0 {
+		if upload <= 0 {
+			upload = group.Upload
+		}
+		if download <= 0 {
+			download = group.Download
+		}
+	}
+	return upload, download
+}
+
+// sync 根据当前 Peer 列表与分组限速重建限速表，已有 Peer 保留令牌桶状态
+func (t *shapedTUN) sync(peers map[string]*Peer, groups map[int]GroupLimit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byKey := make(map[string]*peerShaper)
+	byAddr := make(map[netip.Addr]*peerShaper)
+	var byNet []routedShaper
+	for key, p := range peers {
+		upload, download := peerRateLimits(p, groups)
+		upload, download = effectiveRate(upload, p.ThrottleRate), effectiveRate(download, p.ThrottleRate)
+		if !p.Enabled || (upload <= 0 && download <= 0) {
+			continue
+		}
+		ps, ok := t.byKey[key]
+		if !ok {
+			ps = &peerShaper{}
+		}
+		ps.upload.setRate(upload)
+		ps.download.setRate(download)
+		byKey[key] = ps
+		for _, addr := range peerTunnelAddrs(p.AllowedIPs) {
+			byAddr[addr] = ps
+		}
+		prefixes, _ := ParseRoutedNetworks(p.RoutedNetworks)
+		for _, prefix := range prefixes {
+			byNet = append(byNet, routedShaper{prefix: prefix, ps: ps})
+		}
+	}
+	t.byKey = byKey
+	t.byAddr = byAddr
+	t.byNet = byNet
+}
+
+// effectiveRate 合并管理员限速与超额限速，取非零值中较小者
+func effectiveRate(limit, throttle int64) int64 {
+	if throttle > 0 && (limit <= 0 || throttle < limit) {
+		return throttle
+	}
+	return limit
+}
+
+func (t *shapedTUN) lookup(addr netip.Addr) *peerShaper {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.byAddr) == 0 {
+		return nil
+	}
+	if ps, ok := t.byAddr[addr]; ok {
+		return ps
+	}
+	// 不同 Peer 的路由网段互不重叠 (见 checkRoutedNetworks)，命中第一个即可
+	for _, r := range t.byNet {
+		if r.prefix.Contains(addr) {
+			return r.ps
+		}
+	}
+	return nil
+}
+
+// Read 系统 -> Peer 方向，丢弃超出下载限速的数据包
+func (t *shapedTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	for {
+		n, err := t.Device.Read(bufs, sizes, offset)
+		if n == 0 {
+			return n, err
+		}
+
+		kept := 0
+		for i := 0; i < n; i++ {
+			pkt := bufs[i][offset : offset+sizes[i]]
+			if ps := t.lookup(packetDst(pkt)); ps != nil && !ps.download.allow(len(pkt)) {
+				continue
+			}
+			if kept != i {
+				copy(bufs[kept][offset:], pkt)
+				sizes[kept] = sizes[i]
+			}
+			kept++
+		}
+
+		// 整批都被丢弃时继续读取，避免向 device 返回 0 个包
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// Write Peer -> 系统方向，丢弃超出上传限速的数据包
+func (t *shapedTUN) Write(bufs [][]byte, offset int) (int, error) {
+	var kept [][]byte
+	for i, buf := range bufs {
+		pkt := buf[offset:]
+		if ps := t.lookup(packetSrc(pkt)); ps != nil && !ps.upload.allow(len(pkt)) {
+			if kept == nil {
+				kept = append(make([][]byte, 0, len(bufs)), bufs[:i]...)
+			}
+			continue
+		}
+		if kept != nil {
+			kept = append(kept, buf)
+		}
+	}
+	if kept == nil {
+		return t.Device.Write(bufs, offset)
+	}
+	if len(kept) == 0 {
+		return len(bufs), nil
+	}
+	if _, err := t.Device.Write(kept, offset); err != nil {
+		return 0, err
+	}
+	return len(bufs), nil
+}
+
+// Close 关闭底层设备，device.Close 与 Stop 都会调用，只执行一次
+func (t *shapedTUN) Close() error {
+	t.closeOnce.Do(func() {
+		t.closeErr = t.Device.Close()
+	})
+	return t.closeErr
+}
+
+// ==================== 数据包解析 ====================
+
+// packetSrc 解析 IP 数据包源地址
+func packetSrc(pkt []byte) netip.Addr {
+	if len(pkt) < 1 {
+		return netip.Addr{}
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) >= 20 {
+			return netip.AddrFrom4([4]byte(pkt[12:16]))
+		}
+	case 6:
+		if len(pkt) >= 40 {
+			return netip.AddrFrom16([16]byte(pkt[8:24]))
+		}
+	}
+	return netip.Addr{}
+}
+
+// packetDst 解析 IP 数据包目的地址
+func packetDst(pkt []byte) netip.Addr {
+	if len(pkt) < 1 {
+		return netip.Addr{}
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) >= 20 {
+			return netip.AddrFrom4([4]byte(pkt[16:20]))
+		}
+	case 6:
+		if len(pkt) >= 40 {
+			return netip.AddrFrom16([16]byte(pkt[24:40]))
+		}
+	}
+	return netip.Addr{}
+}
+
+// peerTunnelAddrs 从 AllowedIPs 中提取 Peer 的隧道地址
+// 兼容 "10.66.66.2/24"、"10.66.66.2/32" 与不带前缀的写法
+func peerTunnelAddrs(allowedIPs string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, item := range strings.Split(allowedIPs, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			addrs = append(addrs, prefix.Addr())
+		} else if addr, err := netip.ParseAddr(item); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
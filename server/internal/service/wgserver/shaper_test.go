@@ -0,0 +1,150 @@
+package wgserver
+
+import (
+	"net/netip"
+	"os"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// fakeTUN 返回预置数据包并记录写入的数据包
+type fakeTUN struct {
+	reads   [][]byte
+	written [][]byte
+}
+
+func (f *fakeTUN) File() *os.File           { return nil }
+func (f *fakeTUN) MTU() (int, error)        { return 1420, nil }
+func (f *fakeTUN) Name() (string, error)    { return "fake", nil }
+func (f *fakeTUN) Events() <-chan tun.Event { return nil }
+func (f *fakeTUN) Close() error             { return nil }
+func (f *fakeTUN) BatchSize() int           { return len(f.reads) }
+
+func (f *fakeTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	n := min(len(bufs), len(f.reads))
+	for i := 0; i < n; i++ {
+		sizes[i] = copy(bufs[i][offset:], f.reads[i])
+	}
+	f.reads = f.reads[n:]
+	return n, nil
+}
+
+func (f *fakeTUN) Write(bufs [][]byte, offset int) (int, error) {
+	for _, b := range bufs {
+		f.written = append(f.written, append([]byte(nil), b[offset:]...))
+	}
+	return len(bufs), nil
+}
+
+func ipv4Packet(src, dst string, size int) []byte {
+	pkt := make([]byte, size)
+	pkt[0] = 0x45
+	s, d := netip.MustParseAddr(src).As4(), netip.MustParseAddr(dst).As4()
+	copy(pkt[12:16], s[:])
+	copy(pkt[16:20], d[:])
+	return pkt
+}
+
+func TestShapedTUNDropsPacketsOverLimit(t *testing.T) {
+	limited := ipv4Packet("10.66.66.1", "10.66.66.2", 20*1024)
+	free := ipv4Packet("10.66.66.1", "10.66.66.3", 20*1024)
+
+	inner := &fakeTUN{reads: [][]byte{limited, limited, free}}
+	shaper := newShapedTUN(inner)
+	shaper.sync(map[string]*Peer{
+		"peer-a": {PublicKey: "peer-a", AllowedIPs: "10.66.66.2/32", DownloadLimit: 1024, Enabled: true},
+		"peer-b": {PublicKey: "peer-b", AllowedIPs: "10.66.66.3/32", Enabled: true},
+	}, nil)
+
+	const offset = 16
+	bufs := make([][]byte, 3)
+	for i := range bufs {
+		bufs[i] = make([]byte, offset+32*1024)
+	}
+	sizes := make([]int, 3)
+
+	n, err := shaper.Read(bufs, sizes, offset)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	// 令牌桶初始容量 32KiB：第一个 20KiB 包通过，第二个被丢弃，无限速 Peer 不受影响
+	if n != 2 {
+		t.Fatalf("expected 2 packets, got %d", n)
+	}
+	if got := packetDst(bufs[1][offset : offset+sizes[1]]); got != netip.MustParseAddr("10.66.66.3") {
+		t.Fatalf("expected compacted packet for 10.66.66.3, got %s", got)
+	}
+
+	up := ipv4Packet("10.66.66.2", "10.66.66.1", 100)
+	shaper.sync(map[string]*Peer{
+		"peer-a": {PublicKey: "peer-a", AllowedIPs: "10.66.66.2/32", UploadLimit: 1024, Enabled: true},
+	}, nil)
+	if _, err := shaper.Write([][]byte{append(make([]byte, offset), up...)}, offset); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if len(inner.written) != 1 {
+		t.Fatalf("expected upload packet to pass, got %d written", len(inner.written))
+	}
+}
+
+func TestPeerRateLimitsFallBackToGroup(t *testing.T) {
+	groups := map[int]GroupLimit{7: {Upload: 1000, Download: 2000}}
+	cases := []struct {
+		peer             Peer
+		upload, download int64
+	}{
+		{Peer{GroupId: 7}, 1000, 2000},
+		{Peer{GroupId: 7, UploadLimit: 500}, 500, 2000},
+		{Peer{GroupId: 8}, 0, 0},
+		{Peer{UploadLimit: 300}, 300, 0},
+	}
+	for i, c := range cases {
+		if up, down := peerRateLimits(&c.peer, groups); up != c.upload || down != c.download {
+			t.Errorf("case %d: got %d/%d, want %d/%d", i, up, down, c.upload, c.download)
+		}
+	}
+
+	// 修改分组限速后组内成员立即生效，移出分组后不再受限
+	shaper := newShapedTUN(&fakeTUN{})
+	peers := map[string]*Peer{"peer-a": {PublicKey: "peer-a", GroupId: 7, AllowedIPs: "10.66.66.2/32", Enabled: true}}
+	shaper.sync(peers, groups)
+	if ps := shaper.lookup(netip.MustParseAddr("10.66.66.2")); ps == nil || ps.download.rate != 2000 {
+		t.Fatal("group limit not applied to member")
+	}
+	shaper.sync(peers, map[int]GroupLimit{7: {Download: 4000}})
+	if ps := shaper.lookup(netip.MustParseAddr("10.66.66.2")); ps == nil || ps.download.rate != 4000 {
+		t.Fatal("edited group limit not applied to member")
+	}
+	peers["peer-a"].GroupId = 0
+	shaper.sync(peers, groups)
+	if shaper.lookup(netip.MustParseAddr("10.66.66.2")) != nil {
+		t.Fatal("peer moved out of group should not be limited")
+	}
+}
+
+func TestShapedTUNLimitsRoutedNetworks(t *testing.T) {
+	inner := &fakeTUN{}
+	shaper := newShapedTUN(inner)
+	shaper.sync(map[string]*Peer{
+		"site": {PublicKey: "site", AllowedIPs: "10.66.66.2/32", RoutedNetworks: "192.168.50.0/24", UploadLimit: 1024, Enabled: true},
+	}, nil)
+
+	tunnel, lan := shaper.lookup(netip.MustParseAddr("10.66.66.2")), shaper.lookup(netip.MustParseAddr("192.168.50.10"))
+	if tunnel == nil || lan != tunnel {
+		t.Fatal("routed network should share the peer's limiter")
+	}
+	if shaper.lookup(netip.MustParseAddr("192.168.51.10")) != nil {
+		t.Fatal("address outside routed network should not be limited")
+	}
+
+	// 令牌桶初始容量 32KiB：局域网主机发出的第二个 20KiB 包被丢弃
+	const offset = 16
+	up := append(make([]byte, offset), ipv4Packet("192.168.50.10", "8.8.8.8", 20*1024)...)
+	if _, err := shaper.Write([][]byte{up, up}, offset); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if len(inner.written) != 1 {
+		t.Fatalf("expected 1 packet from routed network to pass, got %d", len(inner.written))
+	}
+}
@@ -0,0 +1,109 @@
+// ==========================================================================
+// OmniWire - WireGuard Peer 累计流量 (写入 total_upload/total_download)
+// ==========================================================================
+
+package wgserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// trafficFlushInterval 累计流量写入数据库的间隔
+const trafficFlushInterval = time.Minute
+
+// peerTraffic 单个 Peer 的流量累计状态
+type peerTraffic struct {
+	lastRx    int64 // 上次读取的设备计数器 rx_bytes
+	lastTx    int64 // 上次读取的设备计数器 tx_bytes
+	pendingRx int64 // 尚未写入数据库的上传增量 (Peer -> 服务端)
+	pendingTx int64 // 尚未写入数据库的下载增量 (服务端 -> Peer)
+}
+
+// accumulateTraffic 根据设备计数器计算增量 (调用方需持有 s.mu)
+// 计数器变小说明设备重启或 Peer 被重新添加，此时当前值即为增量
+func (s *WireGuardServer) accumulateTraffic(pubKey string, rx, tx int64) {
+	t, ok := s.traffic[pubKey]
+	if !ok {
+		t = &peerTraffic{}
+		s.traffic[pubKey] = t
+	}
+
+	deltaRx := rx - t.lastRx
+	if deltaRx < 0 {
+		deltaRx = rx
+	}
+	deltaTx := tx - t.lastTx
+	if deltaTx < 0 {
+		deltaTx = tx
+	}
+
+	t.pendingRx += deltaRx
+	t.pendingTx += deltaTx
+	t.lastRx, t.lastTx = rx, tx
+}
+
+// resetTrafficBaseline Peer 从设备移除后计数器归零 (调用方需持有 s.mu)
+func (s *WireGuardServer) resetTrafficBaseline(pubKey string) {
+	if t, ok := s.traffic[pubKey]; ok {
+		t.lastRx, t.lastTx = 0, 0
+	}
+}
+
+// pendingTraffic 返回尚未写入数据库的流量 (调用方需持有 s.mu)
+func (s *WireGuardServer) pendingTraffic(pubKey string) (rx, tx int64) {
+	if t, ok := s.traffic[pubKey]; ok {
+		return t.pendingRx, t.pendingTx
+	}
+	return 0, 0
+}
+
+// moveTraffic 将尚未写入数据库的流量转到新公钥，新 Peer 的设备计数器从零开始 (调用方需持有 s.mu)
+func (s *WireGuardServer) moveTraffic(oldKey, newKey string) {
+	rx, tx := s.pendingTraffic(oldKey)
+	if rx == 0 && tx == 0 {
+		return
+	}
+	t, ok := s.traffic[newKey]
+	if !ok {
+		t = &peerTraffic{}
+		s.traffic[newKey] = t
+	}
+	t.pendingRx += rx
+	t.pendingTx += tx
+}
+
+// FlushTraffic 将累计的流量增量写入数据库
+func (s *WireGuardServer) FlushTraffic(ctx context.Context) {
+	type delta struct{ rx, tx int64 }
+
+	s.mu.Lock()
+	deltas := make(map[string]delta)
+	for pubKey, t := range s.traffic {
+		if t.pendingRx == 0 && t.pendingTx == 0 {
+			continue
+		}
+		deltas[pubKey] = delta{t.pendingRx, t.pendingTx}
+		t.pendingRx, t.pendingTx = 0, 0
+	}
+	s.mu.Unlock()
+
+	for pubKey, d := range deltas {
+		_, err := g.DB().Exec(ctx,
+			`UPDATE wireguard_peer SET total_upload = total_upload + ?, total_download = total_download + ? WHERE public_key = ?`,
+			d.rx, d.tx, pubKey,
+		)
+		if err != nil {
+			g.Log().Warningf(ctx, "[WireGuard] 写入累计流量失败: %v", err)
+			// 写入失败则放回，下次重试
+			s.mu.Lock()
+			if t, ok := s.traffic[pubKey]; ok {
+				t.pendingRx += d.rx
+				t.pendingTx += d.tx
+			}
+			s.mu.Unlock()
+		}
+	}
+}
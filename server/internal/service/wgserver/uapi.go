@@ -0,0 +1,169 @@
+// ==========================================================================
+// OmniWire - UAPI 套接字与配置漂移检测
+// 设备在进程内创建，开放标准 UAPI 套接字后可使用 wg show / wg set 调试；
+// 通过 wg set 做出的修改不会写入数据库，由 DetectDrift 与数据库对比找出差异
+// ==========================================================================
+
+package wgserver
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 漂移类型
+const (
+	DriftUnknown      = "unknown"       // 设备上存在，但 OmniWire 中不存在或已禁用
+	DriftMissing      = "missing"       // OmniWire 中已启用，但设备上不存在
+	DriftAllowedIPs   = "allowed_ips"   // AllowedIPs 与 OmniWire 不一致
+	DriftPresharedKey = "preshared_key" // 预共享密钥与 OmniWire 不一致
+)
+
+// PeerDrift 设备与 OmniWire 配置之间的差异
+type PeerDrift struct {
+	Kind         string
+	PublicKey    string
+	Name         string // OmniWire 中的名称，不存在时为空
+	AllowedIPs   string // 设备上的 AllowedIPs
+	PresharedKey string // 设备上的预共享密钥 (Base64)，为空表示未设置
+}
+
+// UAPIEnabled UAPI 套接字是否已开放
+func (s *WireGuardServer) UAPIEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.uapi != nil
+}
+
+// uapiName UAPI 套接字名称：TUN 模式使用系统网卡名，与 wg show 显示一致
+func (s *WireGuardServer) uapiName() string {
+	if s.mode == ModeTUN && s.tunName != "" {
+		return s.tunName
+	}
+	return s.ifaceName
+}
+
+// startUAPILocked 开放 UAPI 套接字 (调用方需持有 s.mu)
+func (s *WireGuardServer) startUAPILocked() error {
+	if s.uapi != nil || s.dev == nil {
+		return nil
+	}
+	name := s.uapiName()
+	listener, err := listenUAPI(name)
+	if err != nil {
+		return err
+	}
+	s.uapi = listener
+	s.uapiSock = name
+
+	dev := s.dev
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go dev.IpcHandle(conn)
+		}
+	}()
+	g.Log().Infof(context.Background(), "[WireGuard] UAPI 已开放，可使用 wg show %s 查看", name)
+	return nil
+}
+
+// stopUAPILocked 关闭 UAPI 套接字 (调用方需持有 s.mu)
+func (s *WireGuardServer) stopUAPILocked() {
+	if s.uapi == nil {
+		return
+	}
+	closeUAPI(s.uapiSock, s.uapi)
+	s.uapi = nil
+	s.uapiSock = ""
+}
+
+// DetectDrift 对比设备实际配置与 OmniWire 中的 Peer，返回所有差异
+func (s *WireGuardServer) DetectDrift() ([]*PeerDrift, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.running || s.dev == nil {
+		return nil, nil
+	}
+	ipcData, err := s.dev.IpcGet()
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []*PeerDrift
+	seen := make(map[string]bool)
+	for _, st := range parseIpcPeers(ipcData) {
+		seen[st.PublicKey] = true
+		drift := &PeerDrift{
+			PublicKey:    st.PublicKey,
+			AllowedIPs:   joinPrefixes(st.AllowedIPs),
+			PresharedKey: st.PresharedKey,
+		}
+		peer, ok := s.peers[st.PublicKey]
+		if ok {
+			drift.Name = peer.Name
+		}
+		if !ok || !peer.Enabled {
+			drift.Kind = DriftUnknown
+			drifts = append(drifts, drift)
+			continue
+		}
+		if !slices.Equal(peerAllowedPrefixes(peer), sortedPrefixes(st.AllowedIPs)) {
+			d := *drift
+			d.Kind = DriftAllowedIPs
+			drifts = append(drifts, &d)
+		}
+		if peer.PresharedKey != st.PresharedKey {
+			d := *drift
+			d.Kind = DriftPresharedKey
+			drifts = append(drifts, &d)
+		}
+	}
+	for key, peer := range s.peers {
+		if peer.Enabled && !seen[key] {
+			drifts = append(drifts, &PeerDrift{Kind: DriftMissing, PublicKey: key, Name: peer.Name})
+		}
+	}
+	return drifts, nil
+}
+
+// peerAllowedPrefixes Peer 应下发到设备的 AllowedIPs (隧道地址 + 路由网段)，已规范化并排序
+func peerAllowedPrefixes(p *Peer) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, cidr := range strings.Split(p.AllowedIPs+","+p.RoutedNetworks, ",") {
+		if prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr)); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return sortedPrefixes(prefixes)
+}
+
+// sortedPrefixes 规范化 (按掩码截断)、去重并排序
+func sortedPrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	result := make([]netip.Prefix, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		result = append(result, prefix.Masked())
+	}
+	slices.SortFunc(result, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+	return slices.Compact(result)
+}
+
+func joinPrefixes(prefixes []netip.Prefix) string {
+	items := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		items = append(items, prefix.String())
+	}
+	return strings.Join(items, ", ")
+}
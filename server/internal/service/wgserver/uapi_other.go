@@ -0,0 +1,29 @@
+//go:build !windows
+
+package wgserver
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.zx2c4.com/wireguard/ipc"
+)
+
+// uapiSocketDir wg 工具查找 UAPI 套接字的目录
+const uapiSocketDir = "/var/run/wireguard"
+
+// listenUAPI 监听 /var/run/wireguard/<name>.sock
+func listenUAPI(name string) (net.Listener, error) {
+	file, err := ipc.UAPIOpen(name)
+	if err != nil {
+		return nil, err
+	}
+	return ipc.UAPIListen(name, file)
+}
+
+// closeUAPI 关闭监听并删除套接字文件，避免 wg show 列出已停止的接口
+func closeUAPI(name string, listener net.Listener) {
+	listener.Close()
+	os.Remove(filepath.Join(uapiSocketDir, name+".sock"))
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package wgserver
+
+import (
+	"net"
+
+	"golang.zx2c4.com/wireguard/ipc"
+)
+
+// listenUAPI 监听命名管道 \\.\pipe\ProtectedPrefix\Administrators\WireGuard\<name>
+func listenUAPI(name string) (net.Listener, error) {
+	return ipc.UAPIListen(name)
+}
+
+// closeUAPI 关闭监听，命名管道随之释放
+func closeUAPI(name string, listener net.Listener) {
+	listener.Close()
+}
@@ -0,0 +1,290 @@
+// ==========================================================================
+// OmniWire - WireGuard 隧道内访问控制 (Peer 隔离与 ACL 规则)
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/model/entity"
+	"omniwire/internal/service/ipam"
+	"omniwire/internal/service/wgserver"
+)
+
+// ACLRuleInput ACL 规则输入
+type ACLRuleInput struct {
+	Name          string
+	Priority      int
+	Action        string
+	SourcePeerId  int
+	SourceGroupId int
+	Destination   string
+	Protocol      string
+	Port          string
+	Enabled       bool
+}
+
+// ACLOutput 接口的访问控制策略与规则
+type ACLOutput struct {
+	Policy      string
+	DefaultHits uint64 // 默认策略丢弃的数据包数 (自服务启动起)
+	Rules       []*wireguard.ACLRuleInfo
+}
+
+// GetACL 获取接口的默认策略与规则列表 (含命中次数)
+func GetACL(ctx context.Context, iface int) (*ACLOutput, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+	var rules []*entity.WireguardAclRule
+	if err := g.DB().Model("wireguard_acl_rule").Ctx(ctx).Where("interface_id", iface).
+		OrderAsc("priority").OrderAsc("id").Scan(&rules); err != nil {
+		return nil, err
+	}
+	hits, defaultHits := wgserver.GetServer(iface).ACLHits()
+
+	output := &ACLOutput{
+		Policy:      aclPolicy(ctx, iface),
+		DefaultHits: defaultHits,
+		Rules:       make([]*wireguard.ACLRuleInfo, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		output.Rules = append(output.Rules, &wireguard.ACLRuleInfo{
+			Id:            rule.Id,
+			Name:          rule.Name,
+			Priority:      rule.Priority,
+			Action:        rule.Action,
+			SourcePeerId:  rule.SourcePeerId,
+			SourceGroupId: rule.SourceGroupId,
+			Destination:   rule.Destination,
+			Protocol:      rule.Protocol,
+			Port:          rule.Port,
+			Enabled:       rule.Enabled == 1,
+			Hits:          hits[rule.Id],
+			CreatedAt:     rule.CreatedAt.String(),
+			UpdatedAt:     rule.UpdatedAt.String(),
+		})
+	}
+	return output, nil
+}
+
+// SetACLPolicy 设置未命中规则时的默认策略，运行中立即生效
+func SetACLPolicy(ctx context.Context, iface int, policy string) error {
+	if policy != wgserver.ACLAllowAll && policy != wgserver.ACLIsolate {
+		return fmt.Errorf("不支持的默认策略: %s", policy)
+	}
+	if err := checkInterface(ctx, iface); err != nil {
+		return err
+	}
+	res, err := g.DB().Model("wireguard_config").Ctx(ctx).Where("id", iface).Data(g.Map{"acl_policy": policy}).Update()
+	if err != nil {
+		return fmt.Errorf("保存默认策略失败: %v", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("请先保存接口配置")
+	}
+	g.Log().Infof(ctx, "[WireGuard] 接口 %d 访问控制默认策略: %s", iface, policy)
+	return loadACL(ctx, iface)
+}
+
+// CreateACLRule 创建 ACL 规则
+func CreateACLRule(ctx context.Context, iface int, input *ACLRuleInput) (int, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return 0, err
+	}
+	if err := checkACLRuleInput(ctx, iface, input); err != nil {
+		return 0, err
+	}
+	rule := &entity.WireguardAclRule{
+		InterfaceId:   iface,
+		Name:          input.Name,
+		Priority:      input.Priority,
+		Action:        input.Action,
+		SourcePeerId:  input.SourcePeerId,
+		SourceGroupId: input.SourceGroupId,
+		Destination:   input.Destination,
+		Protocol:      input.Protocol,
+		Port:          input.Port,
+		Enabled:       boolToInt(input.Enabled),
+		CreatedAt:     gtime.Now(),
+		UpdatedAt:     gtime.Now(),
+	}
+	res, err := g.DB().Model("wireguard_acl_rule").FieldsEx("id").Insert(rule)
+	if err != nil {
+		return 0, fmt.Errorf("保存规则失败: %v", err)
+	}
+	id, _ := res.LastInsertId()
+
+	g.Log().Infof(ctx, "[WireGuard] 创建访问控制规则: %s (%s)", input.Name, input.Action)
+	return int(id), loadACL(ctx, iface)
+}
+
+// UpdateACLRule 更新 ACL 规则，已有的命中计数保留
+func UpdateACLRule(ctx context.Context, iface, id int, input *ACLRuleInput) error {
+	if _, err := getACLRule(ctx, iface, id); err != nil {
+		return err
+	}
+	if err := checkACLRuleInput(ctx, iface, input); err != nil {
+		return err
+	}
+	_, err := g.DB().Model("wireguard_acl_rule").Where("id", id).Data(g.Map{
+		"name":            input.Name,
+		"priority":        input.Priority,
+		"action":          input.Action,
+		"source_peer_id":  input.SourcePeerId,
+		"source_group_id": input.SourceGroupId,
+		"destination":     input.Destination,
+		"protocol":        input.Protocol,
+		"port":            input.Port,
+		"enabled":         boolToInt(input.Enabled),
+		"updated_at":      gtime.Now(),
+	}).Update()
+	if err != nil {
+		return fmt.Errorf("更新规则失败: %v", err)
+	}
+	return loadACL(ctx, iface)
+}
+
+// DeleteACLRule 删除 ACL 规则
+func DeleteACLRule(ctx context.Context, iface, id int) error {
+	rule, err := getACLRule(ctx, iface, id)
+	if err != nil {
+		return err
+	}
+	if _, err := g.DB().Model("wireguard_acl_rule").Where("id", id).Delete(); err != nil {
+		return fmt.Errorf("删除规则失败: %v", err)
+	}
+	g.Log().Infof(ctx, "[WireGuard] 删除访问控制规则: %s", rule.Name)
+	return loadACL(ctx, iface)
+}
+
+// loadACL 从数据库加载接口的默认策略与已启用规则，下发到服务端 (运行中立即生效)
+func loadACL(ctx context.Context, iface int) error {
+	var rules []*entity.WireguardAclRule
+	if err := g.DB().Model("wireguard_acl_rule").Ctx(ctx).Where("interface_id", iface).Where("enabled", 1).
+		OrderAsc("priority").OrderAsc("id").Scan(&rules); err != nil {
+		return fmt.Errorf("加载访问控制规则失败: %v", err)
+	}
+	compiled := make([]wgserver.ACLRule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := compileACLRule(rule)
+		if err != nil {
+			// 入库前已校验，仅手工修改数据库时出现
+			g.Log().Warningf(ctx, "[WireGuard] 跳过无效的访问控制规则 %d: %v", rule.Id, err)
+			continue
+		}
+		compiled = append(compiled, r)
+	}
+	wgserver.GetServer(iface).SetACL(aclPolicy(ctx, iface), compiled)
+	return nil
+}
+
+// aclPolicy 接口的默认策略，未保存配置时为 allow
+func aclPolicy(ctx context.Context, iface int) string {
+	policy, _ := g.DB().Model("wireguard_config").Ctx(ctx).Where("id", iface).Value("acl_policy")
+	if policy.String() == wgserver.ACLIsolate {
+		return wgserver.ACLIsolate
+	}
+	return wgserver.ACLAllowAll
+}
+
+// compileACLRule 数据库规则转换为服务端规则
+func compileACLRule(rule *entity.WireguardAclRule) (wgserver.ACLRule, error) {
+	r := wgserver.ACLRule{
+		Id:          rule.Id,
+		Action:      rule.Action,
+		SourcePeer:  rule.SourcePeerId,
+		SourceGroup: rule.SourceGroupId,
+		Protocol:    rule.Protocol,
+	}
+	prefixes, err := ipam.ParsePrefixes(rule.Destination)
+	if err != nil {
+		return r, err
+	}
+	for _, prefix := range prefixes {
+		r.Destinations = append(r.Destinations, prefix.Masked())
+	}
+	r.PortFrom, r.PortTo, err = parsePortRange(rule.Port)
+	return r, err
+}
+
+// getACLRule 获取接口下的规则，不存在时返回错误
+func getACLRule(ctx context.Context, iface, id int) (*entity.WireguardAclRule, error) {
+	var rule *entity.WireguardAclRule
+	err := g.DB().Model("wireguard_acl_rule").Ctx(ctx).Where("id", id).Where("interface_id", iface).Scan(&rule)
+	if err != nil || rule == nil {
+		return nil, fmt.Errorf("规则不存在")
+	}
+	return rule, nil
+}
+
+// checkACLRuleInput 校验并规范化规则输入
+func checkACLRuleInput(ctx context.Context, iface int, input *ACLRuleInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Protocol = strings.ToLower(strings.TrimSpace(input.Protocol))
+	input.Port = strings.TrimSpace(input.Port)
+	if input.Action != wgserver.ACLActionAllow && input.Action != wgserver.ACLActionDeny {
+		return fmt.Errorf("不支持的规则动作: %s", input.Action)
+	}
+	if input.SourcePeerId > 0 && input.SourceGroupId > 0 {
+		return fmt.Errorf("来源客户端与来源分组只能指定一个")
+	}
+	if input.SourcePeerId > 0 {
+		if _, err := getPeer(ctx, iface, input.SourcePeerId); err != nil {
+			return err
+		}
+	}
+	if input.SourceGroupId > 0 {
+		if _, err := getGroup(ctx, input.SourceGroupId); err != nil {
+			return err
+		}
+	}
+
+	prefixes, err := ipam.ParsePrefixes(input.Destination)
+	if err != nil {
+		return err
+	}
+	destinations := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		destinations = append(destinations, prefix.Masked().String())
+	}
+	input.Destination = strings.Join(destinations, ",")
+
+	switch input.Protocol {
+	case "", "tcp", "udp", "icmp":
+	default:
+		return fmt.Errorf("不支持的协议: %s", input.Protocol)
+	}
+	if input.Port != "" && input.Protocol != "tcp" && input.Protocol != "udp" {
+		return fmt.Errorf("仅 tcp / udp 规则可以指定端口")
+	}
+	if _, _, err := parsePortRange(input.Port); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parsePortRange 解析 "443" 或 "8000-8100" 形式的端口，为空表示任意端口
+func parsePortRange(port string) (uint16, uint16, error) {
+	if port == "" {
+		return 0, 0, nil
+	}
+	from, to, isRange := strings.Cut(port, "-")
+	if !isRange {
+		to = from
+	}
+	start, err1 := strconv.ParseUint(strings.TrimSpace(from), 10, 16)
+	end, err2 := strconv.ParseUint(strings.TrimSpace(to), 10, 16)
+	if err1 != nil || err2 != nil || start == 0 || end < start {
+		return 0, 0, fmt.Errorf("端口格式无效: %s", port)
+	}
+	return uint16(start), uint16(end), nil
+}
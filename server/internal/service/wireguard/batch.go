@@ -0,0 +1,232 @@
+// ==========================================================================
+// OmniWire - WireGuard 客户端批量创建与导出
+// ==========================================================================
+
+package wireguard
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/model/entity"
+	"omniwire/internal/service/wgserver"
+)
+
+// maxBatchPeers 单次批量创建的客户端数量上限
+const maxBatchPeers = 500
+
+// 导出格式
+const (
+	ExportCSV  = "csv"
+	ExportJSON = "json"
+)
+
+// exportColumns 导出 CSV 的表头，不包含私钥等敏感信息
+var exportColumns = []string{
+	"id", "name", "group", "tags", "allowedIPs", "routedNetworks", "publicKey", "enabled",
+	"staticEndpoint", "uploadLimit", "downloadLimit", "expiresAt", "quotaBytes",
+	"totalUpload", "totalDownload", "latestHandshake", "createdAt",
+}
+
+// ParsePeerCSV 解析批量创建的 CSV：每行 "名称[,地址]"，首行为 name 表头时跳过
+func ParsePeerCSV(data string) ([]*PeerInput, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式错误: %v", err)
+	}
+
+	inputs := make([]*PeerInput, 0, len(records))
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "name") {
+			continue
+		}
+		input := &PeerInput{Name: strings.TrimSpace(record[0])}
+		if len(record) > 1 {
+			input.AllowedIPs = strings.TrimSpace(record[1])
+		}
+		if input.Name == "" && input.AllowedIPs == "" {
+			continue
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// BatchCreatePeers 在同一事务中为接口批量创建客户端，任一失败则全部回滚
+// 地址分配沿用 CreatePeer 的逻辑，事务内已创建的客户端会参与后续地址分配
+func BatchCreatePeers(ctx context.Context, iface int, inputs []*PeerInput) ([]*entity.WireguardPeer, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("客户端列表为空")
+	}
+	if len(inputs) > maxBatchPeers {
+		return nil, fmt.Errorf("单次最多创建 %d 个客户端", maxBatchPeers)
+	}
+	for i, input := range inputs {
+		input.Name = strings.TrimSpace(input.Name)
+		if input.Name == "" {
+			return nil, fmt.Errorf("第 %d 个客户端名称为空", i+1)
+		}
+	}
+
+	// 生成的配置需要公网地址，提前检查避免创建后无法导出
+	serverConfig, err := GetConfig(ctx, iface)
+	if err != nil {
+		return nil, err
+	}
+	if serverConfig.EndpointAddress == "" {
+		return nil, fmt.Errorf("请先在 WireGuard 配置中设置公网地址")
+	}
+
+	peers := make([]*entity.WireguardPeer, 0, len(inputs))
+	err = g.DB().Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		for i, input := range inputs {
+			peer, err := insertPeer(ctx, iface, input)
+			if err != nil {
+				return fmt.Errorf("第 %d 个客户端 %s: %v", i+1, input.Name, err)
+			}
+			peers = append(peers, peer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 事务提交后再同步运行时
+	server := wgserver.GetServer(iface)
+	if server.IsRunning() {
+		for _, peer := range peers {
+			server.AddPeer(runtimePeer(peer))
+		}
+	}
+	g.Log().Infof(ctx, "[WireGuard] 接口 %s 批量创建客户端: %d 个", serverConfig.Interface, len(peers))
+	return peers, nil
+}
+
+// BuildPeerArchive 打包客户端配置文件与二维码 (ZIP)，每个客户端包含 <名称>.conf 与 <名称>.png
+// 使用自有密钥的客户端只有配置模板，不生成二维码
+func BuildPeerArchive(ctx context.Context, peers []*entity.WireguardPeer) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	used := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		config, err := GetPeerConfig(ctx, peer.InterfaceId, peer.Id, false)
+		if err != nil {
+			return nil, err
+		}
+		// 名称重复时追加 ID 区分
+		name := archiveName(peer.Name)
+		if used[name] {
+			name = fmt.Sprintf("%s-%d", name, peer.Id)
+		}
+		used[name] = true
+
+		files := map[string][]byte{name + ".conf": []byte(config)}
+		if peer.External == 0 {
+			qr, err := encodeQRCode(config)
+			if err != nil {
+				return nil, err
+			}
+			files[name+".png"] = qr
+		}
+		for _, file := range []string{name + ".conf", name + ".png"} {
+			content, ok := files[file]
+			if !ok {
+				continue
+			}
+			w, err := zw.Create(file)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportPeers 导出接口的客户端清单 (CSV 或 JSON)，流量包含尚未落库的增量
+func ExportPeers(ctx context.Context, iface int, format string) ([]byte, error) {
+	peers, err := GetPeers(ctx, iface, -1, "")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case ExportJSON:
+		return json.MarshalIndent(peers, "", "  ")
+	case ExportCSV, "":
+		return peersCSV(peers)
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+}
+
+func peersCSV(peers []*wireguard.PeerInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	for _, p := range peers {
+		record := []string{
+			strconv.Itoa(p.Id),
+			p.Name,
+			p.GroupName,
+			p.Tags,
+			p.AllowedIPs,
+			p.RoutedNetworks,
+			p.PublicKey,
+			strconv.FormatBool(p.Enabled),
+			p.StaticEndpoint,
+			strconv.FormatInt(p.UploadLimit, 10),
+			strconv.FormatInt(p.DownloadLimit, 10),
+			p.ExpiresAt,
+			strconv.FormatInt(p.QuotaBytes, 10),
+			strconv.FormatInt(p.TotalUpload, 10),
+			strconv.FormatInt(p.TotalDownload, 10),
+			p.LatestHandshake,
+			p.CreatedAt,
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// archiveName 将客户端名称转换为安全的文件名
+func archiveName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return "peer"
+	}
+	return name
+}
@@ -0,0 +1,59 @@
+// ==========================================================================
+// OmniWire - WireGuard 内置 DNS
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+	"strings"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/service/dnsserver"
+	"omniwire/internal/service/wgserver"
+)
+
+// builtinDNSServers 客户端配置中的 DNS：服务端隧道地址加客户端域名 (wg-quick 将非 IP 项作为搜索域)
+func builtinDNSServers(address string) string {
+	prefixes, _ := wgserver.ParseServerAddress(address)
+	items := make([]string, 0, len(prefixes)+1)
+	for _, prefix := range prefixes {
+		items = append(items, prefix.Addr().String())
+	}
+	if domain := dnsserver.Default().Domain(); domain != "" {
+		items = append(items, domain)
+	}
+	return strings.Join(items, ", ")
+}
+
+// GetDNS 获取接口的内置 DNS 状态与当前的客户端解析记录
+func GetDNS(ctx context.Context, iface int) (*wireguard.DNSRes, error) {
+	config, err := GetConfig(ctx, iface)
+	if err != nil {
+		return nil, err
+	}
+	server := dnsserver.Default()
+	stats := server.Stats()
+	res := &wireguard.DNSRes{
+		Enabled:  config.BuiltinDNS,
+		Listen:   wgserver.GetServer(iface).DNSListenAddrs(),
+		Domain:   server.Domain(),
+		Upstream: server.Upstream(),
+		Stats: wireguard.DNSStats{
+			Queries:   stats.Queries,
+			Local:     stats.Local,
+			Blocked:   stats.Blocked,
+			Forwarded: stats.Forwarded,
+			Failed:    stats.Failed,
+		},
+		Records: make([]*wireguard.DNSRecord, 0),
+	}
+	for _, r := range server.Records(ctx) {
+		record := &wireguard.DNSRecord{Name: r.Name, Source: r.Source}
+		for _, addr := range r.Addrs {
+			record.Addrs = append(record.Addrs, addr.String())
+		}
+		res.Records = append(res.Records, record)
+	}
+	return res, nil
+}
@@ -0,0 +1,258 @@
+// ==========================================================================
+// OmniWire - UAPI 配置漂移处理
+// 开放 UAPI 套接字后，运维可能通过 wg set 直接修改设备；定期对比设备与数据库，
+// 按 wireguard.uapiDrift 配置仅记录漂移 (flag) 或将设备状态写回数据库 (reconcile)
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/model/entity"
+	"omniwire/internal/service/wgserver"
+)
+
+// 漂移处理方式
+const (
+	DriftFlag      = "flag"      // 仅记录，等待管理员处理
+	DriftReconcile = "reconcile" // 自动写回数据库
+)
+
+var (
+	driftMu      sync.Mutex
+	flaggedDrift = make(map[int]map[string]bool) // 各接口已记录的漂移 (类型 + 公钥)，避免重复写日志
+)
+
+// runDriftScheduler 定期检查 UAPI 配置漂移
+func runDriftScheduler(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, server := range wgserver.Servers() {
+				checkDrift(ctx, server)
+			}
+		}
+	}
+}
+
+// checkDrift 检测接口的漂移，reconcile 模式下写回数据库，flag 模式下记录新出现的漂移
+func checkDrift(ctx context.Context, server *wgserver.WireGuardServer) {
+	if !server.UAPIEnabled() {
+		return
+	}
+	drifts, err := server.DetectDrift()
+	if err != nil {
+		g.Log().Warningf(ctx, "[WireGuard] 检测配置漂移失败: %v", err)
+		return
+	}
+	if g.Cfg().MustGet(ctx, "wireguard.uapiDrift", DriftFlag).String() == DriftReconcile && len(drifts) > 0 {
+		reconcileDrifts(ctx, server.ID(), drifts)
+		return
+	}
+	flagDrifts(ctx, server, drifts)
+}
+
+// flagDrifts 记录新出现的漂移，drifts 为当前仍未处理的全部漂移
+func flagDrifts(ctx context.Context, server *wgserver.WireGuardServer, drifts []*wgserver.PeerDrift) {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	current := make(map[string]bool, len(drifts))
+	for _, d := range drifts {
+		key := d.Kind + ":" + d.PublicKey
+		current[key] = true
+		if flaggedDrift[server.ID()][key] {
+			continue
+		}
+		g.Log().Warningf(ctx, "[WireGuard] 检测到配置漂移 (%s): 客户端 %s %s, 设备 AllowedIPs: %s", d.Kind, d.Name, d.PublicKey, d.AllowedIPs)
+		server.LogPeerEvent(ctx, peerIDByKey(ctx, d.PublicKey), d.Name, d.PublicKey, "drift_"+d.Kind)
+	}
+	flaggedDrift[server.ID()] = current
+}
+
+// UAPIEnabled 接口的 UAPI 套接字是否已开放，接口不存在时返回 false
+func UAPIEnabled(ctx context.Context, iface int) bool {
+	if checkInterface(ctx, iface) != nil {
+		return false
+	}
+	return wgserver.GetServer(iface).UAPIEnabled()
+}
+
+// GetDrift 获取接口当前设备与数据库之间的差异
+func GetDrift(ctx context.Context, iface int) ([]*wireguard.DriftInfo, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+	drifts, err := wgserver.GetServer(iface).DetectDrift()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*wireguard.DriftInfo, 0, len(drifts))
+	for _, d := range drifts {
+		list = append(list, &wireguard.DriftInfo{
+			Kind:            d.Kind,
+			PublicKey:       d.PublicKey,
+			Name:            d.Name,
+			AllowedIPs:      d.AllowedIPs,
+			HasPresharedKey: d.PresharedKey != "",
+		})
+	}
+	return list, nil
+}
+
+// ReconcileDrift 立即将接口设备上的修改写回数据库，返回处理的漂移数量
+func ReconcileDrift(ctx context.Context, iface int) (int, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return 0, err
+	}
+	server := wgserver.GetServer(iface)
+	if !server.IsRunning() {
+		return 0, fmt.Errorf("WireGuard 服务未运行")
+	}
+	drifts, err := server.DetectDrift()
+	if err != nil {
+		return 0, err
+	}
+	return reconcileDrifts(ctx, iface, drifts), nil
+}
+
+// reconcileDrifts 以设备实际状态为准更新数据库，未通过校验的漂移保留为已记录状态等待管理员处理
+func reconcileDrifts(ctx context.Context, iface int, drifts []*wgserver.PeerDrift) int {
+	serverConfig, err := GetConfig(ctx, iface)
+	if err != nil {
+		return 0
+	}
+	serverPrefixes, _ := wgserver.ParseServerAddress(serverConfig.Address)
+
+	count := 0
+	var failed []*wgserver.PeerDrift
+	for _, d := range drifts {
+		if err := reconcileDrift(ctx, iface, d, serverPrefixes); err != nil {
+			// 同一漂移只在首次失败时记录，避免每轮检查重复输出
+			driftMu.Lock()
+			flagged := flaggedDrift[iface][d.Kind+":"+d.PublicKey]
+			driftMu.Unlock()
+			if !flagged {
+				g.Log().Warningf(ctx, "[WireGuard] 同步漂移 (%s) %s 失败: %v", d.Kind, d.PublicKey, err)
+			}
+			failed = append(failed, d)
+			continue
+		}
+		count++
+	}
+	flagDrifts(ctx, wgserver.GetServer(iface), failed)
+	return count
+}
+
+func reconcileDrift(ctx context.Context, iface int, d *wgserver.PeerDrift, serverPrefixes []netip.Prefix) error {
+	server := wgserver.GetServer(iface)
+
+	var peer *entity.WireguardPeer
+	if err := g.DB().Model("wireguard_peer").Where("public_key", d.PublicKey).Scan(&peer); err != nil {
+		return err
+	}
+
+	// 设备上被 wg set ... remove 删除的客户端：在数据库中禁用
+	if d.Kind == wgserver.DriftMissing {
+		if peer == nil {
+			return nil
+		}
+		if _, err := g.DB().Model("wireguard_peer").Where("id", peer.Id).
+			Data(g.Map{"enabled": 0, "updated_at": gtime.Now()}).Update(); err != nil {
+			return err
+		}
+		server.LogPeerEvent(ctx, peer.Id, peer.Name, peer.PublicKey, "drift_reconciled")
+		return server.DisablePeer(peer.PublicKey)
+	}
+
+	addrs, routed, err := splitPeerAllowedIPs(d.AllowedIPs, serverPrefixes)
+	if err != nil {
+		return err
+	}
+	// 与在 OmniWire 中创建 / 修改客户端执行相同的校验
+	excludeID := 0
+	if peer != nil {
+		excludeID = peer.Id
+	}
+	if addrs == "" {
+		return fmt.Errorf("设备上的 AllowedIPs (%s) 不含接口网段内的客户端地址", d.AllowedIPs)
+	}
+	if err := checkPeerAddress(ctx, iface, addrs, excludeID); err != nil {
+		return err
+	}
+	if routed, err = checkRoutedNetworks(ctx, routed, excludeID); err != nil {
+		return err
+	}
+
+	// 通过 wg set 新增的客户端：作为外部客户端写入数据库
+	if peer == nil {
+		peer = &entity.WireguardPeer{
+			Name:           "wg-" + d.PublicKey[:8],
+			PublicKey:      d.PublicKey,
+			PresharedKey:   d.PresharedKey,
+			AllowedIps:     addrs,
+			RoutedNetworks: routed,
+			External:       1,
+			Keepalive:      -1,
+			QuotaResetDay:  1,
+			QuotaAction:    QuotaActionDisable,
+			Enabled:        1,
+			InterfaceId:    iface,
+			CreatedAt:      gtime.Now(),
+			UpdatedAt:      gtime.Now(),
+		}
+		res, err := g.DB().Model("wireguard_peer").FieldsEx("id").Insert(peer)
+		if err != nil {
+			return err
+		}
+		id, _ := res.LastInsertId()
+		peer.Id = int(id)
+	} else {
+		// 与在 OmniWire 中启用客户端相同：已到期或本周期仍超额的客户端不允许经设备重新启用
+		if peer.ExpiresAt != nil && peer.ExpiresAt.Before(gtime.Now()) {
+			return fmt.Errorf("客户端已于 %s 到期", peer.ExpiresAt)
+		}
+		data := g.Map{
+			"enabled":         1,
+			"allowed_ips":     addrs,
+			"routed_networks": routed,
+			"preshared_key":   d.PresharedKey,
+			"updated_at":      gtime.Now(),
+		}
+		if peer.Enabled == 0 {
+			if err := checkQuotaEnable(peer, data); err != nil {
+				return err
+			}
+		}
+		peer.Enabled = 1
+		peer.AllowedIps = addrs
+		peer.RoutedNetworks = routed
+		peer.PresharedKey = d.PresharedKey
+		if _, err := g.DB().Model("wireguard_peer").Where("id", peer.Id).Data(data).Update(); err != nil {
+			return err
+		}
+	}
+
+	server.LogPeerEvent(ctx, peer.Id, peer.Name, peer.PublicKey, "drift_reconciled")
+	g.Log().Infof(ctx, "[WireGuard] 已将设备上的修改 (%s) 同步到客户端 %s", d.Kind, peer.Name)
+	// 内存记录与设备保持一致，重新下发的内容与设备当前状态相同
+	return server.AddPeer(runtimePeer(peer))
+}
+
+// peerIDByKey 根据公钥查询客户端 ID，不存在时返回 0
+func peerIDByKey(ctx context.Context, publicKey string) int {
+	id, _ := g.DB().Model("wireguard_peer").Where("public_key", publicKey).Value("id")
+	return id.Int()
+}
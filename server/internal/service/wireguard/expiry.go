@@ -0,0 +1,75 @@
+// ==========================================================================
+// OmniWire - WireGuard 客户端到期自动禁用 (临时访问)
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+
+	"omniwire/internal/model/entity"
+)
+
+// runPeerExpiryScheduler 定期禁用已到期的客户端
+func runPeerExpiryScheduler(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expirePeers(ctx)
+		}
+	}
+}
+
+// expirePeers 禁用所有已到期但仍启用的客户端，并写入 expired 连接日志
+func expirePeers(ctx context.Context) {
+	var peers []entity.WireguardPeer
+	err := g.DB().Model("wireguard_peer").
+		Where("enabled", 1).WhereNotNull("expires_at").WhereLTE("expires_at", gtime.Now()).
+		Scan(&peers)
+	if err != nil {
+		g.Log().Warningf(ctx, "[WireGuard] 查询到期客户端失败: %v", err)
+		return
+	}
+
+	for _, peer := range peers {
+		if _, err := g.DB().Model("wireguard_peer").Where("id", peer.Id).
+			Data(g.Map{"enabled": 0, "updated_at": gtime.Now()}).Update(); err != nil {
+			g.Log().Warningf(ctx, "[WireGuard] 禁用到期客户端 %s 失败: %v", peer.Name, err)
+			continue
+		}
+		// 先记录日志再移除，日志中保留到期时的 Endpoint 与流量
+		server := peerServer(&peer)
+		server.LogPeerEvent(ctx, peer.Id, peer.Name, peer.PublicKey, "expired")
+		server.DisablePeer(peer.PublicKey)
+		g.Log().Infof(ctx, "[WireGuard] 客户端 %s 已于 %s 到期，已自动禁用", peer.Name, peer.ExpiresAt)
+	}
+}
+
+// parseExpiresAt 解析到期时间，空字符串表示永不过期
+func parseExpiresAt(s string) (*gtime.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := gtime.StrToTime(s)
+	if err != nil {
+		return nil, fmt.Errorf("到期时间格式错误: %s", s)
+	}
+	return t, nil
+}
+
+// RemainingSeconds 剩余有效期 (秒)，-1 表示永不过期，0 表示已到期
+func RemainingSeconds(expiresAt *gtime.Time) int64 {
+	if expiresAt == nil || expiresAt.IsZero() {
+		return -1
+	}
+	return max(int64(time.Until(expiresAt.Time).Seconds()), 0)
+}
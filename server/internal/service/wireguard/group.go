@@ -0,0 +1,309 @@
+// ==========================================================================
+// OmniWire - WireGuard 客户端分组与标签
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/model/entity"
+	"omniwire/internal/service/ipam"
+	"omniwire/internal/service/wgserver"
+)
+
+// 分组批量操作
+const (
+	BatchEnable  = "enable"
+	BatchDisable = "disable"
+	BatchDelete  = "delete"
+)
+
+// GroupInput 分组输入
+type GroupInput struct {
+	Name             string
+	Description      string
+	ClientAllowedIPs string
+	DNS              string
+	UploadLimit      int64
+	DownloadLimit    int64
+}
+
+// GetGroups 获取分组列表，分组在各接口间共享，成员数量只统计指定接口下的客户端
+func GetGroups(ctx context.Context, iface int) ([]*wireguard.PeerGroupInfo, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+	var groups []*entity.WireguardPeerGroup
+	if err := g.DB().Model("wireguard_peer_group").OrderAsc("name").Scan(&groups); err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		GroupId int
+		Total   int
+	}
+	_ = g.DB().Model("wireguard_peer").Fields("group_id, COUNT(*) AS total").Where("interface_id", iface).Group("group_id").Scan(&counts)
+	countMap := make(map[int]int, len(counts))
+	for _, c := range counts {
+		countMap[c.GroupId] = c.Total
+	}
+
+	list := make([]*wireguard.PeerGroupInfo, 0, len(groups))
+	for _, group := range groups {
+		info := groupInfo(group)
+		info.PeerCount = countMap[group.Id]
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// CreateGroup 创建分组
+func CreateGroup(ctx context.Context, input *GroupInput) (*wireguard.PeerGroupInfo, error) {
+	if err := checkGroupInput(ctx, input, 0); err != nil {
+		return nil, err
+	}
+	group := &entity.WireguardPeerGroup{
+		Name:             input.Name,
+		Description:      input.Description,
+		ClientAllowedIps: input.ClientAllowedIPs,
+		Dns:              input.DNS,
+		UploadLimit:      max(input.UploadLimit, 0),
+		DownloadLimit:    max(input.DownloadLimit, 0),
+		CreatedAt:        gtime.Now(),
+		UpdatedAt:        gtime.Now(),
+	}
+	res, err := g.DB().Model("wireguard_peer_group").FieldsEx("id").Insert(group)
+	if err != nil {
+		return nil, fmt.Errorf("保存分组失败: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	group.Id = int(id)
+	if err := syncGroupLimits(ctx); err != nil {
+		return nil, err
+	}
+
+	g.Log().Infof(ctx, "[WireGuard] 创建客户端分组: %s", group.Name)
+	return groupInfo(group), nil
+}
+
+// UpdateGroup 更新分组，限速立即作用于组内成员，AllowedIPs / DNS 在成员下次下载配置时生效
+func UpdateGroup(ctx context.Context, id int, input *GroupInput) error {
+	if _, err := getGroup(ctx, id); err != nil {
+		return err
+	}
+	if err := checkGroupInput(ctx, input, id); err != nil {
+		return err
+	}
+	_, err := g.DB().Model("wireguard_peer_group").Where("id", id).Data(g.Map{
+		"name":               input.Name,
+		"description":        input.Description,
+		"client_allowed_ips": input.ClientAllowedIPs,
+		"dns":                input.DNS,
+		"upload_limit":       max(input.UploadLimit, 0),
+		"download_limit":     max(input.DownloadLimit, 0),
+		"updated_at":         gtime.Now(),
+	}).Update()
+	if err != nil {
+		return fmt.Errorf("更新分组失败: %v", err)
+	}
+	return syncGroupLimits(ctx)
+}
+
+// DeleteGroup 删除分组，组内客户端移至未分组
+func DeleteGroup(ctx context.Context, id int) error {
+	group, err := getGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := g.DB().Model("wireguard_peer").Where("group_id", id).Data(g.Map{"group_id": 0}).Update(); err != nil {
+		return fmt.Errorf("移出分组成员失败: %v", err)
+	}
+	if _, err := g.DB().Model("wireguard_peer_group").Where("id", id).Delete(); err != nil {
+		return fmt.Errorf("删除分组失败: %v", err)
+	}
+	// 原成员不再使用分组限速 (分组 ID 自增不复用)
+	if err := syncGroupLimits(ctx); err != nil {
+		return err
+	}
+	// 以该分组为来源的访问控制规则随之删除
+	ifaces, _ := g.DB().Model("wireguard_acl_rule").Where("source_group_id", id).Distinct().Array("interface_id")
+	if len(ifaces) > 0 {
+		_, _ = g.DB().Model("wireguard_acl_rule").Where("source_group_id", id).Delete()
+		for _, iface := range ifaces {
+			_ = loadACL(ctx, iface.Int())
+		}
+	}
+	g.Log().Infof(ctx, "[WireGuard] 删除客户端分组: %s", group.Name)
+	return nil
+}
+
+// BatchGroupPeers 按分组批量启用 / 禁用 / 删除接口下的客户端，groupId 为 0 时操作未分组的客户端
+func BatchGroupPeers(ctx context.Context, iface, groupId int, action string) (int, error) {
+	if groupId > 0 {
+		if _, err := getGroup(ctx, groupId); err != nil {
+			return 0, err
+		}
+	}
+	var peers []*entity.WireguardPeer
+	if err := g.DB().Model("wireguard_peer").Where("interface_id", iface).Where("group_id", groupId).Scan(&peers); err != nil {
+		return 0, err
+	}
+
+	affected := 0
+	for _, peer := range peers {
+		var err error
+		switch action {
+		case BatchEnable:
+			err = setPeerEnabled(ctx, peer, true)
+		case BatchDisable:
+			err = setPeerEnabled(ctx, peer, false)
+		case BatchDelete:
+			err = DeletePeer(ctx, iface, peer.Id)
+		default:
+			return affected, fmt.Errorf("不支持的批量操作: %s", action)
+		}
+		if err != nil {
+			g.Log().Warningf(ctx, "[WireGuard] 批量%s客户端 %s 失败: %v", action, peer.Name, err)
+			continue
+		}
+		affected++
+	}
+	g.Log().Infof(ctx, "[WireGuard] 接口 %d 分组 %d 批量 %s: %d/%d", iface, groupId, action, affected, len(peers))
+	return affected, nil
+}
+
+// setPeerEnabled 启用或禁用单个客户端并同步运行时，已到期的客户端不允许启用
+func setPeerEnabled(ctx context.Context, peer *entity.WireguardPeer, enabled bool) error {
+	if enabled && peer.ExpiresAt != nil && peer.ExpiresAt.Before(gtime.Now()) {
+		return fmt.Errorf("客户端已于 %s 到期", peer.ExpiresAt)
+	}
+	data := g.Map{"updated_at": gtime.Now()}
+	if enabled && peer.Enabled == 0 {
+		if err := checkQuotaEnable(peer, data); err != nil {
+			return err
+		}
+	}
+	peer.Enabled = 0
+	if enabled {
+		peer.Enabled = 1
+	}
+	data["enabled"] = peer.Enabled
+	if _, err := g.DB().Model("wireguard_peer").Where("id", peer.Id).Data(data).Update(); err != nil {
+		return err
+	}
+	server := peerServer(peer)
+	if enabled {
+		return server.EnablePeer(runtimePeer(peer))
+	}
+	return server.DisablePeer(peer.PublicKey)
+}
+
+// getGroup 获取分组，不存在时返回错误
+func getGroup(ctx context.Context, id int) (*entity.WireguardPeerGroup, error) {
+	var group *entity.WireguardPeerGroup
+	if err := g.DB().Model("wireguard_peer_group").Ctx(ctx).Where("id", id).Scan(&group); err != nil || group == nil {
+		return nil, fmt.Errorf("分组不存在")
+	}
+	return group, nil
+}
+
+// checkGroupInput 校验分组名称唯一与 AllowedIPs 格式
+func checkGroupInput(ctx context.Context, input *GroupInput, excludeID int) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return fmt.Errorf("分组名称必填")
+	}
+	count, _ := g.DB().Model("wireguard_peer_group").Where("name", input.Name).WhereNot("id", excludeID).Count()
+	if count > 0 {
+		return fmt.Errorf("分组 %s 已存在", input.Name)
+	}
+	if _, err := ipam.ParsePrefixes(input.ClientAllowedIPs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// applyGroupDefaults 组内客户端使用分组的 AllowedIPs / DNS 覆盖全局配置
+func applyGroupDefaults(ctx context.Context, config *ConfigOutput, groupId int) {
+	if groupId == 0 {
+		return
+	}
+	group, err := getGroup(ctx, groupId)
+	if err != nil {
+		return
+	}
+	if group.ClientAllowedIps != "" {
+		config.ClientAllowedIPs = group.ClientAllowedIps
+	}
+	if group.Dns != "" {
+		config.DNS = group.Dns
+	}
+}
+
+// groupLimits 读取设置了限速的分组
+func groupLimits(ctx context.Context) (map[int]wgserver.GroupLimit, error) {
+	var groups []*entity.WireguardPeerGroup
+	if err := g.DB().Model("wireguard_peer_group").Ctx(ctx).Scan(&groups); err != nil {
+		return nil, fmt.Errorf("加载分组限速失败: %v", err)
+	}
+	limits := make(map[int]wgserver.GroupLimit)
+	for _, group := range groups {
+		if group.UploadLimit > 0 || group.DownloadLimit > 0 {
+			limits[group.Id] = wgserver.GroupLimit{Upload: group.UploadLimit, Download: group.DownloadLimit}
+		}
+	}
+	return limits, nil
+}
+
+// syncGroupLimits 分组变更后将分组限速同步到所有接口
+func syncGroupLimits(ctx context.Context) error {
+	limits, err := groupLimits(ctx)
+	if err != nil {
+		return err
+	}
+	for _, server := range wgserver.Servers() {
+		server.SetGroupLimits(limits)
+	}
+	return nil
+}
+
+// escapeLike 转义 LIKE 模式中的通配符，配合 ESCAPE '\' 使用
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// normalizeTags 规范化标签：去除空白与重复项，保持原有顺序
+func normalizeTags(tags string) string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return strings.Join(result, ",")
+}
+
+func groupInfo(group *entity.WireguardPeerGroup) *wireguard.PeerGroupInfo {
+	return &wireguard.PeerGroupInfo{
+		Id:               group.Id,
+		Name:             group.Name,
+		Description:      group.Description,
+		ClientAllowedIPs: group.ClientAllowedIps,
+		DNS:              group.Dns,
+		UploadLimit:      group.UploadLimit,
+		DownloadLimit:    group.DownloadLimit,
+		CreatedAt:        group.CreatedAt.String(),
+		UpdatedAt:        group.UpdatedAt.String(),
+	}
+}
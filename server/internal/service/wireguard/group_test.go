@@ -0,0 +1,145 @@
+package wireguard_test
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/gogf/gf/contrib/drivers/sqlite/v2"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+
+	"omniwire/internal/cmd"
+	"omniwire/internal/service/wgserver"
+	svcWireguard "omniwire/internal/service/wireguard"
+)
+
+func initTestDB(t *testing.T) context.Context {
+	t.Helper()
+	ctx := context.Background()
+	gdb.SetConfig(gdb.Config{"default": gdb.ConfigGroup{{Type: "sqlite", Link: "sqlite::@file(" + t.TempDir() + "/omniwire.db)"}}})
+	if err := cmd.InitDatabase(ctx); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	return ctx
+}
+
+func createTestPeer(t *testing.T, ctx context.Context, name string, groupId int, tags string) int {
+	t.Helper()
+	peer, err := svcWireguard.CreatePeer(ctx, wgserver.DefaultInterface, &svcWireguard.PeerInput{Name: name, GroupId: &groupId, Tags: &tags})
+	if err != nil {
+		t.Fatalf("create peer %s: %v", name, err)
+	}
+	return peer.Id
+}
+
+func TestGetPeersTagFilterEscapesWildcards(t *testing.T) {
+	ctx := initTestDB(t)
+	createTestPeer(t, ctx, "alice", 0, "ops,100%")
+	createTestPeer(t, ctx, "bob", 0, "dev_team")
+	createTestPeer(t, ctx, "carol", 0, "devXteam, 1000")
+
+	for tag, want := range map[string]string{"ops": "alice", "100%": "alice", "dev_team": "bob", "1000": "carol"} {
+		peers, err := svcWireguard.GetPeers(ctx, wgserver.DefaultInterface, -1, tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(peers) != 1 || peers[0].Name != want {
+			names := make([]string, 0, len(peers))
+			for _, p := range peers {
+				names = append(names, p.Name)
+			}
+			t.Errorf("tag %q matched %v, want [%s]", tag, names, want)
+		}
+	}
+}
+
+func TestBatchGroupPeers(t *testing.T) {
+	ctx := initTestDB(t)
+	group, err := svcWireguard.CreateGroup(ctx, &svcWireguard.GroupInput{Name: "staff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestPeer(t, ctx, "alice", group.Id, "")
+	createTestPeer(t, ctx, "bob", group.Id, "")
+	outsider := createTestPeer(t, ctx, "carol", 0, "")
+
+	enabledCount := func(groupId int) int {
+		n, err := g.DB().Model("wireguard_peer").Where("group_id", groupId).Where("enabled", 1).Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if n, err := svcWireguard.BatchGroupPeers(ctx, wgserver.DefaultInterface, group.Id, svcWireguard.BatchDisable); err != nil || n != 2 {
+		t.Fatalf("batch disable = %d, %v", n, err)
+	}
+	if enabledCount(group.Id) != 0 || enabledCount(0) != 1 {
+		t.Fatal("batch disable should only affect group members")
+	}
+	if n, err := svcWireguard.BatchGroupPeers(ctx, wgserver.DefaultInterface, group.Id, svcWireguard.BatchEnable); err != nil || n != 2 {
+		t.Fatalf("batch enable = %d, %v", n, err)
+	}
+	if enabledCount(group.Id) != 2 {
+		t.Fatal("batch enable should re-enable group members")
+	}
+	if _, err := svcWireguard.BatchGroupPeers(ctx, wgserver.DefaultInterface, group.Id, "rename"); err == nil {
+		t.Fatal("unsupported action should fail")
+	}
+	if _, err := svcWireguard.BatchGroupPeers(ctx, wgserver.DefaultInterface, group.Id+100, svcWireguard.BatchDelete); err == nil {
+		t.Fatal("unknown group should fail")
+	}
+	if n, err := svcWireguard.BatchGroupPeers(ctx, wgserver.DefaultInterface, group.Id, svcWireguard.BatchDelete); err != nil || n != 2 {
+		t.Fatalf("batch delete = %d, %v", n, err)
+	}
+	ids, _ := g.DB().Model("wireguard_peer").Array("id")
+	if len(ids) != 1 || ids[0].Int() != outsider {
+		t.Fatalf("remaining peers = %v, want [%d]", ids, outsider)
+	}
+}
+
+func TestGetGroupsCountsInterfacePeers(t *testing.T) {
+	ctx := initTestDB(t)
+	group, err := svcWireguard.CreateGroup(ctx, &svcWireguard.GroupInput{Name: "staff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestPeer(t, ctx, "alice", group.Id, "")
+	bob := createTestPeer(t, ctx, "bob", group.Id, "")
+	if _, err := g.DB().Model("wireguard_peer").Where("id", bob).Data(g.Map{"interface_id": 99}).Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := svcWireguard.GetGroups(ctx, wgserver.DefaultInterface)
+	if err != nil || len(groups) != 1 || groups[0].PeerCount != 1 {
+		t.Fatalf("GetGroups = %+v, %v, want 1 peer", groups, err)
+	}
+	if _, err := svcWireguard.GetGroups(ctx, 99); err == nil {
+		t.Fatal("unknown interface should fail")
+	}
+}
+
+func TestGroupLimitsNotCopiedToPeers(t *testing.T) {
+	ctx := initTestDB(t)
+	group, err := svcWireguard.CreateGroup(ctx, &svcWireguard.GroupInput{Name: "limited", UploadLimit: 1000, DownloadLimit: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := createTestPeer(t, ctx, "alice", group.Id, "")
+	limits, _ := g.DB().Model("wireguard_peer").Where("id", id).Fields("upload_limit, download_limit").One()
+	if limits["upload_limit"].Int64() != 0 || limits["download_limit"].Int64() != 0 {
+		t.Fatalf("group limits copied into peer: %v", limits)
+	}
+}
+
+func TestCreatePeerRejectsAddressOutsideSubnet(t *testing.T) {
+	ctx := initTestDB(t)
+	for _, addr := range []string{"10.77.0.2/32", "not-an-address"} {
+		if _, err := svcWireguard.CreatePeer(ctx, wgserver.DefaultInterface, &svcWireguard.PeerInput{Name: "outside", AllowedIPs: addr}); err == nil {
+			t.Errorf("address %q accepted", addr)
+		}
+	}
+	if _, err := svcWireguard.CreatePeer(ctx, wgserver.DefaultInterface, &svcWireguard.PeerInput{Name: "inside", AllowedIPs: "10.66.66.20/32"}); err != nil {
+		t.Fatalf("address inside subnet rejected: %v", err)
+	}
+}
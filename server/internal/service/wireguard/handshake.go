@@ -0,0 +1,62 @@
+// ==========================================================================
+// OmniWire - WireGuard 握手诊断
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/service/wgserver"
+)
+
+// rejectHints 握手被拒绝原因的说明
+var rejectHints = map[string]string{
+	wgserver.RejectWrongServerKey: "客户端配置的服务端公钥不正确，可能是服务端密钥轮换后客户端未更新配置",
+	wgserver.RejectInvalid:        "握手包无法解密，可能被篡改或不是 WireGuard 客户端",
+	wgserver.RejectUnknownPeer:    "客户端公钥不属于该接口，可能客户端已被删除或连接到了错误的接口",
+	wgserver.RejectDisabledPeer:   "客户端已被禁用 (手动禁用、过期或流量超额)",
+	wgserver.RejectStaleTimestamp: "握手时间戳早于上一次握手，客户端系统时间可能被回拨，校准时间后重连",
+}
+
+// HandshakeDiagEnabled 接口是否正在记录被拒绝的握手
+func HandshakeDiagEnabled(iface int) bool {
+	return wgserver.GetServer(iface).HandshakeDiagEnabled()
+}
+
+// GetRejectedHandshakes 获取接口最近被拒绝的握手 (仅保存在内存中，重启程序后清空)
+func GetRejectedHandshakes(ctx context.Context, iface int) ([]*wireguard.RejectedHandshakeInfo, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+	rejects := wgserver.GetServer(iface).HandshakeRejects()
+	list := make([]*wireguard.RejectedHandshakeInfo, 0, len(rejects))
+	for _, r := range rejects {
+		info := &wireguard.RejectedHandshakeInfo{
+			Endpoint:  r.Endpoint,
+			PublicKey: r.PublicKey,
+			PeerId:    r.PeerId,
+			PeerName:  r.PeerName,
+			Reason:    r.Reason,
+			Hint:      rejectHints[r.Reason],
+			Count:     r.Count,
+			FirstSeen: r.FirstSeen.Format("2006-01-02 15:04:05"),
+			LastSeen:  r.LastSeen.Format("2006-01-02 15:04:05"),
+		}
+		if !r.ClientTime.IsZero() {
+			info.ClientTime = r.ClientTime.Format("2006-01-02 15:04:05")
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// ClearRejectedHandshakes 清空接口被拒绝的握手记录
+func ClearRejectedHandshakes(ctx context.Context, iface int) error {
+	if err := checkInterface(ctx, iface); err != nil {
+		return err
+	}
+	wgserver.GetServer(iface).ClearHandshakeRejects()
+	return nil
+}
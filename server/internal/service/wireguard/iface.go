@@ -0,0 +1,237 @@
+// ==========================================================================
+// OmniWire - WireGuard 多接口管理
+// 每个接口对应 wireguard_config 中的一行 (id 即接口 ID)，拥有独立的端口、网段、
+// 密钥与客户端；旧版本的单接口配置为默认接口 (id=1)，不可删除
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/model/entity"
+	"omniwire/internal/service/ipam"
+	"omniwire/internal/service/wgserver"
+)
+
+// interfaceNamePattern 网卡名称：Linux 限制为 15 个字符
+var interfaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+
+// InterfaceInput 新建接口输入
+type InterfaceInput struct {
+	Name            string
+	ListenPort      int
+	Address         string
+	DNS             string
+	EndpointAddress string
+	Mode            string
+}
+
+// GetInterfaces 获取所有接口及其运行状态
+func GetInterfaces(ctx context.Context) ([]*wireguard.InterfaceInfo, error) {
+	var configs []struct {
+		Id            int
+		InterfaceName string
+		ListenPort    int
+		PublicKey     string
+		Address       string
+		Mode          string
+		AutoStart     int
+	}
+	if err := g.DB().Model("wireguard_config").OrderAsc("id").Scan(&configs); err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		InterfaceId int
+		Total       int
+	}
+	_ = g.DB().Model("wireguard_peer").Fields("interface_id, COUNT(*) AS total").Group("interface_id").Scan(&counts)
+	countMap := make(map[int]int, len(counts))
+	for _, c := range counts {
+		countMap[c.InterfaceId] = c.Total
+	}
+
+	list := make([]*wireguard.InterfaceInfo, 0, len(configs))
+	for _, c := range configs {
+		mode := c.Mode
+		if mode == "" {
+			mode = wgserver.ModeTUN
+		}
+		list = append(list, &wireguard.InterfaceInfo{
+			Id:         c.Id,
+			Name:       c.InterfaceName,
+			ListenPort: c.ListenPort,
+			PublicKey:  c.PublicKey,
+			Address:    c.Address,
+			Mode:       mode,
+			AutoStart:  c.AutoStart == 1,
+			Running:    wgserver.GetServer(c.Id).IsRunning(),
+			PeerCount:  countMap[c.Id],
+		})
+	}
+	return list, nil
+}
+
+// CreateInterface 新建接口，生成独立的服务端密钥，其余配置使用默认值
+func CreateInterface(ctx context.Context, input *InterfaceInput) (int, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if !interfaceNamePattern.MatchString(input.Name) {
+		return 0, fmt.Errorf("接口名称只能包含字母、数字、下划线、点和连字符，且不超过 15 个字符")
+	}
+	if input.ListenPort < 1 || input.ListenPort > 65535 {
+		return 0, fmt.Errorf("监听端口无效: %d", input.ListenPort)
+	}
+	mode := input.Mode
+	if mode == "" {
+		mode = wgserver.ModeTUN
+	}
+	if mode != wgserver.ModeTUN && mode != wgserver.ModeNetstack {
+		return 0, fmt.Errorf("不支持的运行模式: %s", mode)
+	}
+	prefixes, err := wgserver.ParseServerAddress(input.Address)
+	if err != nil {
+		return 0, err
+	}
+	if err := ipam.CheckOverlap(ctx, ipam.ServiceWireGuard, prefixes); err != nil {
+		return 0, err
+	}
+	if err := checkInterfaceConflict(ctx, 0, input.Name, input.ListenPort, prefixes); err != nil {
+		return 0, err
+	}
+
+	privateKey, publicKey, err := wgserver.GenerateKeyPair()
+	if err != nil {
+		return 0, fmt.Errorf("生成密钥失败: %v", err)
+	}
+	dns := input.DNS
+	if dns == "" {
+		dns = g.Cfg().MustGet(ctx, "wireguard.dns", "223.5.5.5").String()
+	}
+	// 内置代理默认关闭，避免与其他 netstack 接口的代理端口冲突
+	res, err := g.DB().Model("wireguard_config").Data(g.Map{
+		"interface_name":       input.Name,
+		"listen_port":          input.ListenPort,
+		"private_key":          privateKey,
+		"public_key":           publicKey,
+		"address":              input.Address,
+		"dns":                  dns,
+		"mtu":                  g.Cfg().MustGet(ctx, "wireguard.mtu", 1420).Int(),
+		"endpoint_address":     input.EndpointAddress,
+		"eth_device":           "",
+		"persistent_keepalive": 25,
+		"client_allowed_ips":   "0.0.0.0/0, ::/0",
+		"proxy_address":        "",
+		"log_level":            "error",
+		"auto_start":           0,
+		"mode":                 mode,
+		"uapi":                 0,
+		"created_at":           gtime.Now(),
+		"updated_at":           gtime.Now(),
+	}).Insert()
+	if err != nil {
+		return 0, fmt.Errorf("保存接口失败: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	g.Log().Infof(ctx, "[WireGuard] 新建接口: %s (端口 %d, 网段 %s)", input.Name, input.ListenPort, input.Address)
+	return int(id), nil
+}
+
+// DeleteInterface 删除接口，默认接口不可删除，接口下仍有客户端时需先删除或迁移
+func DeleteInterface(ctx context.Context, iface int) error {
+	if iface == wgserver.DefaultInterface {
+		return fmt.Errorf("默认接口不可删除")
+	}
+	if err := checkInterface(ctx, iface); err != nil {
+		return err
+	}
+	if count, _ := g.DB().Model("wireguard_peer").Where("interface_id", iface).Count(); count > 0 {
+		return fmt.Errorf("接口下仍有 %d 个客户端，请先删除", count)
+	}
+
+	wgserver.RemoveServer(iface)
+	if _, err := g.DB().Model("wireguard_config").Where("id", iface).Delete(); err != nil {
+		return fmt.Errorf("删除接口失败: %v", err)
+	}
+	_, _ = g.DB().Model("wireguard_acl_rule").Where("interface_id", iface).Delete()
+	// 待切换的密钥轮换随接口失效，已完成的记录保留用于审计
+	_, _ = g.DB().Model("wireguard_key_rotation").Where("interface_id", iface).Where("status", RotationPending).
+		Data(g.Map{"status": RotationCancelled, "completed_at": gtime.Now()}).Update()
+	g.Log().Infof(ctx, "[WireGuard] 删除接口 %d", iface)
+	return nil
+}
+
+// checkInterface 检查接口是否存在，默认接口始终存在
+func checkInterface(ctx context.Context, iface int) error {
+	if iface == wgserver.DefaultInterface {
+		return nil
+	}
+	count, err := g.DB().Model("wireguard_config").Ctx(ctx).Where("id", iface).Count()
+	if err != nil || count == 0 {
+		return fmt.Errorf("接口不存在")
+	}
+	return nil
+}
+
+// checkInterfaceConflict 检查接口名称、监听端口与网段是否与其他接口冲突，name 为空时不检查名称
+func checkInterfaceConflict(ctx context.Context, iface int, name string, listenPort int, prefixes []netip.Prefix) error {
+	var others []struct {
+		Id            int
+		InterfaceName string
+		ListenPort    int
+		Address       string
+	}
+	if err := g.DB().Model("wireguard_config").Ctx(ctx).WhereNot("id", iface).Scan(&others); err != nil {
+		return nil
+	}
+	for _, o := range others {
+		if name != "" && o.InterfaceName == name {
+			return fmt.Errorf("接口名称 %s 已存在", name)
+		}
+		if o.ListenPort == listenPort {
+			return fmt.Errorf("监听端口 %d 已被接口 %s 使用", listenPort, o.InterfaceName)
+		}
+		subnets, _ := ipam.ParsePrefixes(o.Address)
+		if x, y, ok := ipam.Overlap(prefixes, subnets); ok {
+			return fmt.Errorf("网段 %s 与接口 %s 的网段 %s 冲突", x.Masked(), o.InterfaceName, y.Masked())
+		}
+	}
+	return nil
+}
+
+// otherInterfaceSubnets 除指定接口外其他接口的网段
+func otherInterfaceSubnets(ctx context.Context, iface int) []netip.Prefix {
+	values, err := g.DB().Model("wireguard_config").Ctx(ctx).WhereNot("id", iface).WhereNot("address", "").Array("address")
+	if err != nil {
+		return nil
+	}
+	var prefixes []netip.Prefix
+	for _, v := range values {
+		parsed, _ := ipam.ParsePrefixes(v.String())
+		prefixes = append(prefixes, parsed...)
+	}
+	return prefixes
+}
+
+// getPeer 获取接口下的客户端，不存在或属于其他接口时返回错误
+func getPeer(ctx context.Context, iface, id int) (*entity.WireguardPeer, error) {
+	var peer *entity.WireguardPeer
+	err := g.DB().Model("wireguard_peer").Ctx(ctx).Where("id", id).Where("interface_id", iface).Scan(&peer)
+	if err != nil || peer == nil {
+		return nil, fmt.Errorf("客户端不存在")
+	}
+	return peer, nil
+}
+
+// peerServer 客户端所属接口的服务端实例
+func peerServer(peer *entity.WireguardPeer) *wgserver.WireGuardServer {
+	return wgserver.GetServer(peer.InterfaceId)
+}
@@ -0,0 +1,375 @@
+// ==========================================================================
+// OmniWire - 导入 wg-quick 配置 (/etc/wireguard/wg0.conf)
+// [Interface] 写入 wireguard_config，每个 [Peer] 写入 wireguard_peer；
+// 服务端配置中没有客户端私钥，未提供对应客户端配置的 Peer 标记为外部客户端
+// ==========================================================================
+
+package wireguard
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+
+	"omniwire/internal/model/entity"
+	"omniwire/internal/service/ipam"
+	"omniwire/internal/service/wgserver"
+)
+
+// wgQuickConfig wg-quick 配置文件内容
+type wgQuickConfig struct {
+	PrivateKey string
+	Address    string
+	DNS        string
+	ListenPort int
+	MTU        int
+	Peers      []*wgQuickPeer
+}
+
+// wgQuickPeer wg-quick 配置中的 [Peer]
+type wgQuickPeer struct {
+	Name         string // 取自 [Peer] 上方或段内的注释
+	PublicKey    string
+	PresharedKey string
+	AllowedIPs   string
+	Endpoint     string
+	Keepalive    int // 未设置时为 -1
+}
+
+// ImportInput 导入输入
+type ImportInput struct {
+	Config  string   // 服务端 wg-quick 配置内容
+	Clients []string // 可选：客户端配置内容，用于找回对应 Peer 的私钥
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Imported int      // 导入的客户端数量
+	External int      // 其中无私钥的外部客户端数量
+	Skipped  int      // 公钥已存在而跳过的数量
+	Warnings []string // 需要管理员关注的问题
+}
+
+// parseWgQuick 解析 wg-quick 配置，忽略 Table 等 OmniWire 不使用的字段；PostUp / PostDown 需在接口配置中单独确认后填写
+func parseWgQuick(data string) (*wgQuickConfig, error) {
+	config := &wgQuickConfig{}
+	var (
+		section string
+		peer    *wgQuickPeer
+		comment string // 紧邻 [Peer] 上方的注释，作为客户端名称
+	)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			comment = ""
+			continue
+		}
+		if strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			name := commentName(text)
+			if peer != nil && peer.Name == "" && peer.PublicKey == "" {
+				peer.Name = name
+			} else {
+				comment = name
+			}
+			continue
+		}
+		// 行尾注释与 wg-quick 一致按 # 截断
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section = strings.ToLower(strings.TrimSpace(text[1 : len(text)-1]))
+			switch section {
+			case "interface":
+				peer = nil
+			case "peer":
+				peer = &wgQuickPeer{Name: comment, Keepalive: -1}
+				config.Peers = append(config.Peers, peer)
+			default:
+				return nil, fmt.Errorf("第 %d 行: 未知的配置段 %s", line, text)
+			}
+			comment = ""
+			continue
+		}
+		comment = ""
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("第 %d 行: 格式错误: %s", line, text)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		var err error
+		switch section {
+		case "interface":
+			switch key {
+			case "privatekey":
+				config.PrivateKey = value
+			case "address":
+				config.Address = joinList(config.Address, value)
+			case "dns":
+				config.DNS = joinList(config.DNS, value)
+			case "listenport":
+				config.ListenPort, err = strconv.Atoi(value)
+			case "mtu":
+				config.MTU, err = strconv.Atoi(value)
+			}
+		case "peer":
+			switch key {
+			case "publickey":
+				peer.PublicKey = value
+			case "presharedkey":
+				peer.PresharedKey = value
+			case "allowedips":
+				peer.AllowedIPs = joinList(peer.AllowedIPs, value)
+			case "endpoint":
+				peer.Endpoint = value
+			case "persistentkeepalive":
+				if strings.EqualFold(value, "off") {
+					peer.Keepalive = 0
+				} else {
+					peer.Keepalive, err = strconv.Atoi(value)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("第 %d 行: 字段 %s 不在任何配置段内", line, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %s 的值无效: %s", line, key, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, p := range config.Peers {
+		if p.PublicKey == "" {
+			return nil, fmt.Errorf("第 %d 个 [Peer] 缺少 PublicKey", i+1)
+		}
+	}
+	return config, nil
+}
+
+// commentName 从注释中提取名称，支持 "# alice" 与 "# Name = alice" 两种写法
+func commentName(text string) string {
+	text = strings.TrimSpace(strings.TrimLeft(text, "#; "))
+	if key, value, ok := strings.Cut(text, "="); ok {
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "name", "friendly_name", "client":
+			return strings.TrimSpace(value)
+		}
+	}
+	if key, value, ok := strings.Cut(text, ":"); ok && strings.EqualFold(strings.TrimSpace(key), "client") {
+		return strings.TrimSpace(value)
+	}
+	return text
+}
+
+func joinList(list, value string) string {
+	if list == "" {
+		return value
+	}
+	return list + ", " + value
+}
+
+// splitPeerAllowedIPs 将服务端 Peer 的 AllowedIPs 拆分为客户端地址 (位于服务端网段内的单个地址)
+// 与其后方的路由网段
+func splitPeerAllowedIPs(allowedIPs string, serverPrefixes []netip.Prefix) (addrs, routed string, err error) {
+	prefixes, err := ipam.ParsePrefixes(allowedIPs)
+	if err != nil {
+		return "", "", err
+	}
+	var addrList, routedList []string
+	for _, prefix := range prefixes {
+		if prefix.IsSingleIP() && prefixCovered(serverPrefixes, prefix) {
+			addrList = append(addrList, prefix.String())
+		} else {
+			routedList = append(routedList, prefix.Masked().String())
+		}
+	}
+	return strings.Join(addrList, ", "), strings.Join(routedList, ", "), nil
+}
+
+// ImportWgQuick 将 wg-quick 配置导入到接口，全部在一个事务中完成
+// 已存在相同公钥的客户端会被跳过，不覆盖 OmniWire 中已有的设置
+func ImportWgQuick(ctx context.Context, iface int, input *ImportInput) (*ImportResult, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+	config, err := parseWgQuick(input.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// 客户端配置：公钥 -> 私钥
+	privateKeys := make(map[string]string)
+	for i, content := range input.Clients {
+		client, err := parseWgQuick(content)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个客户端配置: %v", i+1, err)
+		}
+		publicKey, err := wgserver.PublicKeyFromPrivate(client.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个客户端配置: 私钥无效", i+1)
+		}
+		privateKeys[publicKey] = client.PrivateKey
+	}
+
+	// 服务端接口
+	ifaceData := g.Map{"updated_at": gtime.Now()}
+	if config.PrivateKey != "" {
+		publicKey, err := wgserver.PublicKeyFromPrivate(config.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("[Interface] PrivateKey 无效")
+		}
+		ifaceData["private_key"] = config.PrivateKey
+		ifaceData["public_key"] = publicKey
+	}
+	address := config.Address
+	if address != "" {
+		ifaceData["address"] = address
+	}
+	current, err := GetConfig(ctx, iface)
+	if err != nil {
+		return nil, err
+	}
+	if address == "" {
+		address = current.Address
+	}
+	serverPrefixes, err := wgserver.ParseServerAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if err := ipam.CheckOverlap(ctx, ipam.ServiceWireGuard, serverPrefixes); err != nil {
+		return nil, err
+	}
+	listenPort := current.ListenPort
+	if config.ListenPort > 0 {
+		listenPort = config.ListenPort
+	}
+	if err := checkInterfaceConflict(ctx, iface, "", listenPort, serverPrefixes); err != nil {
+		return nil, err
+	}
+	if err := checkServerAddress(ctx, iface, serverPrefixes); err != nil {
+		return nil, err
+	}
+	if config.DNS != "" {
+		ifaceData["dns"] = config.DNS
+	}
+	if config.ListenPort > 0 {
+		ifaceData["listen_port"] = config.ListenPort
+	}
+	if config.MTU > 0 {
+		ifaceData["mtu"] = config.MTU
+	}
+
+	result := &ImportResult{}
+	var peers []*entity.WireguardPeer
+	err = g.DB().Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		if _, err := g.DB().Model("wireguard_config").Ctx(ctx).Where("id", iface).Data(ifaceData).Update(); err != nil {
+			return fmt.Errorf("更新服务端配置失败: %v", err)
+		}
+
+		for i, p := range config.Peers {
+			if count, _ := g.DB().Model("wireguard_peer").Ctx(ctx).Where("public_key", p.PublicKey).Count(); count > 0 {
+				result.Skipped++
+				result.Warnings = append(result.Warnings, fmt.Sprintf("客户端 %s 已存在，已跳过", p.PublicKey))
+				continue
+			}
+			name := p.Name
+			if name == "" {
+				name = fmt.Sprintf("imported-%d", i+1)
+			}
+
+			if err := wgserver.CheckKey(p.PublicKey); err != nil {
+				return fmt.Errorf("客户端 %s 公钥无效: %v", name, err)
+			}
+			if p.PresharedKey != "" {
+				if err := wgserver.CheckKey(p.PresharedKey); err != nil {
+					return fmt.Errorf("客户端 %s 预共享密钥无效: %v", name, err)
+				}
+			}
+			addrs, routed, err := splitPeerAllowedIPs(p.AllowedIPs, serverPrefixes)
+			if err != nil {
+				return fmt.Errorf("客户端 %s: %v", name, err)
+			}
+			if addrs == "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("客户端 %s 没有位于服务端网段内的地址", name))
+			} else if err := checkPeerAddress(ctx, iface, addrs, 0); err != nil {
+				return fmt.Errorf("客户端 %s: %v", name, err)
+			}
+			if routed != "" {
+				if routed, err = checkRoutedNetworks(ctx, routed, 0); err != nil {
+					return fmt.Errorf("客户端 %s: %v", name, err)
+				}
+			}
+			if p.Endpoint != "" {
+				if err := checkEndpoint(p.Endpoint); err != nil {
+					return fmt.Errorf("客户端 %s: %v", name, err)
+				}
+			}
+
+			peer := &entity.WireguardPeer{
+				Name:           name,
+				PublicKey:      p.PublicKey,
+				PrivateKey:     privateKeys[p.PublicKey],
+				PresharedKey:   p.PresharedKey,
+				AllowedIps:     addrs,
+				RoutedNetworks: routed,
+				Endpoint:       p.Endpoint,
+				Keepalive:      p.Keepalive,
+				QuotaResetDay:  1,
+				QuotaAction:    QuotaActionDisable,
+				Enabled:        1,
+				InterfaceId:    iface,
+				CreatedAt:      gtime.Now(),
+				UpdatedAt:      gtime.Now(),
+			}
+			if peer.PrivateKey == "" {
+				peer.External = 1
+				result.External++
+			}
+			res, err := g.DB().Model("wireguard_peer").Ctx(ctx).FieldsEx("id").Insert(peer)
+			if err != nil {
+				return fmt.Errorf("保存客户端 %s 失败: %v", name, err)
+			}
+			id, _ := res.LastInsertId()
+			peer.Id = int(id)
+			peers = append(peers, peer)
+			result.Imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 事务提交后同步运行时
+	serverConfig, err := GetConfig(ctx, iface)
+	if err != nil {
+		return nil, err
+	}
+	server := wgserver.GetServer(iface)
+	if _, err := server.Apply(serverOptions(ctx, serverConfig)); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("服务端配置已导入，但应用失败: %v", err))
+	}
+	if server.IsRunning() {
+		for _, peer := range peers {
+			server.AddPeer(runtimePeer(peer))
+		}
+	}
+
+	g.Log().Infof(ctx, "[WireGuard] 导入 wg-quick 配置到接口 %s: 客户端 %d 个 (外部 %d 个)，跳过 %d 个",
+		serverConfig.Interface, result.Imported, result.External, result.Skipped)
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package wireguard_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gogf/gf/v2/frame/g"
+
+	"omniwire/internal/service/wgserver"
+	svcWireguard "omniwire/internal/service/wireguard"
+)
+
+func TestImportWgQuickRejectsInvalidPresharedKey(t *testing.T) {
+	ctx := initTestDB(t)
+	serverPriv, _, _ := wgserver.GenerateKeyPair()
+	_, alicePub, _ := wgserver.GenerateKeyPair()
+	_, bobPub, _ := wgserver.GenerateKeyPair()
+	psk, _ := wgserver.GeneratePresharedKey()
+
+	config := fmt.Sprintf(`[Interface]
+Address = 10.66.66.1/24
+PrivateKey = %s
+
+[Peer]
+PublicKey = %s
+PresharedKey = %s
+AllowedIPs = 10.66.66.2/32
+
+[Peer]
+PublicKey = %s
+PresharedKey = not-a-key
+AllowedIPs = 10.66.66.3/32
+`, serverPriv, alicePub, psk, bobPub)
+
+	_, err := svcWireguard.ImportWgQuick(ctx, wgserver.DefaultInterface, &svcWireguard.ImportInput{Config: config})
+	if err == nil || !strings.Contains(err.Error(), "预共享密钥") {
+		t.Fatalf("expected preshared key error, got %v", err)
+	}
+	// 整个导入在同一事务中，有效的客户端也不应写入
+	if n, _ := g.DB().Model("wireguard_peer").Count(); n != 0 {
+		t.Fatalf("%d peers imported despite failure", n)
+	}
+}
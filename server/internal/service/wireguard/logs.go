@@ -0,0 +1,41 @@
+// ==========================================================================
+// OmniWire - WireGuard 设备日志
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/service/wgserver"
+)
+
+// GetDeviceLogs 获取接口最近的 wireguard-go 设备日志 (仅保存在内存中，重启程序后清空)
+func GetDeviceLogs(ctx context.Context, iface int, after uint64, limit int) (*wireguard.DeviceLogRes, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+	server := wgserver.GetServer(iface)
+	res := &wireguard.DeviceLogRes{
+		LogLevel: server.LogLevel(),
+		LastSeq:  after,
+		Logs:     make([]*wireguard.DeviceLogEntry, 0),
+	}
+	for _, entry := range server.DeviceLogs(after, limit) {
+		res.Logs = append(res.Logs, &wireguard.DeviceLogEntry{
+			Seq:     entry.Seq,
+			Time:    entry.Time.Format("2006-01-02 15:04:05"),
+			Level:   entry.Level,
+			Message: entry.Message,
+		})
+		res.LastSeq = entry.Seq
+	}
+	// 服务未运行时返回已保存的日志等级
+	if !server.IsRunning() {
+		if config, err := GetConfig(ctx, iface); err == nil && config.LogLevel != "" {
+			res.LogLevel = config.LogLevel
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,254 @@
+// ==========================================================================
+// OmniWire - WireGuard 客户端月度流量配额
+// 用量 = 历史总流量 (total_upload + total_download + 未落库增量) - 本周期起点 quota_base，
+// 配额状态全部保存在 wireguard_peer 中，重启后继续生效
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+
+	"omniwire/internal/model/entity"
+	"omniwire/internal/service/wgserver"
+)
+
+// 超额处理方式
+const (
+	QuotaActionDisable  = "disable"  // 禁用客户端，下个周期自动恢复
+	QuotaActionThrottle = "throttle" // 限速至 quota_throttle_rate
+)
+
+// defaultQuotaThrottleRate 未设置超额限速时使用的默认值 (128 KB/s)
+const defaultQuotaThrottleRate = 128 * 1024
+
+// quotaUsage 当前周期已用流量 (bytes)
+func quotaUsage(peer *entity.WireguardPeer, pendingUpload, pendingDownload int64) int64 {
+	return max(peer.TotalUpload+peer.TotalDownload+pendingUpload+pendingDownload-peer.QuotaBase, 0)
+}
+
+// quotaPeriodStart 计算 now 所在配额周期的起始时间，resetDay 限制在 1-28 以兼容所有月份
+func quotaPeriodStart(now time.Time, resetDay int) time.Time {
+	resetDay = min(max(resetDay, 1), 28)
+	start := time.Date(now.Year(), now.Month(), resetDay, 0, 0, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// checkQuota 校验配额参数
+func checkQuota(resetDay int, action string) error {
+	if resetDay < 1 || resetDay > 28 {
+		return fmt.Errorf("配额重置日应在 1-28 之间")
+	}
+	if action != QuotaActionDisable && action != QuotaActionThrottle {
+		return fmt.Errorf("不支持的超额处理方式: %s", action)
+	}
+	return nil
+}
+
+// applyQuotaInput 将输入中的配额参数写入客户端，data 不为 nil 时同时记录待更新字段
+// 返回是否有配额参数变化
+func applyQuotaInput(peer *entity.WireguardPeer, input *PeerInput, data g.Map) bool {
+	set := func(column string, value any) {
+		if data != nil {
+			data[column] = value
+		}
+	}
+	changed := false
+	if input.QuotaBytes != nil {
+		peer.QuotaBytes = max(*input.QuotaBytes, 0)
+		set("quota_bytes", peer.QuotaBytes)
+		changed = true
+	}
+	if input.QuotaResetDay != nil {
+		peer.QuotaResetDay = *input.QuotaResetDay
+		set("quota_reset_day", peer.QuotaResetDay)
+		// 重置日变化后按新周期重新计算
+		peer.QuotaPeriodStart = nil
+		set("quota_period_start", nil)
+		changed = true
+	}
+	if input.QuotaAction != nil {
+		peer.QuotaAction = *input.QuotaAction
+		set("quota_action", peer.QuotaAction)
+		changed = true
+	}
+	if input.QuotaThrottleRate != nil {
+		peer.QuotaThrottleRate = max(*input.QuotaThrottleRate, 0)
+		set("quota_throttle_rate", peer.QuotaThrottleRate)
+		changed = true
+	}
+	return changed
+}
+
+// runQuotaScheduler 定期检查客户端流量配额
+func runQuotaScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkQuotas(ctx)
+		}
+	}
+}
+
+// checkQuotas 处理周期重置、阈值预警与超额
+func checkQuotas(ctx context.Context) {
+	var peers []*entity.WireguardPeer
+	err := g.DB().Model("wireguard_peer").
+		Where("quota_bytes > 0 OR quota_exceeded = 1 OR throttle_rate > 0").
+		Scan(&peers)
+	if err != nil {
+		g.Log().Warningf(ctx, "[WireGuard] 查询流量配额失败: %v", err)
+		return
+	}
+
+	thresholds := g.Cfg().MustGet(ctx, "wireguard.quotaWarnThresholds", []int{80, 90}).Ints()
+	sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+
+	// 各接口的运行时状态，公钥在所有接口中唯一
+	runtimePeers := make(map[string]*wgserver.Peer)
+	for _, server := range wgserver.Servers() {
+		maps.Copy(runtimePeers, server.GetAllPeers())
+	}
+	now := time.Now()
+	for _, peer := range peers {
+		server := peerServer(peer)
+		var pendingUpload, pendingDownload int64
+		if rp, ok := runtimePeers[peer.PublicKey]; ok {
+			pendingUpload, pendingDownload = rp.PendingUpload, rp.PendingDownload
+		}
+
+		data := g.Map{}
+		// 进入新周期：以当前总流量为起点，解除上周期的超额状态
+		start := quotaPeriodStart(now, peer.QuotaResetDay)
+		if peer.QuotaPeriodStart == nil || peer.QuotaPeriodStart.Before(gtime.New(start)) {
+			peer.QuotaBase = peer.TotalUpload + peer.TotalDownload + pendingUpload + pendingDownload
+			peer.QuotaPeriodStart = gtime.New(start)
+			peer.QuotaWarned = 0
+			data["quota_base"] = peer.QuotaBase
+			data["quota_period_start"] = peer.QuotaPeriodStart
+			data["quota_warned"] = 0
+			if peer.QuotaExceeded == 1 {
+				restoreQuota(ctx, peer, data)
+			}
+		}
+
+		used := quotaUsage(peer, pendingUpload, pendingDownload)
+		switch {
+		case peer.QuotaBytes <= 0:
+			// 配额已取消
+			if peer.QuotaExceeded == 1 || peer.ThrottleRate > 0 {
+				restoreQuota(ctx, peer, data)
+			}
+		case used >= peer.QuotaBytes:
+			if peer.QuotaExceeded == 0 {
+				exceedQuota(ctx, peer, used, data)
+			}
+		default:
+			// 管理员调高了配额
+			if peer.QuotaExceeded == 1 {
+				restoreQuota(ctx, peer, data)
+			}
+			percent := int(used * 100 / peer.QuotaBytes)
+			for _, th := range thresholds {
+				if percent >= th && peer.QuotaWarned < th {
+					peer.QuotaWarned = th
+					data["quota_warned"] = th
+					server.LogPeerEvent(ctx, peer.Id, peer.Name, peer.PublicKey, "quota_warning")
+					g.Log().Warningf(ctx, "[WireGuard] 客户端 %s 流量已使用 %d%% (%d/%d bytes)", peer.Name, percent, used, peer.QuotaBytes)
+					break
+				}
+			}
+		}
+
+		if len(data) > 0 {
+			if _, err := g.DB().Model("wireguard_peer").Where("id", peer.Id).Data(data).Update(); err != nil {
+				g.Log().Warningf(ctx, "[WireGuard] 更新客户端 %s 配额状态失败: %v", peer.Name, err)
+			}
+		}
+	}
+}
+
+// exceedQuota 超额：按配置禁用或限速
+func exceedQuota(ctx context.Context, peer *entity.WireguardPeer, used int64, data g.Map) {
+	server := peerServer(peer)
+	peer.QuotaExceeded = 1
+	data["quota_exceeded"] = 1
+	server.LogPeerEvent(ctx, peer.Id, peer.Name, peer.PublicKey, "quota_exceeded")
+
+	if peer.QuotaAction == QuotaActionThrottle {
+		rate := peer.QuotaThrottleRate
+		if rate <= 0 {
+			rate = defaultQuotaThrottleRate
+		}
+		peer.ThrottleRate = rate
+		data["throttle_rate"] = rate
+		if peer.Enabled == 1 {
+			server.AddPeer(runtimePeer(peer))
+		}
+		g.Log().Warningf(ctx, "[WireGuard] 客户端 %s 流量超额 (%d/%d bytes)，已限速至 %d bytes/s", peer.Name, used, peer.QuotaBytes, rate)
+		return
+	}
+
+	peer.Enabled = 0
+	data["enabled"] = 0
+	server.DisablePeer(peer.PublicKey)
+	g.Log().Warningf(ctx, "[WireGuard] 客户端 %s 流量超额 (%d/%d bytes)，已禁用", peer.Name, used, peer.QuotaBytes)
+}
+
+// quotaDisabled 客户端是否因流量超额被禁用
+func quotaDisabled(peer *entity.WireguardPeer) bool {
+	return peer.QuotaExceeded == 1 && peer.QuotaAction == QuotaActionDisable && peer.Enabled == 0
+}
+
+// checkQuotaEnable 启用超额客户端前检查配额，data 记录待更新字段：
+// 超额处理方式为禁用且本周期仍超额时拒绝启用；配额已调高、取消或改为限速时清除超额状态，由下次配额检查重新评估
+func checkQuotaEnable(peer *entity.WireguardPeer, data g.Map) error {
+	if peer.QuotaExceeded != 1 {
+		return nil
+	}
+	if peer.QuotaAction == QuotaActionDisable && peer.QuotaBytes > 0 {
+		var pendingUpload, pendingDownload int64
+		if rp, ok := peerServer(peer).GetAllPeers()[peer.PublicKey]; ok {
+			pendingUpload, pendingDownload = rp.PendingUpload, rp.PendingDownload
+		}
+		if used := quotaUsage(peer, pendingUpload, pendingDownload); used >= peer.QuotaBytes {
+			return fmt.Errorf("客户端本周期流量已超额 (%d/%d bytes)，请调高配额或等到重置日后再启用", used, peer.QuotaBytes)
+		}
+	}
+	peer.QuotaExceeded = 0
+	data["quota_exceeded"] = 0
+	return nil
+}
+
+// restoreQuota 解除超额状态：恢复因超额被禁用的客户端 (未到期时)，取消超额限速
+func restoreQuota(ctx context.Context, peer *entity.WireguardPeer, data g.Map) {
+	server := peerServer(peer)
+	wasDisabled := quotaDisabled(peer)
+	peer.QuotaExceeded = 0
+	peer.ThrottleRate = 0
+	data["quota_exceeded"] = 0
+	data["throttle_rate"] = 0
+
+	if wasDisabled && (peer.ExpiresAt == nil || peer.ExpiresAt.After(gtime.Now())) {
+		peer.Enabled = 1
+		data["enabled"] = 1
+	}
+	if peer.Enabled == 1 {
+		server.EnablePeer(runtimePeer(peer))
+	}
+	g.Log().Infof(ctx, "[WireGuard] 客户端 %s 流量配额已恢复", peer.Name)
+}
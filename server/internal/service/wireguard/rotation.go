@@ -0,0 +1,225 @@
+// ==========================================================================
+// OmniWire - WireGuard 服务端密钥轮换
+// 流程：生成新密钥 (pending) -> 分发期内客户端下载新配置 -> 到达切换时间后
+// 通过 IpcSet 在线替换 private_key (completed)，每次轮换都保留记录用于审计
+// ==========================================================================
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+
+	"omniwire/api/v1/wireguard"
+	"omniwire/internal/service/wgserver"
+)
+
+// 密钥轮换状态
+const (
+	RotationPending   = "pending"
+	RotationCompleted = "completed"
+	RotationCancelled = "cancelled"
+)
+
+// minRotationLead 切换时间至少晚于当前时间的间隔，给客户端留出下载新配置的时间；需要立即切换时创建后调用 ApplyKeyRotation
+const minRotationLead = 10 * time.Minute
+
+// rotationMu 串行化轮换操作，避免定时切换与手动切换同时执行
+var rotationMu sync.Mutex
+
+// keyRotation 密钥轮换记录
+type keyRotation struct {
+	Id            int
+	InterfaceId   int
+	OldPublicKey  string
+	NewPrivateKey string
+	NewPublicKey  string
+	Status        string
+	ScheduledAt   *gtime.Time
+	CompletedAt   *gtime.Time
+	Operator      string
+	CreatedAt     *gtime.Time
+}
+
+// CreateKeyRotation 为接口生成新的服务端密钥并计划在 switchAt 切换，每个接口同一时间只允许一个待切换的轮换
+func CreateKeyRotation(ctx context.Context, iface int, switchAt time.Time, operator string) (*wireguard.KeyRotationInfo, error) {
+	if err := checkSwitchAt(switchAt, time.Now()); err != nil {
+		return nil, err
+	}
+
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+
+	if pending, _ := pendingRotation(ctx, iface); pending != nil {
+		return nil, fmt.Errorf("已有待切换的密钥轮换 (计划于 %s)，请先完成或取消", pending.ScheduledAt)
+	}
+
+	serverConfig, err := GetConfig(ctx, iface)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, publicKey, err := wgserver.GenerateKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %v", err)
+	}
+
+	rotation := &keyRotation{
+		InterfaceId:   iface,
+		OldPublicKey:  serverConfig.PublicKey,
+		NewPrivateKey: privateKey,
+		NewPublicKey:  publicKey,
+		Status:        RotationPending,
+		ScheduledAt:   gtime.New(switchAt),
+		Operator:      operator,
+		CreatedAt:     gtime.Now(),
+	}
+	res, err := g.DB().Model("wireguard_key_rotation").Data(g.Map{
+		"interface_id":    rotation.InterfaceId,
+		"old_public_key":  rotation.OldPublicKey,
+		"new_private_key": rotation.NewPrivateKey,
+		"new_public_key":  rotation.NewPublicKey,
+		"status":          rotation.Status,
+		"scheduled_at":    rotation.ScheduledAt,
+		"operator":        rotation.Operator,
+		"created_at":      rotation.CreatedAt,
+	}).Insert()
+	if err != nil {
+		return nil, fmt.Errorf("保存密钥轮换失败: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	rotation.Id = int(id)
+
+	g.Log().Infof(ctx, "[WireGuard] 接口 %s 已生成新服务端密钥 %s，计划于 %s 切换", serverConfig.Interface, publicKey, rotation.ScheduledAt)
+	return rotation.info(), nil
+}
+
+// GetKeyRotations 获取接口的密钥轮换记录 (按时间倒序)
+func GetKeyRotations(ctx context.Context, iface int) ([]*wireguard.KeyRotationInfo, error) {
+	var rows []*keyRotation
+	if err := g.DB().Model("wireguard_key_rotation").Where("interface_id", iface).OrderDesc("id").Scan(&rows); err != nil {
+		return nil, err
+	}
+	list := make([]*wireguard.KeyRotationInfo, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, row.info())
+	}
+	return list, nil
+}
+
+// CancelKeyRotation 取消待切换的密钥轮换
+func CancelKeyRotation(ctx context.Context, iface, id int, operator string) error {
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+
+	res, err := g.DB().Model("wireguard_key_rotation").
+		Where("id", id).Where("interface_id", iface).Where("status", RotationPending).
+		Data(g.Map{"status": RotationCancelled, "completed_at": gtime.Now()}).Update()
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("待切换的密钥轮换不存在")
+	}
+	g.Log().Infof(ctx, "[WireGuard] 密钥轮换 #%d 已由 %s 取消", id, operator)
+	return nil
+}
+
+// ApplyKeyRotation 立即切换到新密钥，不等待计划时间
+func ApplyKeyRotation(ctx context.Context, iface, id int) error {
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+
+	pending, err := pendingRotation(ctx, iface)
+	if err != nil {
+		return err
+	}
+	if pending == nil || pending.Id != id {
+		return fmt.Errorf("待切换的密钥轮换不存在")
+	}
+	return switchServerKey(ctx, pending)
+}
+
+// pendingRotation 接口当前待切换的轮换，没有时返回 nil
+func pendingRotation(ctx context.Context, iface int) (*keyRotation, error) {
+	var rotation *keyRotation
+	err := g.DB().Model("wireguard_key_rotation").Where("interface_id", iface).Where("status", RotationPending).OrderDesc("id").Scan(&rotation)
+	return rotation, err
+}
+
+// switchServerKey 将新密钥写入配置并下发到运行中的设备 (调用方需持有 rotationMu)
+func switchServerKey(ctx context.Context, rotation *keyRotation) error {
+	if _, err := g.DB().Model("wireguard_config").Where("id", rotation.InterfaceId).Data(g.Map{
+		"private_key": rotation.NewPrivateKey,
+		"public_key":  rotation.NewPublicKey,
+		"updated_at":  gtime.Now(),
+	}).Update(); err != nil {
+		return fmt.Errorf("更新服务端密钥失败: %v", err)
+	}
+
+	config, err := GetConfig(ctx, rotation.InterfaceId)
+	if err != nil {
+		return err
+	}
+	if _, err := wgserver.GetServer(rotation.InterfaceId).Apply(serverOptions(ctx, config)); err != nil {
+		return fmt.Errorf("服务端密钥已保存，但下发失败: %v", err)
+	}
+
+	_, err = g.DB().Model("wireguard_key_rotation").Where("id", rotation.Id).
+		Data(g.Map{"status": RotationCompleted, "completed_at": gtime.Now()}).Update()
+	g.Log().Infof(ctx, "[WireGuard] 接口 %s 服务端密钥已切换: %s -> %s", config.Interface, rotation.OldPublicKey, rotation.NewPublicKey)
+	return err
+}
+
+// runKeyRotationScheduler 定期检查到期的密钥轮换并执行切换
+func runKeyRotationScheduler(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rotationMu.Lock()
+			var due []*keyRotation
+			err := g.DB().Model("wireguard_key_rotation").
+				Where("status", RotationPending).WhereLTE("scheduled_at", gtime.Now()).Scan(&due)
+			if err == nil {
+				for _, pending := range due {
+					if err := switchServerKey(ctx, pending); err != nil {
+						g.Log().Errorf(ctx, "[WireGuard] 接口 %d 定时切换服务端密钥失败: %v", pending.InterfaceId, err)
+					}
+				}
+			}
+			rotationMu.Unlock()
+		}
+	}
+}
+
+func (r *keyRotation) info() *wireguard.KeyRotationInfo {
+	info := &wireguard.KeyRotationInfo{
+		Id:           r.Id,
+		OldPublicKey: r.OldPublicKey,
+		NewPublicKey: r.NewPublicKey,
+		Status:       r.Status,
+		ScheduledAt:  r.ScheduledAt.String(),
+		Operator:     r.Operator,
+		CreatedAt:    r.CreatedAt.String(),
+	}
+	if r.CompletedAt != nil {
+		info.CompletedAt = r.CompletedAt.String()
+	}
+	return info
+}
+
+// checkSwitchAt 切换时间须晚于 now 至少 minRotationLead
+func checkSwitchAt(switchAt, now time.Time) error {
+	if earliest := now.Add(minRotationLead); switchAt.Before(earliest) {
+		return fmt.Errorf("切换时间须晚于当前时间至少 %d 分钟 (不早于 %s)", int(minRotationLead.Minutes()), earliest.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
@@ -8,6 +8,10 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gogf/gf/v2/frame/g"
@@ -16,6 +20,8 @@ import (
 
 	"omniwire/api/v1/wireguard"
 	"omniwire/internal/model/entity"
+	"omniwire/internal/service/dnsserver"
+	"omniwire/internal/service/ipam"
 	"omniwire/internal/service/wgserver"
 )
 
@@ -26,10 +32,13 @@ type StatusOutput struct {
 	ListenPort int
 	PublicKey  string
 	PeerCount  int
+	Mode       string
+	NAT        *wgserver.NATStatus // 已安装的 NAT 规则，未安装时为 nil
 }
 
 // ConfigOutput WireGuard 配置输出
 type ConfigOutput struct {
+	Id                  int // 接口 ID
 	Interface           string
 	ListenPort          int
 	PrivateKey          string
@@ -40,12 +49,18 @@ type ConfigOutput struct {
 	EndpointAddress     string
 	PostUp              string
 	PostDown            string
+	HookTimeout         int  // 钩子单条命令超时 (秒)
+	PostUpRollback      bool // PostUp 失败时回滚启动
 	EthDevice           string
 	PersistentKeepalive int
 	ClientAllowedIPs    string
 	ProxyAddress        string
 	LogLevel            string
 	AutoStart           bool
+	Mode                string // tun | netstack
+	UAPI                bool   // 开放 UAPI 套接字
+	BuiltinDNS          bool   // 在隧道地址上提供内置 DNS
+	HandshakeDiag       bool   // 记录被拒绝的握手
 }
 
 // ConfigInput 配置输入
@@ -61,64 +76,182 @@ type ConfigInput struct {
 	ProxyAddress        string
 	LogLevel            string
 	AutoStart           bool
+	Mode                string
+	UAPI                bool
+	PostUp              string
+	PostDown            string
+	HookTimeout         int
+	PostUpRollback      bool
+	BuiltinDNS          bool
+	HandshakeDiag       bool
 }
 
 // PeerInput 客户端输入
 type PeerInput struct {
-	Name       string
-	AllowedIPs string
-	Enabled    bool
+	Name          string
+	AllowedIPs    string
+	Enabled       bool
+	UploadLimit   int64 // bytes/s, 0=使用分组限速 (未分组时无限制), 更新时 <0 表示保持不变
+	DownloadLimit int64 // bytes/s, 0=使用分组限速 (未分组时无限制), 更新时 <0 表示保持不变
+	// 以下字段为 nil 时：创建使用默认值，更新保持不变
+	Endpoint       *string // 对端地址 host:port，空字符串表示清除
+	Keepalive      *int    // 秒，<0 继承全局配置，0 关闭
+	RoutedNetworks *string // Peer 后方的局域网网段，逗号分隔，空字符串表示清除
+	ExpiresAt      *string // 到期时间 "2006-01-02 15:04:05"，空字符串表示永不过期
+	// 月度流量配额
+	QuotaBytes        *int64  // 每周期配额 (bytes)，0=不限
+	QuotaResetDay     *int    // 每月重置日 (1-28)
+	QuotaAction       *string // 超额处理: disable | throttle
+	QuotaThrottleRate *int64  // 超额后限速 (bytes/s)，0 使用默认值
+	// 分组与标签
+	GroupId *int    // 所属分组，0=未分组
+	Tags    *string // 标签，逗号分隔
+	// 客户端自行生成的公钥，设置后服务端不保存私钥
+	PublicKey *string
 }
 
-// Status 获取 WireGuard 服务状态
-func Status(ctx context.Context) (*StatusOutput, error) {
-	server := wgserver.GetServer()
+// privateKeyPlaceholder 服务端不保存私钥时，客户端配置模板中的私钥占位符
+const privateKeyPlaceholder = "<CLIENT_PRIVATE_KEY>"
+
+// Status 获取接口的 WireGuard 服务状态
+func Status(ctx context.Context, iface int) (*StatusOutput, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+	server := wgserver.GetServer(iface)
 	return &StatusOutput{
 		Running:    server.IsRunning(),
 		Interface:  server.GetInterfaceName(),
 		ListenPort: server.GetListenPort(),
 		PublicKey:  server.GetPublicKey(),
 		PeerCount:  server.GetPeerCount(),
+		Mode:       server.GetMode(),
+		NAT:        server.NATStatus(),
 	}, nil
 }
 
-// Start 启动 WireGuard 服务
-func Start(ctx context.Context) error {
-	server := wgserver.GetServer()
+// Start 启动接口的 WireGuard 服务
+func Start(ctx context.Context, iface int) error {
+	if err := checkInterface(ctx, iface); err != nil {
+		return err
+	}
+	server := wgserver.GetServer(iface)
 
 	// 先初始化（确保密钥存在）
 	if err := server.Initialize(ctx); err != nil {
 		return fmt.Errorf("初始化失败: %v", err)
 	}
 
-	config, err := GetConfig(ctx)
+	config, err := GetConfig(ctx, iface)
 	if err != nil {
 		return err
 	}
 
+	// 访问控制规则与分组限速随服务启动生效
+	if err := loadACL(ctx, iface); err != nil {
+		return err
+	}
+	limits, err := groupLimits(ctx)
+	if err != nil {
+		return err
+	}
+	server.SetGroupLimits(limits)
+
 	// 启动服务
-	if err := server.Start(config.Interface, config.ListenPort, config.PrivateKey, config.Address, config.DNS); err != nil {
+	if err := server.Start(serverOptions(ctx, config)); err != nil {
 		return err
 	}
 
-	g.Log().Info(ctx, "[WireGuard] 服务已启动")
+	g.Log().Infof(ctx, "[WireGuard] 接口 %s 服务已启动", config.Interface)
 	return nil
 }
 
-// Stop 停止 WireGuard 服务
-func Stop(ctx context.Context) error {
-	server := wgserver.GetServer()
+// serverOptions 由数据库配置生成服务端启动参数
+// NAT 出口网卡优先使用接口配置的 eth_device，其次为配置文件 wireguard.outInterface
+func serverOptions(ctx context.Context, config *ConfigOutput) wgserver.Options {
+	outInterface := config.EthDevice
+	if outInterface == "" {
+		outInterface = g.Cfg().MustGet(ctx, "wireguard.outInterface", "").String()
+	}
+	// 钩子可执行任意命令，配置文件中关闭后即使已保存也不执行
+	postUp, postDown := config.PostUp, config.PostDown
+	if !g.Cfg().MustGet(ctx, "wireguard.enableHooks", true).Bool() {
+		postUp, postDown = "", ""
+	}
+	// 内置代理默认拒绝回环、链路本地及宿主机地址，wireguard.proxyAllow 中的网段例外
+	var proxyAllow []netip.Prefix
+	for _, item := range g.Cfg().MustGet(ctx, "wireguard.proxyAllow").Strings() {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(item))
+		if err != nil {
+			g.Log().Warningf(ctx, "[WireGuard] 忽略无效的 wireguard.proxyAllow 网段 %q: %v", item, err)
+			continue
+		}
+		proxyAllow = append(proxyAllow, prefix.Masked())
+	}
+	var dnsServer wgserver.DNSHandler
+	if config.BuiltinDNS {
+		dnsServer = dnsserver.Default()
+	}
+	return wgserver.Options{
+		Interface:    config.Interface,
+		Mode:         config.Mode,
+		ListenPort:   config.ListenPort,
+		PrivateKey:   config.PrivateKey,
+		Address:      config.Address,
+		DNS:          config.DNS,
+		MTU:          config.MTU,
+		ProxyAddress: config.ProxyAddress,
+		ProxyAllow:   proxyAllow,
+		Keepalive:    config.PersistentKeepalive,
+		UAPI:         config.UAPI,
+		NAT:          g.Cfg().MustGet(ctx, "wireguard.enableNat", true).Bool(),
+		OutInterface: outInterface,
+
+		PostUp:         postUp,
+		PostDown:       postDown,
+		HookTimeout:    time.Duration(config.HookTimeout) * time.Second,
+		PostUpRollback: config.PostUpRollback,
+
+		DNSServer:     dnsServer,
+		LogLevel:      config.LogLevel,
+		HandshakeDiag: config.HandshakeDiag,
+	}
+}
+
+// 钩子单条命令超时 (秒)
+const (
+	defaultHookTimeout = 30
+	maxHookTimeout     = 600
+)
+
+// GetHookResults 获取接口最近的 PostUp / PostDown 执行结果
+func GetHookResults(ctx context.Context, iface int) ([]wgserver.HookResult, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+	return wgserver.GetServer(iface).HookResults(), nil
+}
+
+// Stop 停止接口的 WireGuard 服务
+func Stop(ctx context.Context, iface int) error {
+	if err := checkInterface(ctx, iface); err != nil {
+		return err
+	}
+	server := wgserver.GetServer(iface)
 	if err := server.Stop(); err != nil {
 		return err
 	}
 
-	g.Log().Info(ctx, "[WireGuard] 服务已停止")
+	g.Log().Infof(ctx, "[WireGuard] 接口 %d 服务已停止", iface)
 	return nil
 }
 
-// Restart 重启 WireGuard 服务
-func Restart(ctx context.Context) error {
-	server := wgserver.GetServer()
+// Restart 重启接口的 WireGuard 服务
+func Restart(ctx context.Context, iface int) error {
+	if err := checkInterface(ctx, iface); err != nil {
+		return err
+	}
+	server := wgserver.GetServer(iface)
 
 	if server.IsRunning() {
 		if err := server.Stop(); err != nil {
@@ -127,33 +260,45 @@ func Restart(ctx context.Context) error {
 		time.Sleep(time.Second)
 	}
 
-	return Start(ctx)
+	return Start(ctx, iface)
 }
 
-// GetConfig 获取 WireGuard 配置
-func GetConfig(ctx context.Context) (*ConfigOutput, error) {
+// GetConfig 获取接口的 WireGuard 配置
+func GetConfig(ctx context.Context, iface int) (*ConfigOutput, error) {
 	// 从数据库读取配置
 	var config struct {
-		InterfaceName       string
-		ListenPort          int
-		PrivateKey          string
-		PublicKey           string
-		Address             string
-		Dns                 string
-		Mtu                 int
-		EndpointAddress     string
-		EthDevice           string
-		PersistentKeepalive int
-		ClientAllowedIps    string
-		ProxyAddress        string
-		LogLevel            string
-		AutoStart           int
-	}
-
-	err := g.DB().Model("wireguard_config").Where("id", 1).Scan(&config)
-	if err != nil {
-		// 返回默认配置
+		InterfaceName        string
+		ListenPort           int
+		PrivateKey           string
+		PublicKey            string
+		Address              string
+		Dns                  string
+		Mtu                  int
+		EndpointAddress      string
+		EthDevice            string
+		PersistentKeepalive  int
+		ClientAllowedIps     string
+		ProxyAddress         string
+		LogLevel             string
+		AutoStart            int
+		Mode                 string
+		Uapi                 int
+		PostUp               string
+		PostDown             string
+		HookTimeout          int
+		PostUpRollback       int
+		BuiltinDns           int
+		HandshakeDiagnostics int
+	}
+
+	err := g.DB().Model("wireguard_config").Ctx(ctx).Where("id", iface).Scan(&config)
+	if err != nil && iface != wgserver.DefaultInterface {
+		return nil, fmt.Errorf("接口不存在")
+	}
+	if err != nil {
+		// 默认接口尚未保存配置时返回默认配置
 		return &ConfigOutput{
+			Id:                  iface,
 			Interface:           "omniwire",
 			ListenPort:          g.Cfg().MustGet(ctx, "wireguard.listenPort", 51820).Int(),
 			Address:             g.Cfg().MustGet(ctx, "wireguard.addressRange", "10.66.66.1/24").String(),
@@ -165,12 +310,20 @@ func GetConfig(ctx context.Context) (*ConfigOutput, error) {
 			ProxyAddress:        ":50122",
 			LogLevel:            "error",
 			AutoStart:           false,
+			Mode:                g.Cfg().MustGet(ctx, "wireguard.mode", wgserver.ModeTUN).String(),
+			HookTimeout:         defaultHookTimeout,
 		}, nil
 	}
 
+	mode := config.Mode
+	if mode == "" {
+		mode = wgserver.ModeTUN
+	}
+
 	// 直接返回数据库中的 EndpointAddress，不做默认值替换
 	// 这样前端可以正确显示和保存用户配置的值
 	return &ConfigOutput{
+		Id:                  iface,
 		Interface:           config.InterfaceName,
 		ListenPort:          config.ListenPort,
 		PrivateKey:          config.PrivateKey,
@@ -185,17 +338,49 @@ func GetConfig(ctx context.Context) (*ConfigOutput, error) {
 		ProxyAddress:        config.ProxyAddress,
 		LogLevel:            config.LogLevel,
 		AutoStart:           config.AutoStart == 1,
+		Mode:                mode,
+		UAPI:                config.Uapi == 1,
+		PostUp:              config.PostUp,
+		PostDown:            config.PostDown,
+		HookTimeout:         config.HookTimeout,
+		PostUpRollback:      config.PostUpRollback == 1,
+		BuiltinDNS:          config.BuiltinDns == 1,
+		HandshakeDiag:       config.HandshakeDiagnostics == 1,
 	}, nil
 }
 
-// UpdateConfig 更新 WireGuard 配置
-func UpdateConfig(ctx context.Context, input *ConfigInput) error {
-	g.Log().Infof(ctx, "[WireGuard] 更新配置请求: EndpointAddress='%s', Port=%d, AutoStart=%v, ClientAllowedIPs='%s'",
-		input.EndpointAddress, input.ListenPort, input.AutoStart, input.ClientAllowedIPs)
+// UpdateConfig 更新接口的 WireGuard 配置，服务运行中时按差异热更新
+func UpdateConfig(ctx context.Context, iface int, input *ConfigInput) (*wgserver.ApplyResult, error) {
+	g.Log().Infof(ctx, "[WireGuard] 更新接口 %d 配置请求: EndpointAddress='%s', Port=%d, AutoStart=%v, ClientAllowedIPs='%s'",
+		iface, input.EndpointAddress, input.ListenPort, input.AutoStart, input.ClientAllowedIPs)
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
 
-	autoStart := 0
-	if input.AutoStart {
-		autoStart = 1
+	autoStart := boolToInt(input.AutoStart)
+	uapi := boolToInt(input.UAPI)
+	if input.HookTimeout == 0 {
+		input.HookTimeout = defaultHookTimeout
+	}
+	if input.HookTimeout < 1 || input.HookTimeout > maxHookTimeout {
+		return nil, fmt.Errorf("钩子超时应在 1-%d 秒之间", maxHookTimeout)
+	}
+	mode := input.Mode
+	if mode == "" {
+		mode = wgserver.ModeTUN
+	}
+	prefixes, err := wgserver.ParseServerAddress(input.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := ipam.CheckOverlap(ctx, ipam.ServiceWireGuard, prefixes); err != nil {
+		return nil, err
+	}
+	if err := checkInterfaceConflict(ctx, iface, "", input.ListenPort, prefixes); err != nil {
+		return nil, err
+	}
+	if err := checkServerAddress(ctx, iface, prefixes); err != nil {
+		return nil, err
 	}
 
 	// 更新数据库配置
@@ -212,14 +397,23 @@ func UpdateConfig(ctx context.Context, input *ConfigInput) error {
 			proxy_address = ?,
 			log_level = ?,
 			auto_start = ?,
+			mode = ?,
+			uapi = ?,
+			post_up = ?,
+			post_down = ?,
+			hook_timeout = ?,
+			post_up_rollback = ?,
+			builtin_dns = ?,
+			handshake_diagnostics = ?,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE id = 1
+		WHERE id = ?
 	`, input.ListenPort, input.Address, input.DNS, input.MTU, input.EndpointAddress,
-		input.EthDevice, input.PersistentKeepalive, input.ClientAllowedIPs, input.ProxyAddress, input.LogLevel, autoStart)
+		input.EthDevice, input.PersistentKeepalive, input.ClientAllowedIPs, input.ProxyAddress, input.LogLevel, autoStart, mode, uapi,
+		input.PostUp, input.PostDown, input.HookTimeout, boolToInt(input.PostUpRollback), boolToInt(input.BuiltinDNS), boolToInt(input.HandshakeDiag), iface)
 
 	if err != nil {
 		g.Log().Errorf(ctx, "[WireGuard] 更新配置失败: %v", err)
-		return fmt.Errorf("更新配置失败: %v", err)
+		return nil, fmt.Errorf("更新配置失败: %v", err)
 	}
 
 	rowsAffected, _ := result.RowsAffected()
@@ -232,36 +426,39 @@ func UpdateConfig(ctx context.Context, input *ConfigInput) error {
 			privateKey, publicKey = "", ""
 		}
 		_, err = g.DB().Exec(ctx, `
-			INSERT INTO wireguard_config (id, private_key, public_key, listen_port, address, dns, mtu, endpoint_address, eth_device, persistent_keepalive, client_allowed_ips, proxy_address, log_level, auto_start)
-			VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			INSERT INTO wireguard_config (id, private_key, public_key, listen_port, address, dns, mtu, endpoint_address, eth_device, persistent_keepalive, client_allowed_ips, proxy_address, log_level, auto_start, mode, uapi, post_up, post_down, hook_timeout, post_up_rollback, builtin_dns, handshake_diagnostics)
+			VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`, privateKey, publicKey, input.ListenPort, input.Address, input.DNS, input.MTU, input.EndpointAddress,
-			input.EthDevice, input.PersistentKeepalive, input.ClientAllowedIPs, input.ProxyAddress, input.LogLevel, autoStart)
+			input.EthDevice, input.PersistentKeepalive, input.ClientAllowedIPs, input.ProxyAddress, input.LogLevel, autoStart, mode, uapi,
+			input.PostUp, input.PostDown, input.HookTimeout, boolToInt(input.PostUpRollback), boolToInt(input.BuiltinDNS), boolToInt(input.HandshakeDiag))
 		if err != nil {
-			return fmt.Errorf("插入配置失败: %v", err)
+			return nil, fmt.Errorf("插入配置失败: %v", err)
 		}
 		g.Log().Infof(ctx, "[WireGuard] 配置记录不存在，已插入新记录")
 	}
 
-	// 如果服务正在运行，需要重启
-	server := wgserver.GetServer()
-	if server.IsRunning() {
-		g.Log().Info(ctx, "[WireGuard] 配置已更新，需要重启服务生效")
+	// 服务运行中时按差异生效：能在线修改的直接下发，网卡本身变化时才重建
+	config, err := GetConfig(ctx, iface)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	applied, err := wgserver.GetServer(iface).Apply(serverOptions(ctx, config))
+	if err != nil {
+		return nil, fmt.Errorf("配置已保存，但应用失败: %v", err)
+	}
+	g.Log().Infof(ctx, "[WireGuard] 配置生效方式: %s, 变更项: %v", applied.Path, applied.Changes)
+	return applied, nil
 }
 
 // ... (CreatePeer, UpdatePeer, DeletePeer 等保持不变，这里省略以匹配替换范围)
 
-// GetPeerConfig 获取客户端配置文件
-func GetPeerConfig(ctx context.Context, id int) (string, error) {
-	var peer entity.WireguardPeer
-	err := g.DB().Model("wireguard_peer").Where("id", id).Scan(&peer)
-	if err != nil || peer.Id == 0 {
-		return "", fmt.Errorf("客户端不存在")
+// GetPeerConfig 获取客户端配置文件，next 为 true 时使用待切换的服务端新公钥 (密钥轮换分发期)
+func GetPeerConfig(ctx context.Context, iface, id int, next bool) (string, error) {
+	peer, err := getPeer(ctx, iface, id)
+	if err != nil {
+		return "", err
 	}
-
-	serverConfig, err := GetConfig(ctx)
+	serverConfig, err := GetConfig(ctx, iface)
 	if err != nil {
 		return "", err
 	}
@@ -272,15 +469,41 @@ func GetPeerConfig(ctx context.Context, id int) (string, error) {
 		return "", fmt.Errorf("请先在 WireGuard 配置中设置公网地址")
 	}
 
+	// 其他站点的局域网网段需经隧道访问，追加到客户端 AllowedIPs
+	// 分组可覆盖客户端 AllowedIPs 与 DNS
+	// 开启内置 DNS 时指向服务端隧道地址，并附带搜索域以便直接使用客户端名称
+	peerConfig := *serverConfig
+	if serverConfig.BuiltinDNS {
+		peerConfig.DNS = builtinDNSServers(serverConfig.Address)
+	}
+	applyGroupDefaults(ctx, &peerConfig, peer.GroupId)
+	peerConfig.ClientAllowedIPs = appendRoutedNetworks(ctx, iface, peerConfig.ClientAllowedIPs, peer.Id)
+	if next {
+		pending, _ := pendingRotation(ctx, iface)
+		if pending == nil {
+			return "", fmt.Errorf("当前没有待切换的服务端密钥")
+		}
+		peerConfig.PublicKey = pending.NewPublicKey
+	}
+
 	listenPort := serverConfig.ListenPort
-	allowedIPs := serverConfig.ClientAllowedIPs
+	allowedIPs := peerConfig.ClientAllowedIPs
 
 	g.Log().Infof(ctx, "[WireGuard] 生成客户端配置, Endpoint: %s:%d, AllowedIPs: %s", endpoint, listenPort, allowedIPs)
 
-	return buildPeerConfig(peer.PrivateKey, peer.AllowedIps, serverConfig), nil
+	return buildPeerConfig(peer, &peerConfig), nil
 }
 
-func buildPeerConfig(privateKey, address string, serverConfig *ConfigOutput) string {
+// buildPeerConfig 生成客户端配置，服务端未保存私钥时输出占位符，由客户端自行填写
+func buildPeerConfig(peer *entity.WireguardPeer, serverConfig *ConfigOutput) string {
+	privateKey := peer.PrivateKey
+	if privateKey == "" {
+		privateKey = privateKeyPlaceholder
+	}
+	presharedKey := ""
+	if peer.PresharedKey != "" {
+		presharedKey = fmt.Sprintf("PresharedKey = %s\n", peer.PresharedKey)
+	}
 	return fmt.Sprintf(`[Interface]
 PrivateKey = %s
 Address = %s
@@ -289,39 +512,67 @@ MTU = %d
 
 [Peer]
 PublicKey = %s
-AllowedIPs = %s
+%sAllowedIPs = %s
 PersistentKeepalive = %d
 Endpoint = %s:%d
-`, privateKey, address, serverConfig.DNS, serverConfig.MTU, serverConfig.PublicKey, serverConfig.ClientAllowedIPs, serverConfig.PersistentKeepalive, serverConfig.EndpointAddress, serverConfig.ListenPort)
+`, privateKey, peer.AllowedIps, serverConfig.DNS, serverConfig.MTU, serverConfig.PublicKey, presharedKey, serverConfig.ClientAllowedIPs, peerKeepalive(peer, serverConfig), serverConfig.EndpointAddress, serverConfig.ListenPort)
 }
 
-// GetPeers 获取客户端列表
-func GetPeers(ctx context.Context) ([]*wireguard.PeerInfo, error) {
+// GetPeers 获取接口的客户端列表，groupId <0 不按分组筛选 (0=未分组)，tag 为空不按标签筛选
+func GetPeers(ctx context.Context, iface, groupId int, tag string) ([]*wireguard.PeerInfo, error) {
 	peers := make([]*wireguard.PeerInfo, 0)
 
 	// 从数据库获取客户端列表
-	result, err := g.DB().Model("wireguard_peer").OrderDesc("id").All()
+	model := g.DB().Model("wireguard_peer").Where("interface_id", iface)
+	if groupId >= 0 {
+		model = model.Where("group_id", groupId)
+	}
+	if tag = strings.TrimSpace(tag); tag != "" {
+		model = model.Where(`(',' || tags || ',') LIKE ? ESCAPE '\'`, "%,"+escapeLike(tag)+",%")
+	}
+	result, err := model.OrderDesc("id").All()
 	if err != nil {
 		return nil, err
 	}
 
+	groupNames := make(map[int]string)
+	if groups, err := g.DB().Model("wireguard_peer_group").Fields("id, name").All(); err == nil {
+		for _, row := range groups {
+			groupNames[row["id"].Int()] = row["name"].String()
+		}
+	}
+
 	// 获取运行时的客户端状态（包含实时流量和握手时间）
-	server := wgserver.GetServer()
-	runtimePeers := server.GetAllPeers()
+	runtimePeers := wgserver.GetServer(iface).GetAllPeers()
 
 	for _, row := range result {
 		peer := &wireguard.PeerInfo{
-			Id:            row["id"].Int(),
-			Name:          row["name"].String(),
-			PublicKey:     row["public_key"].String(),
-			AllowedIPs:    row["allowed_ips"].String(),
-			Enabled:       row["enabled"].Int() == 1,
-			UploadLimit:   row["upload_limit"].Int64(),
-			DownloadLimit: row["download_limit"].Int64(),
-			TotalUpload:   row["total_upload"].Int64(),
-			TotalDownload: row["total_download"].Int64(),
-			CreatedAt:     row["created_at"].String(),
-			UpdatedAt:     row["updated_at"].String(),
+			Id:                  row["id"].Int(),
+			Name:                row["name"].String(),
+			PublicKey:           row["public_key"].String(),
+			AllowedIPs:          row["allowed_ips"].String(),
+			RoutedNetworks:      row["routed_networks"].String(),
+			PresharedKey:        row["preshared_key"].String() != "",
+			Enabled:             row["enabled"].Int() == 1,
+			StaticEndpoint:      row["endpoint"].String(),
+			PersistentKeepalive: row["persistent_keepalive"].Int(),
+			UploadLimit:         row["upload_limit"].Int64(),
+			DownloadLimit:       row["download_limit"].Int64(),
+			TotalUpload:         row["total_upload"].Int64(),
+			TotalDownload:       row["total_download"].Int64(),
+			ExpiresAt:           row["expires_at"].String(),
+			RemainingSeconds:    RemainingSeconds(row["expires_at"].GTime()),
+			QuotaBytes:          row["quota_bytes"].Int64(),
+			QuotaResetDay:       row["quota_reset_day"].Int(),
+			QuotaAction:         row["quota_action"].String(),
+			QuotaThrottleRate:   row["quota_throttle_rate"].Int64(),
+			QuotaExceeded:       row["quota_exceeded"].Int() == 1,
+			GroupId:             row["group_id"].Int(),
+			GroupName:           groupNames[row["group_id"].Int()],
+			Tags:                row["tags"].String(),
+			External:            row["external"].Int() == 1,
+			CreatedAt:           row["created_at"].String(),
+			UpdatedAt:           row["updated_at"].String(),
 		}
 
 		// 填充运行时状态（实时流量、握手时间、在线状态）
@@ -333,6 +584,12 @@ func GetPeers(ctx context.Context) ([]*wireguard.PeerInfo, error) {
 			}
 			peer.TransferRx = rp.TransferRx
 			peer.TransferTx = rp.TransferTx
+			// 合并尚未落库的累计流量
+			peer.TotalUpload += rp.PendingUpload
+			peer.TotalDownload += rp.PendingDownload
+		}
+		if peer.QuotaBytes > 0 {
+			peer.QuotaUsed = max(peer.TotalUpload+peer.TotalDownload-row["quota_base"].Int64(), 0)
 		}
 
 		peers = append(peers, peer)
@@ -341,58 +598,126 @@ func GetPeers(ctx context.Context) ([]*wireguard.PeerInfo, error) {
 	return peers, nil
 }
 
-// CreatePeer 创建客户端
-func CreatePeer(ctx context.Context, input *PeerInput) (*entity.WireguardPeer, error) {
-	// 生成密钥对 (Base64)
-	privateKey, publicKey, err := wgserver.GenerateKeyPair()
+// CreatePeer 在接口下创建客户端
+func CreatePeer(ctx context.Context, iface int, input *PeerInput) (*entity.WireguardPeer, error) {
+	peer, err := insertPeer(ctx, iface, input)
 	if err != nil {
+		return nil, err
+	}
+
+	// 添加到运行时
+	server := wgserver.GetServer(iface)
+	if server.IsRunning() {
+		server.AddPeer(runtimePeer(peer))
+	}
+
+	g.Log().Infof(ctx, "[WireGuard] 创建客户端: %s (%s)", peer.Name, peer.AllowedIps)
+	return peer, nil
+}
+
+// insertPeer 生成密钥、分配地址并保存客户端，不同步运行时
+// 数据库操作均使用 ctx，可在事务中调用 (见 BatchCreatePeers)
+func insertPeer(ctx context.Context, iface int, input *PeerInput) (*entity.WireguardPeer, error) {
+	if err := checkInterface(ctx, iface); err != nil {
+		return nil, err
+	}
+
+	// 生成密钥对 (Base64)，客户端提交公钥时服务端不保存私钥
+	var privateKey, publicKey string
+	var err error
+	if input.PublicKey != nil && *input.PublicKey != "" {
+		publicKey = strings.TrimSpace(*input.PublicKey)
+		if err := checkPeerPublicKey(ctx, publicKey, 0); err != nil {
+			return nil, err
+		}
+	} else if privateKey, publicKey, err = wgserver.GenerateKeyPair(); err != nil {
 		return nil, fmt.Errorf("生成密钥失败: %v", err)
 	}
 
-	// 分配 IP
+	// 分配 IP，管理员指定地址时检查冲突
 	ip := input.AllowedIPs
 	if ip == "" {
-		ip, err = allocateIP(ctx)
+		ip, err = allocateIP(ctx, iface)
 		if err != nil {
 			return nil, err
 		}
+	} else if err := checkPeerAddress(ctx, iface, ip, 0); err != nil {
+		return nil, err
 	}
 
 	peer := &entity.WireguardPeer{
-		Name:       input.Name,
-		PrivateKey: privateKey,
-		PublicKey:  publicKey,
-		AllowedIps: ip,
-		Enabled:    1,
-		CreatedAt:  gtime.Now(),
-		UpdatedAt:  gtime.Now(),
+		Name:          input.Name,
+		PrivateKey:    privateKey,
+		PublicKey:     publicKey,
+		AllowedIps:    ip,
+		External:      boolToInt(privateKey == ""),
+		Keepalive:     -1,
+		QuotaResetDay: 1,
+		QuotaAction:   QuotaActionDisable,
+		Enabled:       1,
+		InterfaceId:   iface,
+		UploadLimit:   max(input.UploadLimit, 0),
+		DownloadLimit: max(input.DownloadLimit, 0),
+		CreatedAt:     gtime.Now(),
+		UpdatedAt:     gtime.Now(),
+	}
+	if input.GroupId != nil && *input.GroupId > 0 {
+		group, err := getGroup(ctx, *input.GroupId)
+		if err != nil {
+			return nil, err
+		}
+		peer.GroupId = group.Id
+	}
+	if input.Tags != nil {
+		peer.Tags = normalizeTags(*input.Tags)
+	}
+	if input.Endpoint != nil {
+		if err := checkEndpoint(*input.Endpoint); err != nil {
+			return nil, err
+		}
+		peer.Endpoint = *input.Endpoint
+	}
+	if input.Keepalive != nil {
+		peer.Keepalive = *input.Keepalive
+	}
+	if input.RoutedNetworks != nil {
+		routed, err := checkRoutedNetworks(ctx, *input.RoutedNetworks, 0)
+		if err != nil {
+			return nil, err
+		}
+		peer.RoutedNetworks = routed
+	}
+	if input.ExpiresAt != nil {
+		expiresAt, err := parseExpiresAt(*input.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt != nil && expiresAt.Before(gtime.Now()) {
+			return nil, fmt.Errorf("到期时间不能早于当前时间")
+		}
+		peer.ExpiresAt = expiresAt
+	}
+	applyQuotaInput(peer, input, nil)
+	if err := checkQuota(peer.QuotaResetDay, peer.QuotaAction); err != nil {
+		return nil, err
 	}
 
-	// 保存到数据库 - 使用 OmitEmpty 跳过 Id=0，让 SQLite 自动生成 ID
-	res, err := g.DB().Model("wireguard_peer").OmitEmpty().Insert(peer)
+	// 保存到数据库 - 跳过 Id 让 SQLite 自动生成，其余字段 (含 0 值) 全部写入
+	res, err := g.DB().Model("wireguard_peer").Ctx(ctx).FieldsEx("id").Insert(peer)
 	if err != nil {
 		return nil, fmt.Errorf("保存客户端失败: %v", err)
 	}
 	id, _ := res.LastInsertId()
 	peer.Id = int(id)
-
-	// 添加到运行时
-	server := wgserver.GetServer()
-	if server.IsRunning() {
-		server.AddPeer(publicKey, ip)
-	}
-
-	g.Log().Infof(ctx, "[WireGuard] 创建客户端: %s (%s)", peer.Name, peer.AllowedIps)
 	return peer, nil
 }
 
 // UpdatePeer 更新客户端
-func UpdatePeer(ctx context.Context, id int, input *PeerInput) error {
+func UpdatePeer(ctx context.Context, iface, id int, input *PeerInput) error {
 	// 先获取客户端信息（用于同步运行时状态）
-	var peer entity.WireguardPeer
-	err := g.DB().Model("wireguard_peer").Where("id", id).Scan(&peer)
+	peer, err := getPeer(ctx, iface, id)
 	if err != nil {
-		return fmt.Errorf("客户端不存在")
+		return err
 	}
 
 	updateData := g.Map{
@@ -401,16 +726,103 @@ func UpdatePeer(ctx context.Context, id int, input *PeerInput) error {
 
 	if input.Name != "" {
 		updateData["name"] = input.Name
+		peer.Name = input.Name
 	}
-	if input.AllowedIPs != "" {
+	if input.AllowedIPs != "" && input.AllowedIPs != peer.AllowedIps {
+		if err := checkPeerAddress(ctx, iface, input.AllowedIPs, id); err != nil {
+			return err
+		}
 		updateData["allowed_ips"] = input.AllowedIPs
+		peer.AllowedIps = input.AllowedIPs
+	}
+	if input.UploadLimit >= 0 {
+		updateData["upload_limit"] = input.UploadLimit
+		peer.UploadLimit = input.UploadLimit
+	}
+	if input.DownloadLimit >= 0 {
+		updateData["download_limit"] = input.DownloadLimit
+		peer.DownloadLimit = input.DownloadLimit
+	}
+	if input.Endpoint != nil {
+		if err := checkEndpoint(*input.Endpoint); err != nil {
+			return err
+		}
+		updateData["endpoint"] = *input.Endpoint
+		peer.Endpoint = *input.Endpoint
+	}
+	if input.Keepalive != nil {
+		updateData["persistent_keepalive"] = *input.Keepalive
+		peer.Keepalive = *input.Keepalive
+	}
+	if input.RoutedNetworks != nil {
+		routed, err := checkRoutedNetworks(ctx, *input.RoutedNetworks, id)
+		if err != nil {
+			return err
+		}
+		updateData["routed_networks"] = routed
+		peer.RoutedNetworks = routed
+	}
+	if input.ExpiresAt != nil {
+		expiresAt, err := parseExpiresAt(*input.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		updateData["expires_at"] = expiresAt
+		peer.ExpiresAt = expiresAt
+	}
+	if input.GroupId != nil && *input.GroupId != peer.GroupId {
+		if *input.GroupId > 0 {
+			if _, err := getGroup(ctx, *input.GroupId); err != nil {
+				return err
+			}
+		}
+		updateData["group_id"] = max(*input.GroupId, 0)
+		peer.GroupId = max(*input.GroupId, 0)
+	}
+	if input.Tags != nil {
+		peer.Tags = normalizeTags(*input.Tags)
+		updateData["tags"] = peer.Tags
+	}
+	oldPublicKey := peer.PublicKey
+	if input.PublicKey != nil && *input.PublicKey != peer.PublicKey {
+		publicKey := strings.TrimSpace(*input.PublicKey)
+		if err := checkPeerPublicKey(ctx, publicKey, id); err != nil {
+			return err
+		}
+		// 更换为客户端自有密钥后不再保存私钥
+		peer.PublicKey = publicKey
+		peer.PrivateKey = ""
+		peer.External = 1
+		updateData["public_key"] = peer.PublicKey
+		updateData["private_key"] = ""
+		updateData["external"] = 1
+	}
+	wasQuotaDisabled := quotaDisabled(peer)
+	quotaChanged := applyQuotaInput(peer, input, updateData)
+	if quotaChanged {
+		if err := checkQuota(peer.QuotaResetDay, peer.QuotaAction); err != nil {
+			return err
+		}
 	}
-	updateData["enabled"] = func() int {
-		if input.Enabled {
-			return 1
+	expired := peer.ExpiresAt != nil && peer.ExpiresAt.Before(gtime.Now())
+	enabled := input.Enabled
+	// 超额禁用改为超额限速：恢复客户端，由随后的配额检查限速
+	if wasQuotaDisabled && peer.QuotaAction == QuotaActionThrottle && !expired {
+		enabled = true
+	}
+	if enabled && expired {
+		return fmt.Errorf("客户端已于 %s 到期，请先延长有效期", peer.ExpiresAt)
+	}
+	if enabled && peer.Enabled == 0 {
+		if err := checkQuotaEnable(peer, updateData); err != nil {
+			return err
 		}
-		return 0
-	}()
+	}
+	peer.Enabled = 0
+	if enabled {
+		peer.Enabled = 1
+	}
+	updateData["enabled"] = peer.Enabled
 
 	_, err = g.DB().Model("wireguard_peer").Where("id", id).Update(updateData)
 	if err != nil {
@@ -418,15 +830,13 @@ func UpdatePeer(ctx context.Context, id int, input *PeerInput) error {
 	}
 
 	// 同步运行时状态
-	server := wgserver.GetServer()
-	allowedIPs := input.AllowedIPs
-	if allowedIPs == "" {
-		allowedIPs = peer.AllowedIps
+	server := wgserver.GetServer(iface)
+	if oldPublicKey != peer.PublicKey {
+		server.ReplacePeerKey(oldPublicKey, peer.PublicKey)
 	}
-
-	if input.Enabled {
-		// 启用：添加到 WireGuard 设备
-		server.EnablePeer(peer.PublicKey, allowedIPs)
+	if enabled {
+		// 启用：添加到 WireGuard 设备，地址与限速实时生效，无需重启网卡
+		server.EnablePeer(runtimePeer(peer))
 		g.Log().Infof(ctx, "[WireGuard] 启用客户端: %s", peer.Name)
 	} else {
 		// 禁用：从 WireGuard 设备移除
@@ -434,16 +844,128 @@ func UpdatePeer(ctx context.Context, id int, input *PeerInput) error {
 		g.Log().Infof(ctx, "[WireGuard] 禁用客户端: %s", peer.Name)
 	}
 
+	// 配额调整后立即重新评估 (调高配额可解除超额状态)
+	if quotaChanged {
+		checkQuotas(ctx)
+	}
+
+	return nil
+}
+
+// RotatePeerPresharedKey 生成或轮换客户端预共享密钥，客户端需重新下载配置
+func RotatePeerPresharedKey(ctx context.Context, iface, id int) error {
+	psk, err := wgserver.GeneratePresharedKey()
+	if err != nil {
+		return fmt.Errorf("生成预共享密钥失败: %v", err)
+	}
+	return setPeerPresharedKey(ctx, iface, id, psk)
+}
+
+// RemovePeerPresharedKey 移除客户端预共享密钥
+func RemovePeerPresharedKey(ctx context.Context, iface, id int) error {
+	return setPeerPresharedKey(ctx, iface, id, "")
+}
+
+func setPeerPresharedKey(ctx context.Context, iface, id int, psk string) error {
+	peer, err := getPeer(ctx, iface, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = g.DB().Model("wireguard_peer").Where("id", id).Update(g.Map{
+		"preshared_key": psk,
+		"updated_at":    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("更新预共享密钥失败: %v", err)
+	}
+
+	// 运行中立即下发，已建立的会话在下次握手时切换
+	peer.PresharedKey = psk
+	server := wgserver.GetServer(iface)
+	if server.IsRunning() {
+		if err := server.AddPeer(runtimePeer(peer)); err != nil {
+			return fmt.Errorf("下发预共享密钥失败: %v", err)
+		}
+	}
+	if psk == "" {
+		g.Log().Infof(ctx, "[WireGuard] 客户端 %s 预共享密钥已移除", peer.Name)
+	} else {
+		g.Log().Infof(ctx, "[WireGuard] 客户端 %s 预共享密钥已更新", peer.Name)
+	}
 	return nil
 }
 
+// checkPeerPublicKey 校验客户端提交的公钥格式，且不能与服务端或其他客户端重复
+func checkPeerPublicKey(ctx context.Context, publicKey string, excludeID int) error {
+	if err := wgserver.CheckKey(publicKey); err != nil {
+		return fmt.Errorf("公钥无效: %v", err)
+	}
+	if count, _ := g.DB().Model("wireguard_config").Ctx(ctx).Where("public_key", publicKey).Count(); count > 0 {
+		return fmt.Errorf("公钥不能与服务端公钥相同")
+	}
+	count, _ := g.DB().Model("wireguard_peer").Ctx(ctx).Where("public_key", publicKey).WhereNot("id", excludeID).Count()
+	if count > 0 {
+		return fmt.Errorf("公钥已被其他客户端使用")
+	}
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// checkEndpoint 校验对端地址格式 host:port
+func checkEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	_, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return fmt.Errorf("Endpoint 格式错误，应为 host:port: %s", endpoint)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("Endpoint 端口无效: %s", endpoint)
+	}
+	return nil
+}
+
+// peerKeepalive 客户端配置使用的保活间隔，Peer 未单独设置时继承全局配置
+func peerKeepalive(peer *entity.WireguardPeer, serverConfig *ConfigOutput) int {
+	if peer.Keepalive >= 0 {
+		return peer.Keepalive
+	}
+	return serverConfig.PersistentKeepalive
+}
+
+// runtimePeer 将数据库记录转换为运行时 Peer 配置
+func runtimePeer(peer *entity.WireguardPeer) *wgserver.Peer {
+	return &wgserver.Peer{
+		Id:             peer.Id,
+		GroupId:        peer.GroupId,
+		Name:           peer.Name,
+		PublicKey:      peer.PublicKey,
+		PresharedKey:   peer.PresharedKey,
+		AllowedIPs:     peer.AllowedIps,
+		UploadLimit:    peer.UploadLimit,
+		DownloadLimit:  peer.DownloadLimit,
+		Enabled:        peer.Enabled == 1,
+		StaticEndpoint: peer.Endpoint,
+		Keepalive:      peer.Keepalive,
+		RoutedNetworks: peer.RoutedNetworks,
+		ThrottleRate:   peer.ThrottleRate,
+	}
+}
+
 // DeletePeer 删除客户端
-func DeletePeer(ctx context.Context, id int) error {
+func DeletePeer(ctx context.Context, iface, id int) error {
 	// 获取客户端信息
-	var peer entity.WireguardPeer
-	err := g.DB().Model("wireguard_peer").Where("id", id).Scan(&peer)
+	peer, err := getPeer(ctx, iface, id)
 	if err != nil {
-		return fmt.Errorf("客户端不存在")
+		return err
 	}
 
 	// 从数据库删除
@@ -453,24 +975,39 @@ func DeletePeer(ctx context.Context, id int) error {
 	}
 
 	// 从运行时移除
-	server := wgserver.GetServer()
-	server.RemovePeer(peer.PublicKey)
+	wgserver.GetServer(iface).RemovePeer(peer.PublicKey)
+
+	// 以该客户端为来源的访问控制规则随之删除
+	if res, err := g.DB().Model("wireguard_acl_rule").Where("source_peer_id", id).Delete(); err == nil {
+		if affected, _ := res.RowsAffected(); affected > 0 {
+			_ = loadACL(ctx, iface)
+		}
+	}
 
 	g.Log().Infof(ctx, "[WireGuard] 删除客户端: %s", peer.Name)
 	return nil
 }
 
 // GetPeerQRCode 获取客户端配置二维码
-func GetPeerQRCode(ctx context.Context, id int) (string, error) {
-	config, err := GetPeerConfig(ctx, id)
+func GetPeerQRCode(ctx context.Context, iface, id int, next bool) (string, error) {
+	// 配置模板中的私钥为占位符，扫码导入后无法使用
+	peer, err := getPeer(ctx, iface, id)
+	if err != nil {
+		return "", err
+	}
+	if peer.External == 1 {
+		return "", fmt.Errorf("该客户端使用自有密钥，服务端没有私钥，请下载配置模板并填入私钥")
+	}
+
+	config, err := GetPeerConfig(ctx, iface, id, next)
 	if err != nil {
 		return "", err
 	}
 
 	// 生成二维码
-	qr, err := qrcode.Encode(config, qrcode.Medium, 256)
+	qr, err := encodeQRCode(config)
 	if err != nil {
-		return "", fmt.Errorf("生成二维码失败: %v", err)
+		return "", err
 	}
 
 	// 转换为 Base64
@@ -478,9 +1015,18 @@ func GetPeerQRCode(ctx context.Context, id int) (string, error) {
 	return "data:image/png;base64," + base64Str, nil
 }
 
-// GetConnectionLogs 获取连接日志
-func GetConnectionLogs(ctx context.Context, peerId, page, pageSize int) ([]*wireguard.ConnectionLogInfo, int, error) {
-	model := g.DB().Model("wireguard_connection_log")
+// encodeQRCode 将客户端配置编码为 PNG 二维码
+func encodeQRCode(config string) ([]byte, error) {
+	qr, err := qrcode.Encode(config, qrcode.Medium, 256)
+	if err != nil {
+		return nil, fmt.Errorf("生成二维码失败: %v", err)
+	}
+	return qr, nil
+}
+
+// GetConnectionLogs 获取接口的连接日志
+func GetConnectionLogs(ctx context.Context, iface, peerId, page, pageSize int) ([]*wireguard.ConnectionLogInfo, int, error) {
+	model := g.DB().Model("wireguard_connection_log").Where("interface_id", iface)
 
 	if peerId > 0 {
 		model = model.Where("peer_id", peerId)
@@ -509,6 +1055,7 @@ func GetConnectionLogs(ctx context.Context, peerId, page, pageSize int) ([]*wire
 	}
 
 	err = g.DB().Model("wireguard_connection_log").
+		Where("interface_id", iface).
 		Where(func() string {
 			if peerId > 0 {
 				return fmt.Sprintf("peer_id = %d", peerId)
@@ -538,85 +1085,255 @@ func GetConnectionLogs(ctx context.Context, peerId, page, pageSize int) ([]*wire
 	return list, total, nil
 }
 
+// GetPeerEndpoints 获取客户端当前 Endpoint 及历史 Endpoint（按最近出现时间倒序）
+func GetPeerEndpoints(ctx context.Context, iface, id int) (string, []*wireguard.EndpointInfo, error) {
+	peer, err := getPeer(ctx, iface, id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	current := ""
+	if rp, ok := wgserver.GetServer(iface).GetAllPeers()[peer.PublicKey]; ok {
+		current = rp.Endpoint
+	}
+
+	var rows []struct {
+		Endpoint  string
+		FirstSeen string
+		LastSeen  string
+		Events    int
+	}
+	err = g.DB().Model("wireguard_connection_log").
+		Fields("endpoint, MIN(created_at) AS first_seen, MAX(created_at) AS last_seen, COUNT(*) AS events").
+		Where("peer_id", id).
+		WhereNot("endpoint", "").
+		Group("endpoint").
+		OrderDesc("last_seen").
+		Scan(&rows)
+	if err != nil {
+		return "", nil, fmt.Errorf("查询 Endpoint 历史失败: %v", err)
+	}
+
+	history := make([]*wireguard.EndpointInfo, 0, len(rows))
+	for _, row := range rows {
+		history = append(history, &wireguard.EndpointInfo{
+			Endpoint:  row.Endpoint,
+			FirstSeen: row.FirstSeen,
+			LastSeen:  row.LastSeen,
+			Events:    row.Events,
+		})
+	}
+	return current, history, nil
+}
+
 // ==================== 辅助函数 ====================
 
-// allocateIP 分配 IP 地址，从数据库读取服务端配置的网段
-func allocateIP(ctx context.Context) (string, error) {
-	// 从数据库读取服务端配置的 VPN 网段
-	var addressRange string
-	dbAddress, err := g.DB().Model("wireguard_config").Where("id", 1).Value("address")
-	if err == nil && !dbAddress.IsEmpty() {
-		addressRange = dbAddress.String()
-	} else {
-		// 回退到配置文件默认值
-		addressRange = g.Cfg().MustGet(ctx, "wireguard.addressRange", "10.66.66.1/24").String()
+// allocateIP 分配 IP 地址，从数据库读取接口配置的网段
+// 服务端配置了双栈地址时，为每个地址族各分配一个地址，如 "10.66.66.2/32, fd42:42:42::2/128"
+func allocateIP(ctx context.Context, iface int) (string, error) {
+	pools, err := peerPools(ctx, iface, 0)
+	if err != nil {
+		return "", err
 	}
 
-	// 解析网段（例如: "198.18.88.1/24"）
-	parts := splitCIDR(addressRange)
-	if len(parts) != 2 {
-		return "", fmt.Errorf("无效的地址范围: %s", addressRange)
+	addrs := make([]string, 0, len(pools))
+	for _, pool := range pools {
+		addr, err := pool.Allocate("新客户端")
+		if err != nil {
+			return "", err
+		}
+		addrs = append(addrs, netip.PrefixFrom(addr, addr.BitLen()).String())
 	}
+	return strings.Join(addrs, ", "), nil
+}
 
-	serverIP := parts[0]
-	mask := parts[1]
-	ipParts := splitIP(serverIP)
-	if len(ipParts) != 4 {
-		return "", fmt.Errorf("无效的 IP 地址: %s", serverIP)
+// checkServerAddress 检查新的服务端地址是否与接口下已有客户端地址冲突
+func checkServerAddress(ctx context.Context, iface int, prefixes []netip.Prefix) error {
+	var peers []struct {
+		Name       string
+		AllowedIps string
 	}
+	if err := g.DB().Model("wireguard_peer").Ctx(ctx).Fields("name, allowed_ips").Where("interface_id", iface).Scan(&peers); err != nil {
+		return nil
+	}
+	for _, p := range peers {
+		for _, addr := range ipam.ParseAddrs(p.AllowedIps) {
+			for _, prefix := range prefixes {
+				if addr == prefix.Addr() {
+					return fmt.Errorf("服务端地址 %s 与客户端 %s 冲突", addr, p.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
 
-	// 获取已使用的 IP
-	usedIPsResult, err := g.DB().Model("wireguard_peer").Fields("allowed_ips").Array()
-	usedSet := make(map[string]bool)
-	if err == nil {
-		for _, ip := range usedIPsResult {
-			ipStr := ip.String()
-			if idx := indexOf(ipStr, "/"); idx > 0 {
-				usedSet[ipStr[:idx]] = true
+// checkPeerAddress 检查管理员指定的客户端地址是否位于接口网段内，且不与服务端、其他客户端、其他接口或 OpenVPN 网段冲突
+func checkPeerAddress(ctx context.Context, iface int, allowedIPs string, excludeID int) error {
+	pools, err := peerPools(ctx, iface, excludeID)
+	if err != nil {
+		return err
+	}
+	others := otherInterfaceSubnets(ctx, iface)
+	addrs := ipam.ParseAddrs(allowedIPs)
+	if len(addrs) == 0 {
+		return fmt.Errorf("客户端地址格式错误: %s", allowedIPs)
+	}
+	for _, addr := range addrs {
+		if err := ipam.CheckAddr(ctx, ipam.ServiceWireGuard, addr); err != nil {
+			return err
+		}
+		for _, prefix := range others {
+			if prefix.Contains(addr) {
+				return fmt.Errorf("地址 %s 位于其他接口的网段 %s 内", addr, prefix.Masked())
+			}
+		}
+		inPool := false
+		for _, pool := range pools {
+			if pool.Prefix().Contains(addr) {
+				if err := pool.Pin(addr, "当前客户端"); err != nil {
+					return err
+				}
+				inPool = true
 			}
 		}
+		if !inPool {
+			subnets := make([]string, 0, len(pools))
+			for _, pool := range pools {
+				subnets = append(subnets, pool.Prefix().Masked().String())
+			}
+			return fmt.Errorf("地址 %s 不在接口网段 %s 内", addr, strings.Join(subnets, ", "))
+		}
+	}
+	return nil
+}
+
+// checkRoutedNetworks 校验 Peer 路由网段，不得与 WireGuard / OpenVPN 网段或其他 Peer 的路由网段重叠
+// 返回规范化后的网段列表，如 "192.168.10.0/24, 192.168.20.0/24"
+func checkRoutedNetworks(ctx context.Context, routedNetworks string, excludeID int) (string, error) {
+	prefixes, err := wgserver.ParseRoutedNetworks(routedNetworks)
+	if err != nil {
+		return "", err
+	}
+	if x, y, ok := ipam.Overlap(prefixes, ipam.Subnets(ctx, ipam.ServiceWireGuard)); ok {
+		return "", fmt.Errorf("路由网段 %s 与 WireGuard 网段 %s 冲突", x, y.Masked())
+	}
+	if err := ipam.CheckOverlap(ctx, ipam.ServiceWireGuard, prefixes); err != nil {
+		return "", err
 	}
 
-	// 分配新 IP (从 .2 开始, .1 是服务器保留)
-	for i := 2; i < 255; i++ {
-		newIP := fmt.Sprintf("%s.%s.%s.%d", ipParts[0], ipParts[1], ipParts[2], i)
-		if !usedSet[newIP] {
-			return fmt.Sprintf("%s/%s", newIP, mask), nil
+	var peers []struct {
+		Id             int
+		Name           string
+		RoutedNetworks string
+	}
+	if err := g.DB().Model("wireguard_peer").Ctx(ctx).Fields("id, name, routed_networks").Scan(&peers); err == nil {
+		for _, p := range peers {
+			if p.Id == excludeID {
+				continue
+			}
+			others, _ := wgserver.ParseRoutedNetworks(p.RoutedNetworks)
+			if x, y, ok := ipam.Overlap(prefixes, others); ok {
+				return "", fmt.Errorf("路由网段 %s 与客户端 %s 的路由网段 %s 冲突", x, p.Name, y)
+			}
 		}
 	}
 
-	return "", fmt.Errorf("IP 地址已耗尽")
+	items := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		items = append(items, prefix.String())
+	}
+	return strings.Join(items, ", "), nil
 }
 
-func splitCIDR(cidr string) []string {
-	for i := 0; i < len(cidr); i++ {
-		if cidr[i] == '/' {
-			return []string{cidr[:i], cidr[i+1:]}
+// appendRoutedNetworks 将同一接口下其他已启用 Peer 的路由网段追加到客户端 AllowedIPs，已被覆盖的网段跳过
+func appendRoutedNetworks(ctx context.Context, iface int, allowedIPs string, selfID int) string {
+	var peers []struct {
+		Id             int
+		RoutedNetworks string
+	}
+	if err := g.DB().Model("wireguard_peer").Fields("id, routed_networks").Where("interface_id", iface).
+		Where("enabled", 1).WhereNot("routed_networks", "").Scan(&peers); err != nil {
+		return allowedIPs
+	}
+
+	covered, _ := ipam.ParsePrefixes(allowedIPs)
+	result := allowedIPs
+	for _, p := range peers {
+		if p.Id == selfID {
+			continue
+		}
+		prefixes, _ := wgserver.ParseRoutedNetworks(p.RoutedNetworks)
+		for _, prefix := range prefixes {
+			if prefixCovered(covered, prefix) {
+				continue
+			}
+			covered = append(covered, prefix)
+			if result == "" {
+				result = prefix.String()
+			} else {
+				result += ", " + prefix.String()
+			}
 		}
 	}
-	return nil
+	return result
 }
 
-func splitIP(ip string) []string {
-	parts := make([]string, 0, 4)
-	start := 0
-	for i := 0; i < len(ip); i++ {
-		if ip[i] == '.' {
-			parts = append(parts, ip[start:i])
-			start = i + 1
+// prefixCovered 判断网段是否已被列表中的某个网段完全包含
+func prefixCovered(list []netip.Prefix, prefix netip.Prefix) bool {
+	for _, p := range list {
+		if p.Bits() <= prefix.Bits() && p.Contains(prefix.Addr()) {
+			return true
 		}
 	}
-	parts = append(parts, ip[start:])
-	return parts
+	return false
 }
 
-func indexOf(s string, sub string) int {
-	for i := 0; i <= len(s)-len(sub); i++ {
-		if s[i:i+len(sub)] == sub {
-			return i
+// peerPools 按接口网段构建地址池，服务端地址与网关保留，接口下已有客户端地址标记为占用
+// excludeID 为正在编辑的客户端，其原地址不计入占用
+func peerPools(ctx context.Context, iface, excludeID int) ([]*ipam.Pool, error) {
+	// 从数据库读取接口配置的 VPN 网段
+	var addressRange string
+	dbAddress, err := g.DB().Model("wireguard_config").Ctx(ctx).Where("id", iface).Value("address")
+	if err == nil && !dbAddress.IsEmpty() {
+		addressRange = dbAddress.String()
+	} else {
+		// 回退到配置文件默认值
+		addressRange = g.Cfg().MustGet(ctx, "wireguard.addressRange", "10.66.66.1/24").String()
+	}
+
+	// 解析网段（例如: "198.18.88.1/24, fd42:42:42::1/64"）
+	prefixes, err := wgserver.ParseServerAddress(addressRange)
+	if err != nil {
+		return nil, fmt.Errorf("无效的地址范围: %s", addressRange)
+	}
+	pools := make([]*ipam.Pool, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		pool := ipam.NewPool(prefix)
+		pool.Reserve(prefix.Addr(), "服务端")
+		pool.Reserve(ipam.FirstHost(prefix), "网关")
+		pools = append(pools, pool)
+	}
+
+	// 获取已使用的 IP
+	var peers []struct {
+		Id         int
+		Name       string
+		AllowedIps string
+	}
+	if err := g.DB().Model("wireguard_peer").Ctx(ctx).Fields("id, name, allowed_ips").Where("interface_id", iface).Scan(&peers); err == nil {
+		for _, p := range peers {
+			if p.Id == excludeID {
+				continue
+			}
+			for _, addr := range ipam.ParseAddrs(p.AllowedIps) {
+				for _, pool := range pools {
+					pool.Use(addr, "客户端 "+p.Name)
+				}
+			}
 		}
 	}
-	return -1
+	return pools, nil
 }
 
 func formatDuration(d time.Duration) string {
@@ -632,26 +1349,45 @@ func formatDuration(d time.Duration) string {
 
 // InitWireGuard 初始化 WireGuard 服务（自动启动）
 func InitWireGuard(ctx context.Context) {
-	// 检查是否配置了自动启动
-	var config struct {
-		AutoStart int
+	// 定时执行到期的服务端密钥轮换
+	go runKeyRotationScheduler(ctx)
+
+	// 启动前先禁用已到期的客户端，之后定时检查
+	expirePeers(ctx)
+	go runPeerExpiryScheduler(ctx)
+
+	// 流量配额检查
+	go runQuotaScheduler(ctx)
+
+	// UAPI 配置漂移检查
+	go runDriftScheduler(ctx)
+
+	// 检查各接口是否配置了自动启动
+	var configs []struct {
+		Id            int
+		InterfaceName string
+		AutoStart     int
 	}
-	err := g.DB().Model("wireguard_config").Where("id", 1).Scan(&config)
+	err := g.DB().Model("wireguard_config").OrderAsc("id").Scan(&configs)
 	if err != nil {
 		g.Log().Debugf(ctx, "[WireGuard] 读取配置失败: %v", err)
 		return
 	}
 
-	if config.AutoStart != 1 {
-		g.Log().Info(ctx, "[WireGuard] 自动启动未开启，跳过")
-		return
-	}
+	for _, config := range configs {
+		// 清理上次异常退出残留的 NAT 规则
+		wgserver.CleanupNAT(config.InterfaceName)
+		if config.AutoStart != 1 {
+			g.Log().Infof(ctx, "[WireGuard] 接口 %s 自动启动未开启，跳过", config.InterfaceName)
+			continue
+		}
 
-	// 自动启动 WireGuard 服务
-	g.Log().Info(ctx, "[WireGuard] 自动启动已开启，正在启动服务...")
-	if err := Start(ctx); err != nil {
-		g.Log().Errorf(ctx, "[WireGuard] 自动启动失败: %v", err)
-	} else {
-		g.Log().Info(ctx, "[WireGuard] 自动启动成功")
+		// 自动启动 WireGuard 服务
+		g.Log().Infof(ctx, "[WireGuard] 接口 %s 自动启动已开启，正在启动服务...", config.InterfaceName)
+		if err := Start(ctx, config.Id); err != nil {
+			g.Log().Errorf(ctx, "[WireGuard] 接口 %s 自动启动失败: %v", config.InterfaceName, err)
+		} else {
+			g.Log().Infof(ctx, "[WireGuard] 接口 %s 自动启动成功", config.InterfaceName)
+		}
 	}
 }
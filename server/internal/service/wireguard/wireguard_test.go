@@ -3,6 +3,12 @@ package wireguard
 import (
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+
+	"omniwire/internal/model/entity"
+	"omniwire/internal/service/wgserver"
 )
 
 func TestBuildPeerConfigPreservesCommaSeparatedAllowedIPs(t *testing.T) {
@@ -16,7 +22,7 @@ func TestBuildPeerConfigPreservesCommaSeparatedAllowedIPs(t *testing.T) {
 		ClientAllowedIPs:    "10.0.0.0/8,192.168.0.0/16, 172.16.0.0/12",
 	}
 
-	config := buildPeerConfig("peer-private-key", "10.66.66.2/32", serverConfig)
+	config := buildPeerConfig(&entity.WireguardPeer{PrivateKey: "peer-private-key", AllowedIps: "10.66.66.2/32"}, serverConfig)
 
 	expected := "AllowedIPs = 10.0.0.0/8,192.168.0.0/16, 172.16.0.0/12"
 	if !strings.Contains(config, expected) {
@@ -24,3 +30,160 @@ func TestBuildPeerConfigPreservesCommaSeparatedAllowedIPs(t *testing.T) {
 	}
 }
 
+func TestQuotaPeriodStart(t *testing.T) {
+	cases := []struct {
+		now      string
+		resetDay int
+		want     string
+	}{
+		{"2024-03-15 10:00:00", 1, "2024-03-01"},
+		{"2024-03-15 10:00:00", 20, "2024-02-20"},
+		{"2024-03-20 00:00:00", 20, "2024-03-20"},
+		{"2024-01-05 00:00:00", 10, "2023-12-10"},
+		{"2024-03-31 00:00:00", 31, "2024-03-28"}, // 重置日限制为 28
+	}
+	for _, c := range cases {
+		now, _ := time.ParseInLocation("2006-01-02 15:04:05", c.now, time.Local)
+		if got := quotaPeriodStart(now, c.resetDay).Format("2006-01-02"); got != c.want {
+			t.Errorf("quotaPeriodStart(%s, %d) = %s, want %s", c.now, c.resetDay, got, c.want)
+		}
+	}
+}
+
+func TestParsePeerCSV(t *testing.T) {
+	inputs, err := ParsePeerCSV("name,allowedIPs\nalice\nbob, 10.66.66.50/32\n\n carol ,\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PeerInput{{Name: "alice"}, {Name: "bob", AllowedIPs: "10.66.66.50/32"}, {Name: "carol"}}
+	if len(inputs) != len(want) {
+		t.Fatalf("expected %d peers, got %d", len(want), len(inputs))
+	}
+	for i, w := range want {
+		if inputs[i].Name != w.Name || inputs[i].AllowedIPs != w.AllowedIPs {
+			t.Errorf("peer %d = %q %q, want %q %q", i, inputs[i].Name, inputs[i].AllowedIPs, w.Name, w.AllowedIPs)
+		}
+	}
+}
+
+func TestParseWgQuick(t *testing.T) {
+	config, err := parseWgQuick(`[Interface]
+Address = 10.8.0.1/24
+ListenPort = 51000
+PrivateKey = server-key
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+
+# alice
+[Peer]
+PublicKey = alice-key
+AllowedIPs = 10.8.0.2/32 # laptop
+PersistentKeepalive = 25 # nat
+
+[Peer]
+# Name = site-b
+PublicKey = site-b-key
+AllowedIPs = 10.8.0.3/32
+AllowedIPs = 192.168.50.0/24
+PersistentKeepalive = 15
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Address != "10.8.0.1/24" || config.ListenPort != 51000 || config.PrivateKey != "server-key" {
+		t.Fatalf("unexpected interface: %+v", config)
+	}
+	if len(config.Peers) != 2 {
+		t.Fatalf("expected 2 peers, got %d", len(config.Peers))
+	}
+	alice, site := config.Peers[0], config.Peers[1]
+	if alice.Name != "alice" || alice.AllowedIPs != "10.8.0.2/32" || alice.Keepalive != 25 {
+		t.Errorf("unexpected peer: %+v", alice)
+	}
+	if site.Name != "site-b" || site.AllowedIPs != "10.8.0.3/32, 192.168.50.0/24" || site.Keepalive != 15 {
+		t.Errorf("unexpected peer: %+v", site)
+	}
+
+	prefixes, _ := wgserver.ParseServerAddress(config.Address)
+	addrs, routed, err := splitPeerAllowedIPs(site.AllowedIPs, prefixes)
+	if err != nil || addrs != "10.8.0.3/32" || routed != "192.168.50.0/24" {
+		t.Errorf("splitPeerAllowedIPs = %q, %q, %v", addrs, routed, err)
+	}
+
+	if _, err := parseWgQuick("[Peer]\nAllowedIPs = 10.8.0.2/32\n"); err == nil {
+		t.Error("expected error for peer without PublicKey")
+	}
+}
+
+func TestBuildPeerConfigWithoutPrivateKey(t *testing.T) {
+	config := buildPeerConfig(&entity.WireguardPeer{PublicKey: "client-public-key", AllowedIps: "10.66.66.2/32", External: 1}, &ConfigOutput{
+		PublicKey:       "server-public-key",
+		EndpointAddress: "vpn.example.com",
+		ListenPort:      51820,
+	})
+	if !strings.Contains(config, "PrivateKey = "+privateKeyPlaceholder+"\n") {
+		t.Fatalf("expected private key placeholder, got:\n%s", config)
+	}
+}
+
+func TestCheckQuotaEnable(t *testing.T) {
+	peer := &entity.WireguardPeer{
+		InterfaceId:   wgserver.DefaultInterface,
+		PublicKey:     "quota-peer",
+		TotalUpload:   600,
+		TotalDownload: 500,
+		QuotaBase:     100,
+		QuotaBytes:    1000,
+		QuotaAction:   QuotaActionDisable,
+		QuotaExceeded: 1,
+	}
+	if err := checkQuotaEnable(peer, g.Map{}); err == nil {
+		t.Fatal("enabling a peer still over quota should fail")
+	}
+
+	peer.QuotaBytes = 2000
+	data := g.Map{}
+	if err := checkQuotaEnable(peer, data); err != nil {
+		t.Fatalf("enabling after raising quota: %v", err)
+	}
+	if peer.QuotaExceeded != 0 || data["quota_exceeded"] != 0 {
+		t.Fatalf("quota_exceeded should be cleared, got %d / %v", peer.QuotaExceeded, data)
+	}
+
+	// 改为超额限速后允许启用，由配额检查重新限速
+	peer.QuotaBytes, peer.QuotaExceeded, peer.QuotaAction = 1000, 1, QuotaActionThrottle
+	if err := checkQuotaEnable(peer, g.Map{}); err != nil || peer.QuotaExceeded != 0 {
+		t.Fatalf("throttle action: err=%v exceeded=%d", err, peer.QuotaExceeded)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	cases := map[string]string{
+		"":                       "",
+		" ops , dev,ops,, ":      "ops,dev",
+		"b,a,b":                  "b,a",
+		"with space, with space": "with space",
+	}
+	for in, want := range cases {
+		if got := normalizeTags(in); got != want {
+			t.Errorf("normalizeTags(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_a\b`); got != `50\%\_a\\b` {
+		t.Fatalf("escapeLike = %q", got)
+	}
+}
+
+func TestCheckSwitchAt(t *testing.T) {
+	now := time.Now()
+	for _, switchAt := range []time.Time{now.Add(-time.Hour), now, now.Add(minRotationLead - time.Second)} {
+		if err := checkSwitchAt(switchAt, now); err == nil {
+			t.Errorf("switchAt %s accepted", switchAt.Sub(now))
+		}
+	}
+	if err := checkSwitchAt(now.Add(minRotationLead), now); err != nil {
+		t.Fatalf("switchAt at minimum lead rejected: %v", err)
+	}
+}